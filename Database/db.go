@@ -0,0 +1,199 @@
+// Package db opens a database file directly from Go, without the REPL.
+//
+//	handle, err := db.Open("data/users", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer handle.Close()
+//	err = handle.Put([]byte("alice"), []byte("admin"))
+package db
+
+import (
+	diskmanager "db/DiskManager"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Get and Delete when the key is not in the database
+var ErrNotFound = diskmanager.ErrKeyNotFound
+
+// ErrClosed is returned by every method called after Close
+var ErrClosed = errors.New("database is closed")
+
+// ErrLocked is returned by Open when another process keeps the file locked
+var ErrLocked = diskmanager.ErrLocked
+
+// ErrReadOnly is returned by Put and Delete on a database opened read only
+var ErrReadOnly = diskmanager.ErrReadOnly
+
+type Iterator = diskmanager.Iterator
+
+// Type, Order and KeyType only shape a database that Open creates, an existing file
+// keeps the layout recorded in its header. The zero value is a tree with bytes keys.
+type Options struct {
+	Type           string // "tree" or "list", "tree" when empty
+	Order          int    // fanout of the tree pages, 0 picks the default
+	KeyType        string // "int32", "int64", "string" or "bytes", "bytes" when empty
+	Table          string // the table to work on, the one the file was created with when empty
+	CacheSize      int    // pages kept in the page cache, 0 picks the default
+	ErrorIfMissing bool   // fail instead of creating a missing file
+	ReadOnly       bool   // share the file with other readers, writes fail with ErrReadOnly
+	// how long Open waits for another process to let go of the file before failing
+	// with ErrLocked, 0 picks the default
+	BusyTimeout time.Duration
+}
+
+// DB is an open database file. Keys are passed in their encoded form, raw bytes for
+// string and bytes keys and Int32Key or Int64Key for integer keys. A DB may be used
+// from several goroutines at once, Get and Scan run in parallel while Put and Delete
+// wait for each other.
+type DB struct {
+	mu    sync.RWMutex // guards disk and table against Close
+	disk  *diskmanager.DiskManager
+	table diskmanager.Table
+}
+
+// Open opens the database file at path, creating it when it does not exist. A nil
+// options uses the defaults.
+func Open(path string, options *Options) (*DB, error) {
+
+	if options == nil {
+		options = &Options{}
+	}
+	found, err := diskmanager.DBExists(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open error: %w", err)
+	}
+	if !found {
+		if options.ErrorIfMissing || options.ReadOnly {
+			return nil, fmt.Errorf("Open error: database %s does not exist", path)
+		}
+		if err := create(path, options); err != nil {
+			return nil, fmt.Errorf("Open error: %w", err)
+		}
+	}
+
+	timeout := options.BusyTimeout
+	if timeout == 0 {
+		timeout = diskmanager.BUSY_TIMEOUT
+	}
+	disk, err := diskmanager.OpenDatabaseAt(path, options.ReadOnly, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("Open error: %w", err)
+	}
+	if options.CacheSize > 0 {
+		disk.SetCacheSize(options.CacheSize)
+	}
+	name := options.Table
+	if name == "" {
+		name = disk.Tables()[0].TblNam
+	}
+	table, err := diskmanager.InitTable(disk, name)
+	if err != nil {
+		disk.Close()
+		return nil, fmt.Errorf("Open error: %w", err)
+	}
+	return &DB{disk: disk, table: table}, nil
+}
+
+func create(path string, options *Options) error {
+
+	dbType := options.Type
+	if dbType == "" {
+		dbType = "tree"
+	}
+	keyName := options.KeyType
+	if keyName == "" {
+		keyName = "bytes"
+	}
+	keyType, err := diskmanager.KeyTypeByName(keyName)
+	if err != nil {
+		return err
+	}
+	return diskmanager.CreateDatabaseAt(path, dbType, options.Order, keyType)
+}
+
+// Get returns the value stored under key, or ErrNotFound
+func (db *DB) Get(key []byte) ([]byte, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.disk == nil {
+		return nil, ErrClosed
+	}
+	val, err := db.table.Select(key)
+	if err != nil {
+		return nil, fmt.Errorf("Get error: %w", err)
+	}
+	return []byte(val), nil
+}
+
+// Put stores val under key, replacing any value already there
+func (db *DB) Put(key, val []byte) error {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.disk == nil {
+		return ErrClosed
+	}
+	if err := db.table.Upsert(key, string(val)); err != nil {
+		return fmt.Errorf("Put error: %w", err)
+	}
+	return nil
+}
+
+// Delete removes key, or returns ErrNotFound
+func (db *DB) Delete(key []byte) error {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.disk == nil {
+		return ErrClosed
+	}
+	if err := db.table.Delete(key); err != nil {
+		return fmt.Errorf("Delete error: %w", err)
+	}
+	return nil
+}
+
+// Scan iterates the keys from from to to, both inclusive, a nil bound leaves that end
+// of the range open
+func (db *DB) Scan(from, to []byte, desc bool) (*Iterator, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.disk == nil {
+		return nil, ErrClosed
+	}
+	it, err := db.table.Scan(from, to, desc)
+	if err != nil {
+		return nil, fmt.Errorf("Scan error: %w", err)
+	}
+	return it, nil
+}
+
+// Close releases the file, calling it more than once is harmless
+func (db *DB) Close() error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.disk == nil {
+		return nil
+	}
+	err := db.disk.Close()
+	db.disk, db.table = nil, nil
+	if err != nil {
+		return fmt.Errorf("Close error: %w", err)
+	}
+	return nil
+}
+
+func Int32Key(v int32) []byte {
+	return diskmanager.Int32Key(v)
+}
+
+func Int64Key(v int64) []byte {
+	return diskmanager.Int64Key(v)
+}
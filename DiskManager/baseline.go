@@ -0,0 +1,178 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Files of format version 1 were written before the header had a magic. They hold one
+// table of order 3 with int32 keys, start with a baselineHeader and every record after
+// it is a baselineRecHead followed by a page of the type of the table.
+
+type baselineHeader struct {
+	RootAddr int32 // the end of the file while the table is empty, -1 once deletes empty a list
+	IsLinear bool
+}
+
+type baselineRecHead struct {
+	Deleted bool
+	RecAddr int32
+	RecSize int32
+	RecType int8
+}
+
+type baselineTreePage struct {
+	Head TreeHead
+	Data [2]baselineNode
+	Chld [3]int32
+}
+
+type baselineListPage struct {
+	Head ListHead
+	Data [2]baselineNode
+	Chld int32
+}
+
+// baselineNode is empty when Key is 0 and Val all zeros, values are padded with zeros
+type baselineNode struct {
+	Key int32
+	Val [32]byte
+}
+
+// node is n in the current layout. The key was a plain int32 compared as a number, it
+// becomes the Int32Key bytes, which keep the order. The zeros padding the value are
+// dropped, which is what reading it gave back.
+func (n baselineNode) node() DataNode {
+
+	if n.Key == 0 && n.Val == [32]byte{} {
+		return DataNode{}
+	}
+	val := bytes.TrimRight(n.Val[:], "\x00")
+	node := DataNode{KLen: 4, Size: int32(len(val))}
+	copy(node.Key[:], Int32Key(n.Key))
+	copy(node.Val[:], val)
+	return node
+}
+
+// baselineNodes is the slots of a version 1 page in the current layout
+func baselineNodes(old [2]baselineNode) []DataNode {
+	nodes := make([]DataNode, len(old))
+	for i := range old {
+		nodes[i] = old[i].node()
+	}
+	return nodes
+}
+
+// decodeBaselineHeader reads the header of a version 1 file of size bytes. Those have
+// no catalog, directory or free list and an empty table points its root at the end of
+// the file or at -1, which becomes 0 as it is now.
+func decodeBaselineHeader(buf []byte, size int64) (*TableHeader, error) {
+
+	old := baselineHeader{}
+	if err := binary.Read(bytes.NewReader(buf), BINARY_ORDER, &old); err != nil {
+		return nil, fmt.Errorf("%w: file header cut short", ErrFormat)
+	}
+	head := &TableHeader{
+		Version:   1,
+		PageSize:  int32(baselinePageSize(old.IsLinear)),
+		TreeOrder: int32(len(baselineTreePage{}.Chld)),
+		KeyType:   KT_INT32,
+		RootAddr:  old.RootAddr,
+		IsLinear:  old.IsLinear,
+	}
+	if head.RootAddr < 0 || int64(head.RootAddr) >= size {
+		head.RootAddr = 0
+	}
+	return head, nil
+}
+
+// decodeBaseline reads a record of a version 1 file into the current types. A deleted
+// record was zeroed but for Deleted and reads as an empty list page.
+func decodeBaseline(buf []byte) (*DiskData, error) {
+
+	reader := bytes.NewReader(buf)
+	old := baselineRecHead{}
+	if err := binary.Read(reader, BINARY_ORDER, &old); err != nil {
+		return nil, fmt.Errorf("DiskData deserialisation error, reading RecHead: %w", err)
+	}
+	data := &DiskData{RecHead: old.head()}
+	switch old.RecType {
+	case DT_LIST_PAGE:
+		page := baselineListPage{}
+		if err := binary.Read(reader, BINARY_ORDER, &page); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_LIST_PAGE): %w", err)
+		}
+		data.RecData = ListPage{Head: page.Head, Data: baselineNodes(page.Data), Chld: page.Chld}
+	case DT_TREE_PAGE:
+		page := baselineTreePage{}
+		if err := binary.Read(reader, BINARY_ORDER, &page); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_TREE_PAGE): %w", err)
+		}
+		data.RecData = TreePage{Head: page.Head, Data: baselineNodes(page.Data), Chld: page.Chld[:]}
+	default:
+		return nil, fmt.Errorf("DiskData deserialisation error, version 1 record type %d", old.RecType)
+	}
+	return data, nil
+}
+
+// head is h as a current record header, version 1 had no free list or checksums
+func (h baselineRecHead) head() DskDataHdr {
+	return DskDataHdr{Deleted: h.Deleted, RecAddr: h.RecAddr, RecSize: h.RecSize, RecType: h.RecType}
+}
+
+// baselinePageSize is the size of the pages of a version 1 file holding a list or a tree
+func baselinePageSize(isLinear bool) int {
+	if isLinear {
+		return BASELINE_LIST_PAGE_SIZE
+	}
+	return BASELINE_TREE_PAGE_SIZE
+}
+
+// isBaseline tells whether buf, the start of a file of size bytes without a magic, is
+// a version 1 file. Nothing in those files says what they are, so it goes by their
+// shape: the header, records of the one size of the table and a first record that
+// holds its own address.
+func isBaseline(buf []byte, size int64) bool {
+
+	if len(buf) < BASELINE_HEAD_SIZE || buf[4] > 1 {
+		return false
+	}
+	head := baselineHeader{}
+	if err := binary.Read(bytes.NewReader(buf), BINARY_ORDER, &head); err != nil {
+		return false
+	}
+	pageSize := baselinePageSize(head.IsLinear)
+	recSize := int64(BASELINE_REC_HEAD_SIZE + pageSize)
+	body := size - int64(BASELINE_HEAD_SIZE)
+	if body < 0 || body%recSize != 0 {
+		return false
+	}
+	root := int64(head.RootAddr) - int64(BASELINE_HEAD_SIZE)
+	if head.RootAddr != -1 && (root < 0 || root > body || root%recSize != 0) {
+		return false
+	}
+	if body == 0 {
+		return true
+	}
+
+	if len(buf) < BASELINE_HEAD_SIZE+BASELINE_REC_HEAD_SIZE {
+		return false
+	}
+	rec := baselineRecHead{}
+	if err := binary.Read(bytes.NewReader(buf[BASELINE_HEAD_SIZE:]), BINARY_ORDER, &rec); err != nil {
+		return false
+	}
+	recType := int8(DT_TREE_PAGE)
+	if head.IsLinear {
+		recType = DT_LIST_PAGE
+	}
+	// a deleted record was overwritten with zeros but for Deleted
+	switch {
+	case buf[BASELINE_HEAD_SIZE] > 1:
+		return false
+	case rec.Deleted:
+		return rec.RecAddr == 0 && rec.RecSize == 0 && rec.RecType == DT_LIST_PAGE
+	}
+	return rec.RecAddr == int32(BASELINE_HEAD_SIZE) && rec.RecSize == int32(pageSize) && rec.RecType == recType
+}
@@ -0,0 +1,510 @@
+package diskmanager
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// RowSource is a stream of rows for BulkLoad, in ascending key order
+type RowSource interface {
+	Next() bool
+	Key() Key
+	Value() string
+	Err() error
+}
+
+// BulkLoad fills the empty table name with the rows of src and returns how many it
+// loaded. A tree is written bottom-up: leaves are packed full one after the other and
+// every page above them is written once its last child is, instead of descending from
+// the root for every row. The indexes of the table are built the same way once the
+// table is, from the index key of every row sorted, those keys are the only part of
+// the load held in memory. The pages are committed every BULK_LOAD_PAGES pages while
+// nothing points at them yet and the last commit sets the roots, a row out of order
+// or a failing src frees what was written and leaves the table empty. A crash between
+// two commits is different: the pages committed so far are linked to nothing and no
+// longer reachable to be freed, they stay in the file until a vacuum rewrites it. The
+// database is locked for the whole load, src cannot be a scan of the same database.
+func (d *DiskManager) BulkLoad(name string, src RowSource) (int, error) {
+
+	if err := d.writable(); err != nil {
+		return 0, fmt.Errorf("BulkLoad error: %w", err)
+	}
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	if len(d.OpSavs) > 0 {
+		return 0, fmt.Errorf("BulkLoad error: a bulk load commits as it goes, it cannot run inside a transaction")
+	}
+	ti := d.table(name)
+	if ti == nil {
+		return 0, fmt.Errorf("BulkLoad error: no table %s in the database", name)
+	}
+	if empty, err := d.isEmpty(ti); err != nil {
+		return 0, fmt.Errorf("BulkLoad error: %w", err)
+	} else if !empty {
+		return 0, fmt.Errorf("BulkLoad error: table %s already holds rows, bulk loads fill empty tables", name)
+	}
+
+	load := &bulkLoad{d: d}
+	d.BeginOp()
+	rows, err := load.run(ti, src)
+	if err != nil {
+		if abortErr := d.AbortOp(); abortErr != nil {
+			err = fmt.Errorf("%w (abort error: %s)", err, abortErr.Error())
+		}
+	} else {
+		err = d.CommitOp()
+	}
+	if err != nil {
+		if freeErr := load.discard(); freeErr != nil {
+			err = fmt.Errorf("%w (free error: %s)", err, freeErr.Error())
+		}
+		return 0, fmt.Errorf("BulkLoad error: %w", err)
+	}
+	return rows, nil
+}
+
+// bulkLoad is a load in progress. Every commit marks its builders, what they had
+// written then is what a failed load frees.
+type bulkLoad struct {
+	d        *DiskManager
+	builders []builder
+}
+
+// builder writes a table from rows in ascending key order without linking it to
+// the database
+type builder interface {
+	add(key Key, val string) error
+	finish() (int32, error) // writes the pages still in memory and returns the root
+	mark()                  // saves the state of the builder, what it wrote is committed
+	marked() ([]int32, []DataNode)
+}
+
+// indexEntry is a row of a bulk load as an index sees it
+type indexEntry struct {
+	ik  Key // the index key of the value of the row, the key of its entry once sorted
+	key Key // the key of the row
+}
+
+func (l *bulkLoad) newBuilder(ti *TblInfo) builder {
+
+	var b builder
+	if ti.IsTree {
+		b = &treeBuilder{t: tree{table: l.d, info: ti}}
+	} else {
+		b = &listBuilder{d: l.d, info: ti}
+	}
+	l.builders = append(l.builders, b)
+	return b
+}
+
+// run writes the rows of src and the indexes of ti inside the open operation and sets
+// their roots, the caller commits or aborts what is left
+func (l *bulkLoad) run(ti *TblInfo, src RowSource) (int, error) {
+
+	base := l.newBuilder(ti)
+	entries := make([][]indexEntry, len(ti.TblIdx))
+	rows := 0
+	var last Key
+	for src.Next() {
+		key, val := src.Key(), src.Value()
+		if err := ti.checkKey(key); err != nil {
+			return 0, fmt.Errorf("row %d: %w", rows+1, err)
+		}
+		if last != nil {
+			switch cmp := CompareKeys(key, last); {
+			case cmp == 0:
+				return 0, fmt.Errorf("row %d: %w", rows+1, &DuplicateKeyError{Key: ti.FormatKey(key)})
+			case cmp < 0:
+				return 0, fmt.Errorf("row %d: key %s follows %s, rows have to be sorted by key", rows+1, ti.FormatKey(key), ti.FormatKey(last))
+			}
+		}
+		if err := base.add(key, val); err != nil {
+			return 0, err
+		}
+		if len(ti.TblIdx) > 0 {
+			row, err := ti.Row(key, val)
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %w", rows+1, err)
+			}
+			for i, idx := range ti.TblIdx {
+				if ik := indexKey(row[idx.IdxCol-1]); ik != nil {
+					entries[i] = append(entries[i], indexEntry{ik: ik, key: bytes.Clone(key)})
+				}
+			}
+		}
+		last = append(last[:0], key...)
+		rows++
+		if err := l.commit(true); err != nil {
+			return 0, err
+		}
+	}
+	if err := src.Err(); err != nil {
+		return 0, err
+	}
+
+	roots := make([]int32, 1+len(ti.TblIdx))
+	var err error
+	if roots[0], err = base.finish(); err != nil {
+		return 0, err
+	}
+	for i, idx := range ti.TblIdx {
+		if roots[i+1], err = l.buildIndex(idx, entries[i]); err != nil {
+			return 0, err
+		}
+		entries[i] = nil
+	}
+	// the first writes that link the new pages to the database, they replace the empty
+	// root page deletes leave behind
+	for i, info := range append([]*TblInfo{ti}, ti.TblIdx...) {
+		old := info.SrtOff
+		if err := l.d.setRootAddr(info, roots[i]); err != nil {
+			return 0, err
+		}
+		if old != 0 {
+			if err := l.d.DelDiskData(old); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return rows, nil
+}
+
+// isEmpty reports whether ti holds no rows. A table emptied by deletes keeps its root
+// page, a leaf or the only page of a list, with no keys left.
+func (d *DiskManager) isEmpty(ti *TblInfo) (bool, error) {
+
+	if ti.SrtOff == 0 {
+		return true, nil
+	}
+	dsk, err := d.GetDiskData(ti.SrtOff)
+	if err != nil {
+		return false, err
+	}
+	switch page := dsk.RecData.(type) {
+	case TreePage:
+		return page.Head.IsLeaf && IsNodesEmpty(page.Data), nil
+	case ListPage:
+		return page.Chld == -1 && IsNodesEmpty(page.Data), nil
+	}
+	return false, nil
+}
+
+// buildIndex writes the empty index idx from the entries of every row and returns its
+// root. Rows whose keys hash alike take the next free entry, as indexAdd gives them.
+func (l *bulkLoad) buildIndex(idx *TblInfo, entries []indexEntry) (int32, error) {
+
+	if empty, err := l.d.isEmpty(idx); err != nil {
+		return 0, fmt.Errorf("buildIndex error: %w", err)
+	} else if !empty {
+		return 0, fmt.Errorf("buildIndex error: the index on column %d of %s is not empty", idx.IdxCol-1, idx.TblNam)
+	}
+	for i := range entries {
+		entries[i].ik = entryKey(entries[i].ik, entries[i].key)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return CompareKeys(entries[i].ik, entries[j].ik) < 0 })
+	b := l.newBuilder(idx)
+	for i := range entries {
+		if i > 0 && CompareKeys(entries[i].ik, entries[i-1].ik) <= 0 {
+			if entries[i].ik = nextEntry(entries[i-1].ik); entries[i].ik == nil {
+				return 0, fmt.Errorf("buildIndex error: no free entry left for the hash of a key")
+			}
+		}
+		if err := b.add(entries[i].ik, string(entries[i].key)); err != nil {
+			return 0, fmt.Errorf("buildIndex error: %w", err)
+		}
+		if err := l.commit(true); err != nil {
+			return 0, fmt.Errorf("buildIndex error: %w", err)
+		}
+	}
+	root, err := b.finish()
+	if err != nil {
+		return 0, fmt.Errorf("buildIndex error: %w", err)
+	}
+	return root, nil
+}
+
+// commit makes the pending writes durable once there are BULK_LOAD_PAGES of them and
+// opens the next operation, which is left open for the caller to abort when the commit
+// fails. With mark the builders save what is committed.
+func (l *bulkLoad) commit(mark bool) error {
+
+	if len(l.d.PndPgs) < BULK_LOAD_PAGES {
+		return nil
+	}
+	err := l.d.CommitOp()
+	l.d.BeginOp()
+	if err != nil {
+		return err
+	}
+	if mark {
+		for _, b := range l.builders {
+			b.mark()
+		}
+	}
+	return nil
+}
+
+// discard frees the pages the builders had written when they were last marked. The
+// frees are committed as they go, what a failing discard leaves is orphaned.
+func (l *bulkLoad) discard() error {
+
+	var pages []int32
+	var nodes []DataNode
+	for _, b := range l.builders {
+		p, n := b.marked()
+		pages, nodes = append(pages, p...), append(nodes, n...)
+	}
+	if len(pages) == 0 && len(nodes) == 0 {
+		return nil
+	}
+	l.d.BeginOp()
+	err := func() error {
+		for _, node := range nodes {
+			if err := l.d.freeNode(node); err != nil {
+				return err
+			}
+		}
+		for _, addr := range pages {
+			if err := l.free(addr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		if abortErr := l.d.AbortOp(); abortErr != nil {
+			err = fmt.Errorf("%w (abort error: %s)", err, abortErr.Error())
+		}
+		return fmt.Errorf("discard error: %w", err)
+	}
+	if err := l.d.CommitOp(); err != nil {
+		return fmt.Errorf("discard error: %w", err)
+	}
+	return nil
+}
+
+// free releases the tree or the list starting at addr with the overflow chains of its
+// rows, 0 and -1 are no page
+func (l *bulkLoad) free(addr int32) error {
+
+	for addr > 0 {
+		dsk, err := l.d.GetDiskData(addr)
+		if err != nil {
+			return err
+		}
+		var nodes []DataNode
+		next := int32(0)
+		switch page := dsk.RecData.(type) {
+		case TreePage:
+			n := NumKeys(page.Data)
+			nodes = page.Data[:n]
+			if !page.Head.IsLeaf {
+				for _, chld := range page.Chld[:n+1] {
+					if err := l.free(chld); err != nil {
+						return err
+					}
+				}
+			}
+		case ListPage:
+			nodes, next = page.Data, page.Chld
+		default:
+			return fmt.Errorf("record %d is no table page", addr)
+		}
+		for _, node := range nodes {
+			if err := l.d.freeNode(node); err != nil {
+				return err
+			}
+		}
+		if err := l.d.DelDiskData(addr); err != nil {
+			return err
+		}
+		if err := l.commit(false); err != nil {
+			return err
+		}
+		addr = next
+	}
+	return nil
+}
+
+// treeBuilder writes a tree from rows in ascending key order. Every level fills one
+// page at a time, the leaves in memory and the pages above them in a record claimed
+// when their first child is written, so children are written with their parent in
+// place. A full page is written and the next row goes up a level as its separator.
+type treeBuilder struct {
+	t      tree
+	levels []*buildPage // the page being filled on every level, the leaf first
+	root   int32        // set by finish
+	saved  []buildPage  // levels as of the last mark, only the filled slots
+	sRoot  int32        // root as of the last mark
+}
+
+type buildPage struct {
+	addr int32 // record claimed for the page, 0 until then and for leaves
+	page TreePage
+	keys int
+	kids int
+}
+
+func (b *treeBuilder) add(key Key, val string) error {
+
+	node, err := b.t.table.newNode(key, val)
+	if err != nil {
+		return fmt.Errorf("treeBuilder error: %w", err)
+	}
+	if len(b.levels) == 0 {
+		b.levels = append(b.levels, &buildPage{page: b.t.table.NewTreePage()})
+	}
+	leaf := b.levels[0]
+	if leaf.keys < b.t.table.MaxKeys() {
+		leaf.page.Data[leaf.keys] = node
+		leaf.keys++
+		return nil
+	}
+	return b.complete(0, node)
+}
+
+// open returns the page being filled on level h, claiming a record for it
+func (b *treeBuilder) open(h int) (*buildPage, error) {
+
+	if h == len(b.levels) {
+		b.levels = append(b.levels, &buildPage{page: b.t.table.NewTreePage()})
+	}
+	lv := b.levels[h]
+	if lv.addr == 0 {
+		dsk, err := b.t.table.WrtDiskData(lv.page)
+		if err != nil {
+			return nil, err
+		}
+		lv.addr = dsk.RecHead.RecAddr
+	}
+	return lv, nil
+}
+
+// write stores the page of level h under parent, -1 for the root, and returns its address
+func (b *treeBuilder) write(h int, parent int32) (int32, error) {
+
+	lv := b.levels[h]
+	lv.page.Head = TreeHead{IsLeaf: h == 0, IsRoot: parent == -1, Parent: parent}
+	if h == 0 {
+		dsk, err := b.t.table.WrtDiskData(lv.page)
+		if err != nil {
+			return 0, err
+		}
+		return dsk.RecHead.RecAddr, nil
+	}
+	if err := b.t.edtPage(lv.addr, lv.page); err != nil {
+		return 0, err
+	}
+	return lv.addr, nil
+}
+
+// complete writes the full page of level h and hands it to the level above with sep,
+// the row that follows it
+func (b *treeBuilder) complete(h int, sep DataNode) error {
+
+	parent, err := b.open(h + 1)
+	if err != nil {
+		return fmt.Errorf("treeBuilder error: %w", err)
+	}
+	addr, err := b.write(h, parent.addr)
+	if err != nil {
+		return fmt.Errorf("treeBuilder error: %w", err)
+	}
+	b.levels[h] = &buildPage{page: b.t.table.NewTreePage()}
+
+	parent.page.Chld[parent.kids] = addr
+	parent.kids++
+	if parent.keys < b.t.table.MaxKeys() {
+		parent.page.Data[parent.keys] = sep
+		parent.keys++
+		return nil
+	}
+	return b.complete(h+1, sep)
+}
+
+// finish writes the pages still being filled, the last of every level, with the top
+// one as the root. Those pages can be short of MinKeys, each takes keys from its left
+// sibling from the root down.
+func (b *treeBuilder) finish() (int32, error) {
+
+	if len(b.levels) == 0 {
+		return 0, nil
+	}
+	for h := range b.levels {
+		if h == len(b.levels)-1 {
+			addr, err := b.write(h, -1)
+			if err != nil {
+				return 0, fmt.Errorf("treeBuilder error: %w", err)
+			}
+			b.root = addr
+			break
+		}
+		parent, err := b.open(h + 1)
+		if err != nil {
+			return 0, fmt.Errorf("treeBuilder error: %w", err)
+		}
+		addr, err := b.write(h, parent.addr)
+		if err != nil {
+			return 0, fmt.Errorf("treeBuilder error: %w", err)
+		}
+		parent.page.Chld[parent.kids] = addr
+		parent.kids++
+	}
+
+	for addr := b.root; ; {
+		page, err := b.t.getPage(addr)
+		if err != nil {
+			return 0, fmt.Errorf("treeBuilder error: %w", err)
+		}
+		if page.Head.IsLeaf {
+			return b.root, nil
+		}
+		n := NumKeys(page.Data)
+		last, left := page.Chld[n], page.Chld[n-1]
+		for {
+			child, err := b.t.getPage(last)
+			if err != nil {
+				return 0, fmt.Errorf("treeBuilder error: %w", err)
+			}
+			if NumKeys(child.Data) >= b.t.table.MinKeys() {
+				break
+			}
+			if err := b.t.BorrowLeaf(addr, int32(n), left, -1); err != nil {
+				return 0, fmt.Errorf("treeBuilder error: %w", err)
+			}
+		}
+		addr = last
+	}
+}
+
+func (b *treeBuilder) mark() {
+
+	b.saved, b.sRoot = b.saved[:0], b.root
+	for _, lv := range b.levels {
+		saved := *lv
+		saved.page.Data = slices.Clone(lv.page.Data[:lv.keys])
+		saved.page.Chld = slices.Clone(lv.page.Chld[:lv.kids])
+		b.saved = append(b.saved, saved)
+	}
+}
+
+// marked returns the pages written by the last mark that no other page points at and
+// the rows held in memory then, whose values may have overflow chains
+func (b *treeBuilder) marked() ([]int32, []DataNode) {
+
+	if b.sRoot != 0 {
+		return []int32{b.sRoot}, nil
+	}
+	var pages []int32
+	var nodes []DataNode
+	for _, lv := range b.saved {
+		pages = append(pages, lv.page.Chld...)
+		if lv.addr != 0 {
+			pages = append(pages, lv.addr)
+		}
+		nodes = append(nodes, lv.page.Data...)
+	}
+	return pages, nodes
+}
@@ -0,0 +1,307 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rowSlice is a RowSource over rows held in memory
+type rowSlice struct {
+	keys []Key
+	vals []string
+	at   int
+}
+
+func (r *rowSlice) Next() bool {
+	r.at++
+	return r.at <= len(r.keys)
+}
+
+func (r *rowSlice) Key() Key      { return r.keys[r.at-1] }
+func (r *rowSlice) Value() string { return r.vals[r.at-1] }
+func (r *rowSlice) Err() error    { return nil }
+
+// watchedRows records the most writes pending and pages cached in d while a load
+// reads its rows, with fail set it stops with an error after that many rows
+type watchedRows struct {
+	rowSlice
+	d       *DiskManager
+	fail    int
+	pending int
+	cached  int
+}
+
+func (w *watchedRows) Next() bool {
+
+	w.pending = max(w.pending, len(w.d.PndPgs))
+	w.cached = max(w.cached, w.d.CacheStats().Pages)
+	if w.fail > 0 && w.at == w.fail {
+		return false
+	}
+	return w.rowSlice.Next()
+}
+
+func (w *watchedRows) Err() error {
+	if w.fail > 0 && w.at == w.fail {
+		return errors.New("source failed")
+	}
+	return nil
+}
+
+func TestBulkLoad(t *testing.T) {
+
+	value := func(i int) string {
+		if i%13 == 0 {
+			return strings.Repeat("z", 100+i)
+		}
+		return fmt.Sprintf("v%d", i%5)
+	}
+	rows := func(n int) *rowSlice {
+		src := &rowSlice{}
+		for i := 0; i < n; i++ {
+			src.keys = append(src.keys, Int32Key(int32(i)))
+			src.vals = append(src.vals, value(i))
+		}
+		return src
+	}
+
+	// every count up to a few levels, so every shape of the right edge comes up
+	for _, order := range []int{3, 4, 5, 8} {
+		for _, n := range []int{0, 1, 2, 3, 7, 8, 9, 10, 26, 27, 28, 80, 81, 82, 200, 500} {
+			for _, typ := range []string{"tree", "list"} {
+				name := fmt.Sprintf("%s order %d, %d rows", typ, order, n)
+				path := filepath.Join(t.TempDir(), "app")
+				if err := CreateDatabaseAt(path, typ, order, KT_INT32); err != nil {
+					t.Fatal(err)
+				}
+				d, err := InitDatabaseAt(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := d.AddIndex("app", "value"); err != nil {
+					t.Fatal(err)
+				}
+				loaded, err := d.BulkLoad("app", rows(n))
+				if err != nil || loaded != n {
+					t.Fatalf("%s: loaded %d, %v", name, loaded, err)
+				}
+				report, err := d.IntegrityCheck()
+				if err != nil || !report.OK() || report.Rows != n {
+					t.Fatalf("%s: integrity check %+v, %v", name, report, err)
+				}
+
+				app, _ := InitTable(d, "app")
+				it, err := app.SelectAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				i := 0
+				for it.Next() {
+					if CompareKeys(it.Key(), Int32Key(int32(i))) != 0 || it.Value() != value(i) {
+						t.Fatalf("%s: row %d is %x", name, i, []byte(it.Key()))
+					}
+					i++
+				}
+				if it.Err() != nil || i != n {
+					t.Fatalf("%s: %d rows, %v", name, i, it.Err())
+				}
+				ti, _ := d.TableInfo("app")
+				v1, long := 0, 0
+				for i := 0; i < n; i++ {
+					switch {
+					case value(i) == "v1":
+						v1++
+					case i%13 == 0:
+						long++
+					}
+				}
+				if keys, err := d.IndexLookup(ti, 1, "v1", "v1"); err != nil || len(keys) != v1 {
+					t.Fatalf("%s: index lookup %d keys, %v", name, len(keys), err)
+				}
+				// the long values share one cut index key, their posting overflows
+				if keys, err := d.IndexLookup(ti, 1, value(0), value(0)); err != nil || len(keys) != long {
+					t.Fatalf("%s: index lookup of long values %d keys, want %d, %v", name, len(keys), long, err)
+				}
+				if keys, err := d.IndexLookup(ti, 1, nil, nil); err != nil || len(keys) != n {
+					t.Fatalf("%s: index scan %d keys, %v", name, len(keys), err)
+				}
+
+				// the loaded table takes writes like any other
+				for i := 0; i < n; i += 2 {
+					if err := app.Delete(Int32Key(int32(i))); err != nil {
+						t.Fatalf("%s: delete %d: %v", name, i, err)
+					}
+				}
+				if err := app.Insert(Int32Key(-1), "first"); err != nil {
+					t.Fatal(err)
+				}
+				if report, err := d.IntegrityCheck(); err != nil || !report.OK() {
+					t.Fatalf("%s: integrity check after writes %+v, %v", name, report, err)
+				}
+				d.Close()
+			}
+		}
+	}
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_STRING); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	src := &rowSlice{keys: []Key{Key("a"), Key("c"), Key("b")}, vals: []string{"1", "2", "3"}}
+	if _, err := d.BulkLoad("app", src); err == nil || !strings.Contains(err.Error(), "sorted") {
+		t.Fatalf("expected an error for rows out of order, got %v", err)
+	}
+	src = &rowSlice{keys: []Key{Key("a"), Key("b"), Key("b")}, vals: []string{"1", "2", "3"}}
+	if _, err := d.BulkLoad("app", src); !errors.As(err, new(*DuplicateKeyError)) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	}
+	// nothing of a failed load is left behind
+	if ti, _ := d.TableInfo("app"); ti.SrtOff != 0 {
+		t.Fatal("a failed load left rows in the table")
+	}
+	if report, err := d.IntegrityCheck(); err != nil || !report.OK() || report.Orphans != 0 {
+		t.Fatalf("integrity check after failed loads %+v, %v", report, err)
+	}
+
+	src = &rowSlice{keys: []Key{Key("a")}, vals: []string{"1"}}
+	if _, err := d.BulkLoad("app", src); err != nil {
+		t.Fatal(err)
+	}
+	src = &rowSlice{keys: []Key{Key("b")}, vals: []string{"1"}}
+	if _, err := d.BulkLoad("app", src); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Fatalf("expected an error loading a table with rows, got %v", err)
+	}
+}
+
+// TestBulkLoadEmptied loads tables whose rows were all deleted, what is left of them is
+// an empty root page the load replaces
+func TestBulkLoadEmptied(t *testing.T) {
+
+	for _, typ := range []string{"tree", "list"} {
+		path := filepath.Join(t.TempDir(), "app")
+		if err := CreateDatabaseAt(path, typ, 4, KT_INT32); err != nil {
+			t.Fatal(err)
+		}
+		d, err := InitDatabaseAt(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		if err := d.AddIndex("app", "value"); err != nil {
+			t.Fatal(err)
+		}
+		app, _ := InitTable(d, "app")
+		for i := 0; i < 20; i++ {
+			if err := app.Insert(Int32Key(int32(i)), "old"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 20; i++ {
+			if err := app.Delete(Int32Key(int32(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		src := &rowSlice{}
+		for i := 0; i < 50; i++ {
+			src.keys = append(src.keys, Int32Key(int32(i)))
+			src.vals = append(src.vals, "new")
+		}
+		if loaded, err := d.BulkLoad("app", src); err != nil || loaded != 50 {
+			t.Fatalf("%s: loaded %d, %v", typ, loaded, err)
+		}
+		report, err := d.IntegrityCheck()
+		if err != nil || !report.OK() || report.Rows != 50 || report.Orphans != 0 {
+			t.Fatalf("%s: integrity check %+v, %v", typ, report, err)
+		}
+	}
+}
+
+// TestBulkLoadChunks loads far more pages than the cache and a commit hold, the load
+// has to commit as it goes and a load failing late has to free all it wrote
+func TestBulkLoadChunks(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.AddIndex("app", "value"); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20000
+	rows := func(fail int) *watchedRows {
+		src := &watchedRows{d: d, fail: fail}
+		for i := 0; i < n; i++ {
+			src.keys = append(src.keys, Int32Key(int32(i)))
+			if i%13 == 0 {
+				src.vals = append(src.vals, strings.Repeat("z", 100+i%500))
+			} else {
+				src.vals = append(src.vals, fmt.Sprintf("v%d", i%50))
+			}
+		}
+		return src
+	}
+	// a row writes a few pages at most, one commit more than BULK_LOAD_PAGES
+	slack := 32
+
+	src := rows(n - 10)
+	if _, err := d.BulkLoad("app", src); err == nil || !strings.Contains(err.Error(), "source failed") {
+		t.Fatalf("expected the error of the source, got %v", err)
+	}
+	ti, _ := d.TableInfo("app")
+	if ti.SrtOff != 0 || ti.TblIdx[0].SrtOff != 0 {
+		t.Fatalf("a failed load left roots %d and %d", ti.SrtOff, ti.TblIdx[0].SrtOff)
+	}
+	report, err := d.IntegrityCheck()
+	if err != nil || !report.OK() || report.Orphans != 0 || report.Rows != 0 {
+		t.Fatalf("integrity check after a failed load %+v, %v", report, err)
+	}
+	written := int(d.EndOff) / d.diskDataSize()
+	if report.Free < written/2 {
+		t.Fatalf("%d records freed of %d written", report.Free, written)
+	}
+
+	src = rows(0)
+	loaded, err := d.BulkLoad("app", src)
+	if err != nil || loaded != n {
+		t.Fatalf("loaded %d, %v", loaded, err)
+	}
+	written = int(d.EndOff) / d.diskDataSize()
+	if written < 4*(PAGE_CACHE_SIZE+BULK_LOAD_PAGES) {
+		t.Fatalf("only %d records in the file, the load fits in one commit", written)
+	}
+	if src.pending > BULK_LOAD_PAGES+slack || src.cached > PAGE_CACHE_SIZE+BULK_LOAD_PAGES+slack {
+		t.Fatalf("up to %d writes pending and %d pages cached during the load", src.pending, src.cached)
+	}
+	report, err = d.IntegrityCheck()
+	if err != nil || !report.OK() || report.Rows != n || report.Orphans != 0 {
+		t.Fatalf("integrity check %+v, %v", report, err)
+	}
+	v7 := 0
+	for _, val := range src.vals {
+		if val == "v7" {
+			v7++
+		}
+	}
+	ti, _ = d.TableInfo("app")
+	if keys, err := d.IndexLookup(ti, 1, "v7", "v7"); err != nil || len(keys) != v7 {
+		t.Fatalf("index lookup %d keys, want %d, %v", len(keys), v7, err)
+	}
+}
@@ -0,0 +1,155 @@
+package diskmanager
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats is a snapshot of the page cache counters
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Pages     int
+	Capacity  int
+}
+
+// pageCache keeps recently used decoded pages keyed by record address. Pages written
+// inside an open operation are dirty, they are pinned until the operation commits and
+// the write-ahead log writes them back, or dropped when it aborts. Readers holding the
+// shared lock of the database all move pages around the lru list, so the cache has a
+// lock of its own.
+type pageCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[int32]*list.Element
+	lru      *list.List // front is the most recently used entry
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	data  DiskData
+	dirty bool
+}
+
+func newPageCache(capacity int) *pageCache {
+	return &pageCache{
+		capacity: capacity,
+		entries:  make(map[int32]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *pageCache) get(addr int32) (*DiskData, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[addr]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	data := cloneDiskData(elem.Value.(*cacheEntry).data)
+	return &data, true
+}
+
+func (c *pageCache) put(data *DiskData, dirty bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity <= 0 {
+		return
+	}
+	if elem, ok := c.entries[data.RecHead.RecAddr]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.data = cloneDiskData(*data)
+		entry.dirty = entry.dirty || dirty
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[data.RecHead.RecAddr] = c.lru.PushFront(&cacheEntry{data: cloneDiskData(*data), dirty: dirty})
+	c.evict()
+}
+
+// evict drops least recently used clean pages until the cache fits its capacity,
+// dirty pages may push it over until they are written back
+func (c *pageCache) evict() {
+
+	for elem := c.lru.Back(); elem != nil && c.lru.Len() > c.capacity; {
+		prev := elem.Prev()
+		entry := elem.Value.(*cacheEntry)
+		if !entry.dirty {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.data.RecHead.RecAddr)
+			c.stats.Evictions++
+		}
+		elem = prev
+	}
+}
+
+// markClean is called once the dirty pages have been written back
+func (c *pageCache) markClean() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		elem.Value.(*cacheEntry).dirty = false
+	}
+	c.evict()
+}
+
+// dropDirty forgets every dirty page, their next read goes back to the pending writes
+// or the file
+func (c *pageCache) dropDirty() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*cacheEntry)
+		if entry.dirty {
+			c.lru.Remove(elem)
+			delete(c.entries, entry.data.RecHead.RecAddr)
+		}
+		elem = next
+	}
+}
+
+func (c *pageCache) clear() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[int32]*list.Element)
+	c.lru.Init()
+}
+
+func (c *pageCache) resize(capacity int) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capacity = capacity
+	if capacity <= 0 {
+		c.entries = make(map[int32]*list.Element)
+		c.lru.Init()
+		return
+	}
+	c.evict()
+}
+
+// SetCacheSize changes how many clean pages the cache keeps, 0 disables caching
+func (d *DiskManager) SetCacheSize(pages int) {
+	d.PgCach.resize(pages)
+}
+
+// CacheStats returns the page cache hit, miss and eviction counters
+func (d *DiskManager) CacheStats() CacheStats {
+
+	d.PgCach.mu.Lock()
+	defer d.PgCach.mu.Unlock()
+	stats := d.PgCach.stats
+	stats.Pages = d.PgCach.lru.Len()
+	stats.Capacity = d.PgCach.capacity
+	return stats
+}
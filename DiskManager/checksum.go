@@ -0,0 +1,123 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var CRC_TABLE = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is what every CorruptPageError unwraps to
+var ErrCorrupt = errors.New("database file is corrupt")
+
+// CorruptPageError is a record whose bytes no longer match the checksum they were
+// written with, a torn write or a flipped bit
+type CorruptPageError struct {
+	Addr   int32
+	Stored uint32
+	Actual uint32
+}
+
+func (e *CorruptPageError) Error() string {
+	return fmt.Sprintf("page %d is corrupt: checksum %08x, stored %08x", e.Addr, e.Actual, e.Stored)
+}
+
+func (e *CorruptPageError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// sumRecord sets the checksum of a serialised record
+func sumRecord(buf []byte) {
+	BINARY_ORDER.PutUint32(buf[NOSUM_HEADER_SIZE:], 0)
+	BINARY_ORDER.PutUint32(buf[NOSUM_HEADER_SIZE:], crc32.Checksum(buf, CRC_TABLE))
+}
+
+// verifyRecord checks the checksum of the record read from addr
+func verifyRecord(buf []byte, addr int32) error {
+
+	if len(buf) < HEADER_SIZE {
+		return &CorruptPageError{Addr: addr}
+	}
+	stored := BINARY_ORDER.Uint32(buf[NOSUM_HEADER_SIZE:])
+	BINARY_ORDER.PutUint32(buf[NOSUM_HEADER_SIZE:], 0)
+	actual := crc32.Checksum(buf, CRC_TABLE)
+	BINARY_ORDER.PutUint32(buf[NOSUM_HEADER_SIZE:], stored)
+	if actual != stored {
+		return &CorruptPageError{Addr: addr, Stored: stored, Actual: actual}
+	}
+	return nil
+}
+
+// hdrSize is the size of the record headers of this file
+func (d *DiskManager) hdrSize() int {
+	if d.FilVer < 2 {
+		return BASELINE_REC_HEAD_SIZE
+	}
+	if d.ChkSum {
+		return HEADER_SIZE
+	}
+	return NOSUM_HEADER_SIZE
+}
+
+// encode serialises a record the way this file lays it out
+func (d *DiskManager) encode(data *DiskData) ([]byte, error) {
+	return encodeRecord(data, d.ChkSum)
+}
+
+// encodeRecord serialises a record, without the checksum unless sums is set. Files
+// from before FL_CHECKSUM have none.
+func encodeRecord(data *DiskData, sums bool) ([]byte, error) {
+
+	buf, err := SerializeDiskData(data)
+	if err != nil || sums {
+		return buf, err
+	}
+	return append(buf[:NOSUM_HEADER_SIZE:NOSUM_HEADER_SIZE], buf[HEADER_SIZE:]...), nil
+}
+
+// decode reads a record of this file from buf, its checksum has to match unless the
+// file was opened for salvage
+func (d *DiskManager) decode(buf []byte, addr int32) (*DiskData, error) {
+
+	if d.FilVer < 2 {
+		return decodeBaseline(buf)
+	}
+	if !d.ChkSum {
+		buf = withChecksum(buf)
+	} else if err := verifyRecord(buf, addr); err != nil && !d.Salvge {
+		return nil, err
+	}
+	return DeserializeDskData(buf, d.Fanout)
+}
+
+// decodeHead is decode for a record header alone, which has no checksum of its own
+func (d *DiskManager) decodeHead(buf []byte) (*DskDataHdr, error) {
+
+	if d.FilVer < 2 {
+		old := baselineRecHead{}
+		if err := binary.Read(bytes.NewReader(buf), BINARY_ORDER, &old); err != nil {
+			return nil, err
+		}
+		hdr := old.head()
+		return &hdr, nil
+	}
+	if !d.ChkSum {
+		buf = withChecksum(buf)
+	}
+	hdr := &DskDataHdr{}
+	if err := binary.Read(bytes.NewReader(buf), BINARY_ORDER, hdr); err != nil {
+		return nil, err
+	}
+	return hdr, nil
+}
+
+// withChecksum makes room for a zero checksum in a record of a file without them
+func withChecksum(buf []byte) []byte {
+	wide := make([]byte, 0, len(buf)+CHKSUM_SIZE)
+	wide = append(wide, buf[:NOSUM_HEADER_SIZE]...)
+	wide = append(wide, make([]byte, CHKSUM_SIZE)...)
+	return append(wide, buf[NOSUM_HEADER_SIZE:]...)
+}
@@ -0,0 +1,91 @@
+package diskmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, _ := InitTable(d, "app")
+	for i := int32(0); i < 20; i++ {
+		if err := table.Insert(Int32Key(i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	// flip a bit inside the first page written, the first record after the header
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := int64(TBL_HEAD_SIZE + HEADER_SIZE + TREE_HEAD_SIZE + 2)
+	b := make([]byte, 1)
+	if _, err := file.ReadAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0x10
+	if _, err := file.WriteAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	rows := func(d *DiskManager) (int, error) {
+		table, err := InitTable(d, "app")
+		if err != nil {
+			return 0, err
+		}
+		it, err := table.SelectAll()
+		if err != nil {
+			return 0, err
+		}
+		n := 0
+		for it.Next() {
+			n++
+		}
+		return n, it.Err()
+	}
+
+	d, err = InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rows(d)
+	d.Close()
+	var corrupt *CorruptPageError
+	if !errors.As(err, &corrupt) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected a corrupt page error, got %v", err)
+	}
+	if corrupt.Addr != int32(TBL_HEAD_SIZE) {
+		t.Fatalf("corrupt page at %d, want %d", corrupt.Addr, TBL_HEAD_SIZE)
+	}
+
+	// a salvage reads past the checksum and writes nothing
+	d, err = SalvageDatabaseAt(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	n, err := rows(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 {
+		t.Fatalf("salvaged %d rows, want 20", n)
+	}
+	table, _ = InitTable(d, "app")
+	if err := table.Insert(Int32Key(99), "value"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected a salvage to be read only, got %v", err)
+	}
+}
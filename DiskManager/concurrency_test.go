@@ -0,0 +1,218 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// run with go test -race, the assertions only catch lost or mixed up rows while the
+// race detector catches unsynchronised access
+func openTestTable(t *testing.T, dbtype string) (*DiskManager, Table) {
+
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "concurrent")
+	if err := CreateDatabaseAt(path, dbtype, 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	disk, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { disk.Close() })
+	// a small cache keeps readers evicting pages while writers dirty them
+	disk.SetCacheSize(8)
+	table, err := InitTable(disk, "concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return disk, table
+}
+
+func testValue(i int32) string {
+	// every fifth value spills into an overflow chain
+	if i%5 == 0 {
+		return fmt.Sprintf("long value %d %0100d", i, i)
+	}
+	return fmt.Sprintf("value %d", i)
+}
+
+func testConcurrentTable(t *testing.T, dbtype string) {
+
+	disk, tb := openTestTable(t, dbtype)
+	const preload, writers, readers, perWriter = 200, 4, 4, 60
+
+	for i := int32(0); i < preload; i++ {
+		if err := tb.Insert(Int32Key(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+readers+1)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int32) {
+			defer wg.Done()
+			base := int32(1000 + w*1000)
+			for i := int32(0); i < perWriter; i++ {
+				if err := tb.Insert(Int32Key(base+i), testValue(base+i)); err != nil {
+					errs <- fmt.Errorf("writer %d insert: %w", w, err)
+					return
+				}
+				if err := tb.Update(Int32Key(base+i), testValue(base+i)+" updated"); err != nil {
+					errs <- fmt.Errorf("writer %d update: %w", w, err)
+					return
+				}
+				// odd keys are deleted again, leaving the even ones behind
+				if i%2 == 1 {
+					if err := tb.Delete(Int32Key(base + i)); err != nil {
+						errs <- fmt.Errorf("writer %d delete: %w", w, err)
+						return
+					}
+				}
+			}
+		}(int32(w))
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int32) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				i := (r*37 + int32(n)*13) % preload
+				val, err := tb.Select(Int32Key(i))
+				if err != nil {
+					errs <- fmt.Errorf("reader %d select %d: %w", r, i, err)
+					return
+				}
+				if val != testValue(i) {
+					errs <- fmt.Errorf("reader %d select %d: got %q", r, i, val)
+					return
+				}
+				if n%10 != 0 {
+					continue
+				}
+				// the preloaded rows are never written, a scan over them is stable
+				it, err := tb.Scan(Int32Key(0), Int32Key(preload-1), r%2 == 1)
+				if err != nil {
+					errs <- fmt.Errorf("reader %d scan: %w", r, err)
+					return
+				}
+				rows := 0
+				for it.Next() {
+					rows++
+				}
+				if err := it.Err(); err != nil {
+					errs <- fmt.Errorf("reader %d scan: %w", r, err)
+					return
+				}
+				if rows != preload {
+					errs <- fmt.Errorf("reader %d scan: got %d rows, expected %d", r, rows, preload)
+					return
+				}
+			}
+		}(int32(r))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 20; n++ {
+			if _, _, err := disk.FreeSpace(); err != nil {
+				errs <- fmt.Errorf("free space: %w", err)
+				return
+			}
+			disk.CacheStats()
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	it, err := tb.SelectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prev Key
+	rows := 0
+	for it.Next() {
+		if prev != nil && CompareKeys(prev, it.Key()) >= 0 {
+			t.Fatalf("rows out of order at %s", disk.Tables()[0].FormatKey(it.Key()))
+		}
+		prev = it.Key()
+		rows++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := preload + writers*perWriter/2; rows != expected {
+		t.Fatalf("got %d rows, expected %d", rows, expected)
+	}
+	for w := int32(0); w < writers; w++ {
+		key := 1000 + w*1000 + 2
+		val, err := tb.Select(Int32Key(key))
+		if err != nil || val != testValue(key)+" updated" {
+			t.Fatalf("select %d: got %q, %v", key, val, err)
+		}
+		if _, err := tb.Select(Int32Key(key + 1)); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("select %d: expected key not found, got %v", key+1, err)
+		}
+	}
+}
+
+func TestConcurrentTree(t *testing.T) {
+	testConcurrentTable(t, "tree")
+}
+
+func TestConcurrentList(t *testing.T) {
+	testConcurrentTable(t, "list")
+}
+
+// a vacuum swaps the file under readers, they have to wait for it
+func TestConcurrentVacuum(t *testing.T) {
+
+	disk, tb := openTestTable(t, "tree")
+	for i := int32(0); i < 300; i++ {
+		if err := tb.Insert(Int32Key(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := int32(0); i < 300; i += 2 {
+			if err := tb.Delete(Int32Key(i)); err != nil {
+				errs <- fmt.Errorf("delete %d: %w", i, err)
+				return
+			}
+			if i%50 == 0 {
+				if _, err := disk.Vacuum(); err != nil {
+					errs <- fmt.Errorf("vacuum: %w", err)
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 300; n++ {
+			i := int32(n*7%150)*2 + 1
+			val, err := tb.Select(Int32Key(i))
+			if err != nil || val != testValue(i) {
+				errs <- fmt.Errorf("select %d: got %q, %v", i, val, err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
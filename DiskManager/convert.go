@@ -0,0 +1,233 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// SetTableType converts the table called name to a tree or a list table. Every row is
+// copied into pages of the new type, the pages of the old table are freed and the type
+// and root of the table are swapped in the same logged operation, so the file holds
+// either the old table or the new one. Indexes map values to keys and stay as they are.
+// It returns false when the table already has that type.
+func (d *DiskManager) SetTableType(name string, dbtype string) (bool, error) {
+
+	var isTree bool
+	switch dbtype {
+	case "tree":
+		isTree = true
+	case "list":
+		isTree = false
+	default:
+		return false, fmt.Errorf("SetTableType error: invalid table type")
+	}
+	if isTree && TreePageSize(d.Fanout) > d.PgSize {
+		return false, fmt.Errorf("SetTableType error: the pages of this database were sized for list tables before tables could be mixed, it cannot hold a tree table")
+	}
+
+	changed := false
+	err := loggedTable{disk: d}.logged(func() error {
+		ti := d.table(name)
+		if ti == nil {
+			return fmt.Errorf("no table %s in the database", name)
+		}
+		if ti.IsTree == isTree {
+			return nil
+		}
+		changed = true
+		pages, err := d.livePages(ti.SrtOff)
+		if err != nil {
+			return err
+		}
+		// the new table shares the slot of the old one, the roots it writes there stay
+		// pending with the rest of the operation
+		conv := &TblInfo{TblNam: ti.TblNam, IsTree: isTree, KeyTyp: ti.KeyTyp, DirAdr: ti.DirAdr, DirIdx: ti.DirIdx}
+		if err := d.copyRows(conv, pages); err != nil {
+			return err
+		}
+		for _, dsk := range pages {
+			if err := d.DelDiskData(dsk.RecHead.RecAddr); err != nil {
+				return err
+			}
+		}
+		return d.setTableType(ti, isTree, conv.SrtOff)
+	})
+	if err != nil {
+		return false, fmt.Errorf("SetTableType error: %w", err)
+	}
+	return changed, nil
+}
+
+// SetDatabaseType opens dbname, converts the table it was created with and closes it
+func SetDatabaseType(dbname string, dbtype string) (bool, error) {
+
+	d, err := InitDatabase(dbname)
+	if err != nil {
+		return false, err
+	}
+	changed, err := d.SetTableType(filepath.Base(d.FilObj.Name()), dbtype)
+	return changed, errors.Join(err, d.Close())
+}
+
+// copyRows inserts the rows held by pages, the pages of a table as livePages returns
+// them, into the empty table dst. Values are written anew, the overflow chains of the
+// old rows are among the pages.
+func (d *DiskManager) copyRows(dst *TblInfo, pages []*DiskData) error {
+
+	list := listBuilder{d: d, info: dst}
+	for _, dsk := range pages {
+		var nodes []DataNode
+		switch page := dsk.RecData.(type) {
+		case TreePage:
+			nodes = page.Data[:NumKeys(page.Data)]
+		case ListPage:
+			nodes = page.Data
+		}
+		for _, node := range nodes {
+			if IsNodeEmpty(node) {
+				continue
+			}
+			val, err := d.nodeVal(node)
+			if err != nil {
+				return fmt.Errorf("copyRows error: %w", err)
+			}
+			if dst.IsTree {
+				err = tree{table: d, info: dst}.Insert(node.key(), val)
+			} else {
+				err = list.add(node.key(), val)
+			}
+			if err != nil {
+				return fmt.Errorf("copyRows error: %w", err)
+			}
+		}
+	}
+	root, err := list.finish()
+	if err == nil && root != 0 {
+		err = d.setRootAddr(dst, root)
+	}
+	if err != nil {
+		return fmt.Errorf("copyRows error: %w", err)
+	}
+	return nil
+}
+
+// listBuilder writes the rows of a new list table page after page, without the
+// duplicate search of Insert which reads the whole list for every row. The caller
+// makes the first page the root of the table.
+type listBuilder struct {
+	d      *DiskManager
+	info   *TblInfo
+	page   ListPage
+	used   int        // slots of page filled
+	first  int32      // page written first, 0 before it
+	last   int32      // page written last, 0 before the first
+	saved  []DataNode // filled slots as of the last mark
+	sFirst int32      // first page as of the last mark
+}
+
+func (b *listBuilder) add(key Key, val string) error {
+
+	node, err := b.d.newNode(key, val)
+	if err != nil {
+		return err
+	}
+	if b.used == 0 {
+		b.page = b.d.NewListPage()
+	}
+	b.page.Data[b.used] = node
+	b.used++
+	if b.used == len(b.page.Data) {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush writes the page being filled and links it behind the one before it
+func (b *listBuilder) flush() error {
+
+	if b.used == 0 {
+		return nil
+	}
+	b.page.Head.Parent = -1
+	if b.last != 0 {
+		b.page.Head.Parent = b.last
+	}
+	b.page.Chld = -1
+	dsk, err := b.d.WrtDiskData(b.page)
+	if err != nil {
+		return err
+	}
+	addr := dsk.RecHead.RecAddr
+	if b.last == 0 {
+		b.first = addr
+	} else {
+		prev, err := b.d.GetDiskData(b.last)
+		if err != nil {
+			return err
+		}
+		page := prev.RecData.(ListPage)
+		page.Chld = addr
+		if err := b.d.EdtDiskData(b.last, page); err != nil {
+			return err
+		}
+	}
+	b.last, b.used = addr, 0
+	return nil
+}
+
+// finish writes the page being filled and returns the first page
+func (b *listBuilder) finish() (int32, error) {
+
+	if err := b.flush(); err != nil {
+		return 0, err
+	}
+	return b.first, nil
+}
+
+func (b *listBuilder) mark() {
+	b.saved, b.sFirst = slices.Clone(b.page.Data[:b.used]), b.first
+}
+
+// marked returns the first page written by the last mark and the rows held in memory
+// then, whose values may have overflow chains
+func (b *listBuilder) marked() ([]int32, []DataNode) {
+
+	if b.sFirst == 0 {
+		return nil, b.saved
+	}
+	return []int32{b.sFirst}, b.saved
+}
+
+// setTableType stores the type and root of a table, in the file header or in its
+// directory entry
+func (d *DiskManager) setTableType(ti *TblInfo, isTree bool, root int32) error {
+
+	if ti.DirAdr == 0 {
+		head, err := d.GetDBHeader()
+		if err != nil {
+			return fmt.Errorf("setTableType error: %w", err)
+		}
+		head.IsLinear, head.RootAddr = !isTree, root
+		// an older file sizes its records after the type of this table, keep the size
+		if d.PgSize == TreePageSize(d.Fanout) {
+			head.Flags |= FL_TREE_SIZED
+		}
+		if err := d.WrtDBHeader(*head); err != nil {
+			return fmt.Errorf("setTableType error: %w", err)
+		}
+	} else {
+		page, err := d.getDirPage(ti.DirAdr)
+		if err != nil {
+			return fmt.Errorf("setTableType error: %w", err)
+		}
+		page.Ents[ti.DirIdx].IsLinear, page.Ents[ti.DirIdx].RootAddr = !isTree, root
+		if err := d.EdtDiskData(ti.DirAdr, page); err != nil {
+			return fmt.Errorf("setTableType error: %w", err)
+		}
+	}
+	ti.IsTree, ti.SrtOff = isTree, root
+	d.ChgCnt++
+	return nil
+}
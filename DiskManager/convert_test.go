@@ -0,0 +1,115 @@
+package diskmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetTableType(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "list", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddTable("users", "tree", KT_STRING, nil); err != nil {
+		t.Fatal(err)
+	}
+	app, _ := InitTable(d, "app")
+	users, _ := InitTable(d, "users")
+	want := map[int32]string{}
+	for i := int32(0); i < 50; i++ {
+		// some values need an overflow chain
+		val := fmt.Sprintf("v%d", i%7)
+		if i%9 == 0 {
+			val = strings.Repeat("y", 300)
+		}
+		want[i] = val
+		if err := app.Insert(Int32Key(i*7%50), val); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Insert(Key(fmt.Sprintf("u%02d", i)), val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddIndex("app", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(d *DiskManager, isTree bool) {
+		t.Helper()
+		ti, _ := d.TableInfo("app")
+		if ti.IsTree != isTree {
+			t.Fatalf("app is a tree: %v, want %v", ti.IsTree, isTree)
+		}
+		app, _ := InitTable(d, "app")
+		it, err := app.SelectAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := int32(0)
+		for it.Next() {
+			if CompareKeys(it.Key(), Int32Key(n)) != 0 || it.Value() != want[n*43%50] {
+				t.Fatalf("row %d: key %x, %d byte value", n, []byte(it.Key()), len(it.Value()))
+			}
+			n++
+		}
+		if it.Err() != nil || n != 50 {
+			t.Fatalf("%d rows, %v", n, it.Err())
+		}
+		if keys, err := d.IndexLookup(ti, 1, "v3", "v3"); err != nil || len(keys) != 6 {
+			t.Fatalf("index lookup: %d keys, %v", len(keys), err)
+		}
+		report, err := d.IntegrityCheck()
+		if err != nil || !report.OK() {
+			t.Fatalf("integrity check: %v, %v", report, err)
+		}
+		if report.Rows != 100 {
+			t.Fatalf("%d rows in the file, want 100", report.Rows)
+		}
+	}
+	check(d, false)
+
+	// the table handle from before the conversion keeps working
+	if changed, err := d.SetTableType("app", "tree"); err != nil || !changed {
+		t.Fatalf("list to tree: %v, %v", changed, err)
+	}
+	if val, err := app.Select(Int32Key(0)); err != nil || val != want[0] {
+		t.Fatalf("select through the old handle: %d bytes, %v", len(val), err)
+	}
+	check(d, true)
+	if changed, err := d.SetTableType("app", "tree"); err != nil || changed {
+		t.Fatalf("tree to tree: %v, %v", changed, err)
+	}
+	if changed, err := d.SetTableType("users", "list"); err != nil || !changed {
+		t.Fatalf("users to list: %v, %v", changed, err)
+	}
+	if changed, err := d.SetTableType("app", "list"); err != nil || !changed {
+		t.Fatalf("tree to list: %v, %v", changed, err)
+	}
+	check(d, false)
+	if changed, err := d.SetTableType("app", "tree"); err != nil || !changed {
+		t.Fatalf("list to tree again: %v, %v", changed, err)
+	}
+	d.Close()
+
+	d, err = InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	check(d, true)
+	ti, _ := d.TableInfo("users")
+	if ti.IsTree {
+		t.Fatal("users is a tree again after reopening")
+	}
+	users, _ = InitTable(d, "users")
+	if val, err := users.Select(Key("u18")); err != nil || val != want[18] {
+		t.Fatalf("users after reopening: %d bytes, %v", len(val), err)
+	}
+}
@@ -1,17 +1,22 @@
 package diskmanager
 
 import (
-	"bytes"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
-	"sync"
+	"time"
 )
 
-func CreateDatabase(dbname string, dbtype string) error {
+// order is the fanout of every page in the new database, 0 picks TREE_ORDER. keyType
+// is one of the KT_ constants.
+func CreateDatabase(dbname string, dbtype string, order int, keyType int8) error {
+	return CreateDatabaseAt(DB_FOLDER+"/"+dbname, dbtype, order, keyType)
+}
+
+// CreateDatabaseAt is CreateDatabase for a file outside DB_FOLDER
+func CreateDatabaseAt(dbFile string, dbtype string, order int, keyType int8) error {
 
-	dbFile := DB_FOLDER + "/" + dbname
 	found, err := DBExists(dbFile)
 	if found {
 		return fmt.Errorf("CreateDatabase error: database already exists")
@@ -19,17 +24,25 @@ func CreateDatabase(dbname string, dbtype string) error {
 	if err != nil {
 		return fmt.Errorf("CreateDatabase error: %w", err)
 	}
-	file, err := os.OpenFile(dbFile, os.O_CREATE|os.O_RDWR, 0666)
-	if err != nil {
-		return fmt.Errorf("CreateDatabase error, create file error: %w", err)
+	if order == 0 {
+		order = TREE_ORDER
+	}
+	if order < MIN_TREE_ORDER || order > MAX_TREE_ORDER {
+		return fmt.Errorf("CreateDatabase error: order must be between %d and %d got %d",
+			MIN_TREE_ORDER, MAX_TREE_ORDER, order)
+	}
+	if keyType < KT_INT32 || keyType > KT_BYTES {
+		return fmt.Errorf("CreateDatabase error: invalid key type %d", keyType)
 	}
-	defer file.Close()
-
-	buf := new(bytes.Buffer)
 
 	tblHead := TableHeader{
-		RootAddr: int32(TBL_HEAD_SIZE),
+		Version:   FORMAT_VERSION,
+		PageSize:  int32(TreePageSize(order)),
+		TreeOrder: int32(order),
+		KeyType:   keyType,
+		Flags:     FL_TREE_SIZED | FL_CHECKSUM,
 	}
+	copy(tblHead.Magic[:], FILE_MAGIC)
 	switch dbtype {
 	case "tree":
 		tblHead.IsLinear = false
@@ -39,12 +52,18 @@ func CreateDatabase(dbname string, dbtype string) error {
 		return fmt.Errorf("CreateDatabase error: invalid table type")
 	}
 
-	err = binary.Write(buf, BINARY_ORDER, tblHead)
+	file, err := os.OpenFile(dbFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("CreateDatabase error, create file error: %w", err)
+	}
+	defer file.Close()
+
+	buf, err := encodeHeader(tblHead)
 	if err != nil {
 		return fmt.Errorf("CreateDatabase error, header to bytes failed: %w", err)
 	}
 
-	_, err = file.WriteAt(buf.Bytes(), 0)
+	_, err = file.WriteAt(buf, 0)
 	if err != nil {
 		return fmt.Errorf("CreateDatabase error, write header failed: %w", err)
 	}
@@ -55,17 +74,54 @@ func CreateDatabase(dbname string, dbtype string) error {
 func DropDatabase(dbname string) error {
 
 	dbFile := DB_FOLDER + "/" + dbname
-	err := os.Remove(dbFile)
+	// never pull a database out from under another process that has it open
+	wal, err := os.OpenFile(dbFile+WAL_SUFFIX, os.O_RDWR, 0666)
+	if err == nil {
+		defer wal.Close()
+		if err := lockDatabase(wal, true, BUSY_TIMEOUT); err != nil {
+			return fmt.Errorf("dropdb error: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("dropdb error: opening log file '%w': %s", err, dbname)
+	}
+	err = os.Remove(dbFile)
 	if err != nil {
 		return fmt.Errorf("dropdb error: deleting file '%w': %s", err, dbname)
 
 	}
+	err = os.Remove(dbFile + WAL_SUFFIX)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("dropdb error: deleting log file '%w': %s", err, dbname)
+	}
 	return nil
 }
 
 func InitDatabase(dbname string) (*DiskManager, error) {
+	return InitDatabaseAt(DB_FOLDER + "/" + dbname)
+}
+
+// InitDatabaseAt is InitDatabase for a file outside DB_FOLDER
+func InitDatabaseAt(dbFile string) (*DiskManager, error) {
+	return OpenDatabaseAt(dbFile, false, BUSY_TIMEOUT)
+}
+
+// OpenDatabaseAt opens dbFile under an advisory lock that keeps other processes from
+// writing it while the DiskManager is open. A read only database shares the lock with
+// other readers, otherwise it is held exclusively. When another process holds it the
+// open is retried for up to busyTimeout before it fails with ErrLocked.
+func OpenDatabaseAt(dbFile string, readOnly bool, busyTimeout time.Duration) (*DiskManager, error) {
+	return openDatabase(dbFile, readOnly, false, busyTimeout)
+}
+
+// SalvageDatabaseAt opens a damaged dbFile read only to get out what can still be read.
+// Pages failing their checksum are decoded anyway instead of returning a
+// *CorruptPageError, and whatever the log holds is left alone.
+func SalvageDatabaseAt(dbFile string, busyTimeout time.Duration) (*DiskManager, error) {
+	return openDatabase(dbFile, true, true, busyTimeout)
+}
+
+func openDatabase(dbFile string, readOnly bool, salvage bool, busyTimeout time.Duration) (*DiskManager, error) {
 
-	dbFile := DB_FOLDER + "/" + dbname
 	found, err := DBExists(dbFile)
 	if !found {
 		return nil, fmt.Errorf("InitDatabase error: database does not exists")
@@ -74,51 +130,131 @@ func InitDatabase(dbname string) (*DiskManager, error) {
 		return nil, fmt.Errorf("InitDatabase error: %w", err)
 	}
 
-	file, err := os.OpenFile(dbFile, os.O_CREATE|os.O_RDWR, 0666)
+	// a reader never creates the log, without one there is nothing to recover
+	walFlag := os.O_CREATE | os.O_RDWR
+	if readOnly {
+		walFlag = os.O_RDONLY
+	}
+	wal, err := os.OpenFile(dbFile+WAL_SUFFIX, walFlag, 0666)
+	if readOnly && errors.Is(err, os.ErrNotExist) {
+		wal, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("InitDatabase error, open log error: %w", err)
+	}
+	closeWal := func() {
+		if wal != nil {
+			wal.Close()
+		}
+	}
+	if wal != nil {
+		if err := lockDatabase(wal, !readOnly, busyTimeout); err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("InitDatabase error: %w", err)
+		}
+	}
+	// the database file is only opened under the lock, a vacuum that ran while this
+	// open waited has replaced it
+	flag := os.O_RDWR
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(dbFile, flag, 0666)
 	if err != nil {
-		return nil, fmt.Errorf("InitDatabase error, create file error: %w", err)
+		closeWal()
+		return nil, fmt.Errorf("InitDatabase error, open file error: %w", err)
+	}
+	closeFiles := func() {
+		file.Close()
+		closeWal()
+	}
+	// a reader without a log is only kept apart from writers by the lock on the file
+	if wal == nil || !readOnly {
+		if err := lockDatabase(file, !readOnly, busyTimeout); err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("InitDatabase error: %w", err)
+		}
+	}
+
+	// finish or discard whatever the previous process left in the write-ahead log, a
+	// salvage never writes and reads the file as it is
+	if readOnly && !salvage && wal != nil {
+		info, err := wal.Stat()
+		if err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("InitDatabase error: %w", err)
+		}
+		if info.Size() != 0 {
+			closeFiles()
+			return nil, fmt.Errorf("InitDatabase error: the log holds writes of an interrupted operation, open the database read write once to recover them")
+		}
+	} else if !readOnly {
+		if err := recoverWal(file, wal); err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("InitDatabase error: %w", err)
+		}
 	}
 
 	info, err := file.Stat()
 	if err != nil {
+		closeFiles()
 		return nil, fmt.Errorf("InitDiskManager error: %w", err)
 	}
 	size := info.Size()
 
-	buf := make([]byte, TBL_HEAD_SIZE)
-
-	_, err = file.ReadAt(buf, 0)
-	if err != nil {
-		return nil, fmt.Errorf("InitDatabase error, read file error: %w", err)
-	}
-
-	reader := bytes.NewReader(buf)
-	th := &TableHeader{}
-	err = binary.Read(reader, BINARY_ORDER, th)
+	// unknown versions and files that are no database are refused here
+	th, err := readHeader(file)
 	if err != nil {
+		closeFiles()
 		return nil, fmt.Errorf("InitDatabase error, header decode error: %w", err)
 	}
 
 	dskMan := &DiskManager{
 		FilObj: file,
-		SrtOff: th.RootAddr,
-		Cursor: th.RootAddr,
 		EndOff: int32(size),
-		IsTree: !th.IsLinear,
-		MuLock: sync.Mutex{},
+		Fanout: th.fanout(),
+		PgSize: int(th.PageSize),
+		WalObj: wal,
+		PgCach: newPageCache(PAGE_CACHE_SIZE),
+		RdOnly: readOnly,
+		FilVer: th.Version,
+		ChkSum: th.Flags&FL_CHECKSUM != 0,
+		Salvge: salvage,
+	}
+	if err := dskMan.loadTables(); err != nil {
+		closeFiles()
+		return nil, fmt.Errorf("InitDatabase error: %w", err)
 	}
 	return dskMan, nil
 }
 
-func (d *DiskManager) WrtDBHeader(head TableHeader) error {
+// Close releases the database file and its log. Writes of an operation or transaction
+// still open are dropped, they never reached the file.
+func (d *DiskManager) Close() error {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	d.OpSavs = nil
+	d.PndPgs = nil
+	d.InTrxn = false
+	d.PgCach.clear()
+	err := d.FilObj.Close()
+	if d.WalObj != nil {
+		err = errors.Join(err, d.WalObj.Close())
+	}
+	if err != nil {
+		return fmt.Errorf("Close error: %w", err)
+	}
+	return nil
+}
 
-	buf := new(bytes.Buffer)
+func (d *DiskManager) WrtDBHeader(head TableHeader) error {
 
-	err := binary.Write(buf, BINARY_ORDER, head)
+	buf, err := encodeHeader(head)
 	if err != nil {
 		return fmt.Errorf("WrtDiskHeader error: %s", err.Error())
 	}
-	_, err = d.FilObj.WriteAt(buf.Bytes(), 0)
+	_, err = d.writeAt(buf, 0)
 	if err != nil {
 		return fmt.Errorf("WrtDiskHeader error: %s", err.Error())
 	}
@@ -127,35 +263,93 @@ func (d *DiskManager) WrtDBHeader(head TableHeader) error {
 
 func (d *DiskManager) GetDBHeader() (*TableHeader, error) {
 
-	buf := make([]byte, TBL_HEAD_SIZE)
+	buf := make([]byte, d.headSize())
 
-	n, err := d.FilObj.ReadAt(buf, 0)
+	n, err := d.readAt(buf, 0)
 	if err != nil {
 		return nil, fmt.Errorf("GetDiskHeader error: %w", err)
 	}
-	if n != TBL_HEAD_SIZE {
+	if n != len(buf) {
 		return nil, fmt.Errorf("GetDiskHeader error: invalid table head size in file")
 	}
 
-	var head *TableHeader = &TableHeader{}
-	reader := bytes.NewReader(buf)
-	err = binary.Read(reader, BINARY_ORDER, head)
+	var head *TableHeader
+	if d.FilVer < 2 {
+		head, err = decodeBaselineHeader(buf, int64(d.EndOff))
+	} else {
+		head, err = decodeHeader(buf)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("GetDiskHeader error: %w", err)
 	}
 	return head, nil
 }
 
-func (d *DiskManager) GetDiskData() (*DiskData, error) {
-
-	var buf []byte
-	if d.IsTree {
-		buf = make([]byte, TREE_DISKDATA_SIZE)
+// setRootAddr moves the root of a table, in the file header or in its directory entry
+func (d *DiskManager) setRootAddr(ti *TblInfo, addr int32) error {
+
+	if ti.DirAdr == 0 {
+		head, err := d.GetDBHeader()
+		if err != nil {
+			return fmt.Errorf("setRootAddr error: %w", err)
+		}
+		head.RootAddr = addr
+		err = d.WrtDBHeader(*head)
+		if err != nil {
+			return fmt.Errorf("setRootAddr error: %w", err)
+		}
 	} else {
-		buf = make([]byte, LINEAR_DISKDATA_SIZE)
+		page, err := d.getDirPage(ti.DirAdr)
+		if err != nil {
+			return fmt.Errorf("setRootAddr error: %w", err)
+		}
+		page.Ents[ti.DirIdx].RootAddr = addr
+		err = d.EdtDiskData(ti.DirAdr, page)
+		if err != nil {
+			return fmt.Errorf("setRootAddr error: %w", err)
+		}
+	}
+	ti.SrtOff = addr
+	return nil
+}
+
+// getRecHead decodes only the record header stored at addr
+func (d *DiskManager) getRecHead(addr int32) (*DskDataHdr, error) {
+
+	buf := make([]byte, d.hdrSize())
+	_, err := d.readAt(buf, addr)
+	if err != nil {
+		return nil, fmt.Errorf("getRecHead error: %w", err)
 	}
-	// fmt.Println(d.Cursor)
-	n, err := d.FilObj.ReadAt(buf, int64(d.Cursor))
+	hdr, err := d.decodeHead(buf)
+	if err != nil {
+		return nil, fmt.Errorf("getRecHead error: %w", err)
+	}
+	return hdr, nil
+}
+
+// FreeSpace reports how many deleted records wait on the free list and the bytes they occupy
+func (d *DiskManager) FreeSpace() (int32, int64, error) {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return 0, 0, fmt.Errorf("FreeSpace error: %w", err)
+	}
+	return head.FreeCount, int64(head.FreeCount) * int64(d.diskDataSize()), nil
+}
+
+// GetDiskData reads the record stored at addr, a record failing its checksum is a
+// *CorruptPageError
+func (d *DiskManager) GetDiskData(addr int32) (*DiskData, error) {
+
+	if cached, ok := d.PgCach.get(addr); ok {
+		return cached, nil
+	}
+
+	buf := make([]byte, d.hdrSize()+d.PgSize)
+	n, err := d.readAt(buf, addr)
 	if err != nil {
 		return nil, fmt.Errorf("GetDiskData error, read error: %w", err)
 	}
@@ -163,10 +357,12 @@ func (d *DiskManager) GetDiskData() (*DiskData, error) {
 		return nil, fmt.Errorf("GetDiskData error, invalid length read: expected len %d got %d", len(buf), n)
 	}
 
-	data, err := DeserializeDskData(buf)
+	data, err := d.decode(buf, addr)
 	if err != nil {
-		return nil, fmt.Errorf("GetDiskData error, deserialization error: %w", err)
+		return nil, fmt.Errorf("GetDiskData error: %w", err)
 	}
+	_, pending := d.PndPgs[addr]
+	d.PgCach.put(data, pending)
 	return data, nil
 }
 
@@ -187,33 +383,62 @@ func (d *DiskManager) WrtDiskData(data interface{}) (*DiskData, error) {
 	switch reflect.TypeOf(data) {
 	case reflect.TypeOf(TreePage{}):
 		dskData.RecHead.RecType = DT_TREE_PAGE
-		dskData.RecHead.RecSize = int32(TREE_PAGE_SIZE)
 	case reflect.TypeOf(ListPage{}):
 		dskData.RecHead.RecType = DT_LIST_PAGE
-		dskData.RecHead.RecSize = int32(LINEAR_PAGE_SIZE)
+	case reflect.TypeOf(OvflPage{}):
+		dskData.RecHead.RecType = DT_OVFL_PAGE
+	case reflect.TypeOf(DirPage{}):
+		dskData.RecHead.RecType = DT_DIR_PAGE
 	default:
 		return nil, fmt.Errorf("WrtDiskData error: data type %T not supported", data)
 	}
+	dskData.RecHead.RecSize = int32(d.PgSize)
+	if err := d.checkPage(data); err != nil {
+		return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
+	}
 
-	buf, err := SerializeDiskData(dskData)
+	// reuse the head of the free list before growing the file
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
+	}
+	reused := false
+	if head.FreeHead != 0 {
+		freeHdr, err := d.getRecHead(head.FreeHead)
+		if err != nil {
+			return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
+		}
+		// every record of a database has the same size, any type can take the slot
+		if freeHdr.Deleted {
+			dskData.RecHead.RecAddr = head.FreeHead
+			head.FreeHead = freeHdr.NxtFree
+			head.FreeCount--
+			reused = true
+		}
+	}
+
+	buf, err := d.encode(dskData)
 	if err != nil {
 		return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
 	}
-	_, err = d.FilObj.WriteAt(buf, int64(dskData.RecHead.RecAddr))
+	_, err = d.writeAt(buf, dskData.RecHead.RecAddr)
 	if err != nil {
 		return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
 	}
-	switch dskData.RecHead.RecType {
-	case DT_LIST_PAGE:
-		d.EndOff += int32(LINEAR_DISKDATA_SIZE)
-	case DT_TREE_PAGE:
-		d.EndOff += int32(TREE_DISKDATA_SIZE)
+	d.PgCach.put(dskData, len(d.OpSavs) > 0)
+	if reused {
+		err = d.WrtDBHeader(*head)
+		if err != nil {
+			return nil, fmt.Errorf("WrtDiskData error: %s", err.Error())
+		}
+		return dskData, nil
 	}
+	d.EndOff += int32(d.diskDataSize())
 	return dskData, nil
 }
 
-// assume that cursor is set before
-func (d *DiskManager) EdtDiskData(data interface{}) error {
+// EdtDiskData overwrites the live record at addr with a page of the same type
+func (d *DiskManager) EdtDiskData(addr int32, data interface{}) error {
 
 	if data == nil {
 		return fmt.Errorf("EditDiskData error: input cannot be nil")
@@ -222,7 +447,7 @@ func (d *DiskManager) EdtDiskData(data interface{}) error {
 	dskData := &DiskData{
 		RecHead: DskDataHdr{
 			Deleted: false,
-			RecAddr: d.Cursor,
+			RecAddr: addr,
 		},
 		RecData: data,
 	}
@@ -230,81 +455,97 @@ func (d *DiskManager) EdtDiskData(data interface{}) error {
 	switch reflect.TypeOf(data) {
 	case reflect.TypeOf(TreePage{}):
 		dskData.RecHead.RecType = DT_TREE_PAGE
-		dskData.RecHead.RecSize = int32(TREE_PAGE_SIZE)
 	case reflect.TypeOf(ListPage{}):
 		dskData.RecHead.RecType = DT_LIST_PAGE
-		dskData.RecHead.RecSize = int32(LINEAR_PAGE_SIZE)
+	case reflect.TypeOf(DirPage{}):
+		dskData.RecHead.RecType = DT_DIR_PAGE
 	default:
 		return fmt.Errorf("EdtDiskData error: data type %T not supported", data)
 	}
-
-	buf := make([]byte, HEADER_SIZE)
-	_, err := d.FilObj.ReadAt(buf, int64(d.Cursor))
-	if err != nil {
+	dskData.RecHead.RecSize = int32(d.PgSize)
+	if err := d.checkPage(data); err != nil {
 		return fmt.Errorf("EdtDiskData error: %s", err.Error())
 	}
 
-	reader := bytes.NewReader(buf)
-	hdr := &DskDataHdr{}
-	if err := binary.Read(reader, BINARY_ORDER, hdr); err != nil {
+	hdr, err := d.getRecHead(addr)
+	if err != nil {
 		return fmt.Errorf("EdtDiskData error: %s", err.Error())
 	}
+	if hdr.Deleted {
+		return fmt.Errorf("EdtDiskData error: record %d is deleted", addr)
+	}
 
 	if hdr.RecType != dskData.RecHead.RecType {
 		return fmt.Errorf("EdtDiskData error, incompatible data type: expected %d given %d",
 			hdr.RecType, dskData.RecHead.RecType)
 	}
 
-	buf, err = SerializeDiskData(dskData)
+	buf, err := d.encode(dskData)
 	if err != nil {
 		return fmt.Errorf("EdtDiskData error: %s", err.Error())
 	}
 
-	_, err = d.FilObj.WriteAt(buf, int64(d.Cursor))
+	_, err = d.writeAt(buf, addr)
 	if err != nil {
 		return fmt.Errorf("EdtDiskData error: %s", err.Error())
 	}
+	d.PgCach.put(dskData, len(d.OpSavs) > 0)
 
 	return nil
 
 }
 
-func (d *DiskManager) DelDiskData() error {
+// DelDiskData marks the record at addr as deleted and pushes it onto the free list
+func (d *DiskManager) DelDiskData(addr int32) error {
 
-	buf := make([]byte, HEADER_SIZE)
-	_, err := d.FilObj.ReadAt(buf, int64(d.Cursor))
+	hdr, err := d.getRecHead(addr)
 	if err != nil {
 		return fmt.Errorf("DelDiskData error, reading full record for deletion: %w", err)
 	}
-
-	reader := bytes.NewReader(buf)
-	hdr := &DskDataHdr{}
-	if err := binary.Read(reader, BINARY_ORDER, hdr); err != nil {
-		return fmt.Errorf("DelDiskData error: %s", err.Error())
+	if hdr.Deleted {
+		return fmt.Errorf("DelDiskData error: record %d is already deleted", addr)
 	}
 
+	var buf []byte
 	switch hdr.RecType {
-	case DT_LIST_PAGE:
-		buf = make([]byte, LINEAR_DISKDATA_SIZE)
-	case DT_TREE_PAGE:
-		buf = make([]byte, TREE_DISKDATA_SIZE)
+	case DT_LIST_PAGE, DT_TREE_PAGE, DT_OVFL_PAGE, DT_DIR_PAGE:
+		buf = make([]byte, d.diskDataSize())
 	default:
 		return fmt.Errorf("DelDiskData error: invalid datatype stored in disk")
 	}
+	_, err = d.readAt(buf, addr)
+	if err != nil {
+		return fmt.Errorf("DelDiskData error, reading full record for deletion: %w", err)
+	}
 
-	dskData, err := DeserializeDskData(buf)
+	dskData, err := d.decode(buf, addr)
+	if err != nil {
+		return fmt.Errorf("DelDiskData error: %w", err)
+	}
+	head, err := d.GetDBHeader()
 	if err != nil {
 		return fmt.Errorf("DelDiskData error: %s", err.Error())
 	}
+
+	// push the record onto the free list so WrtDiskData can hand it out again
 	dskData.RecHead.Deleted = true
-	buf, err = SerializeDiskData(dskData)
+	dskData.RecHead.NxtFree = head.FreeHead
+	buf, err = d.encode(dskData)
 	if err != nil {
 		return fmt.Errorf("DelDiskData error: %s", err.Error())
 	}
 
-	_, err = d.FilObj.WriteAt(buf, int64(d.Cursor))
+	_, err = d.writeAt(buf, addr)
 	if err != nil {
 		return fmt.Errorf("DelDiskData error, write error: %s", err.Error())
 	}
+	d.PgCach.put(dskData, len(d.OpSavs) > 0)
+
+	head.FreeHead = addr
+	head.FreeCount++
+	err = d.WrtDBHeader(*head)
+	if err != nil {
+		return fmt.Errorf("DelDiskData error: %s", err.Error())
+	}
 	return nil
 }
@@ -0,0 +1,130 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrFormat is returned for a file that is not a database, or one written in a
+// format version or with features this build does not know
+var ErrFormat = errors.New("unsupported file format")
+
+// decodeHeader reads the header at the start of a file of version 2 or later
+func decodeHeader(buf []byte) (*TableHeader, error) {
+
+	if !bytes.HasPrefix(buf, []byte(FILE_MAGIC)) {
+		return nil, fmt.Errorf("%w: not a database file", ErrFormat)
+	}
+	if len(buf) < TBL_HEAD_SIZE {
+		return nil, fmt.Errorf("%w: file header cut short", ErrFormat)
+	}
+	head := &TableHeader{}
+	if err := binary.Read(bytes.NewReader(buf), BINARY_ORDER, head); err != nil {
+		return nil, err
+	}
+	switch {
+	case head.Version < 2 || head.Version > FORMAT_VERSION:
+		return nil, fmt.Errorf("%w: format version %d, this build reads versions up to %d", ErrFormat, head.Version, FORMAT_VERSION)
+	case head.Flags&^FL_KNOWN != 0:
+		return nil, fmt.Errorf("%w: unknown feature flags %#x", ErrFormat, head.Flags&^FL_KNOWN)
+	case head.TreeOrder < int32(MIN_TREE_ORDER) || head.TreeOrder > int32(MAX_TREE_ORDER):
+		return nil, fmt.Errorf("%w: tree order %d", ErrFormat, head.TreeOrder)
+	case head.PageSize < int32(ListPageSize(head.fanout())):
+		return nil, fmt.Errorf("%w: pages of %d bytes are too small for order %d", ErrFormat, head.PageSize, head.TreeOrder)
+	}
+	return head, nil
+}
+
+// encodeHeader writes head, files of version 1 are never written
+func encodeHeader(head TableHeader) ([]byte, error) {
+
+	if head.Version < 2 {
+		return nil, fmt.Errorf("%w: version %d headers are not written", ErrFormat, head.Version)
+	}
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, BINARY_ORDER, head); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readHeader reads the header of a file of any version. A version 1 file has no magic
+// to go by, it is told apart by its shape and never read as a later layout.
+func readHeader(file *os.File) (*TableHeader, error) {
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, max(TBL_HEAD_SIZE, BASELINE_HEAD_SIZE+BASELINE_REC_HEAD_SIZE))
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte(FILE_MAGIC)) && isBaseline(buf, info.Size()) {
+		return decodeBaselineHeader(buf, info.Size())
+	}
+	return decodeHeader(buf)
+}
+
+// fanout is the tree order of the file, files from before it was stored are order 3
+func (head *TableHeader) fanout() int {
+	if head.TreeOrder == 0 {
+		return TREE_ORDER
+	}
+	return int(head.TreeOrder)
+}
+
+// headSize is where the first record of this file starts
+func (d *DiskManager) headSize() int {
+	if d.FilVer < 2 {
+		return BASELINE_HEAD_SIZE
+	}
+	return TBL_HEAD_SIZE
+}
+
+// writable is the error a write to this file fails with, if any. Version 1 files are
+// read until Upgrade rewrites them, their layout is never written.
+func (d *DiskManager) writable() error {
+	switch {
+	case d.RdOnly:
+		return ErrReadOnly
+	case d.FilVer < 2:
+		return fmt.Errorf("%w: a version 1 file has to be upgraded before it is written", ErrReadOnly)
+	}
+	return nil
+}
+
+// Upgrade migrates a file written in an older format version to FORMAT_VERSION in
+// place. Its live pages are copied the way Vacuum copies them, into the current
+// layout with a checksum on every page. The pages of a version 1 file grow to hold
+// the current nodes, sized for a tree page of order 3. It returns false when the file
+// is current.
+func (d *DiskManager) Upgrade() (bool, error) {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	if d.FilVer == FORMAT_VERSION && d.ChkSum {
+		return false, nil
+	}
+	if _, err := d.rewrite(true); err != nil {
+		return false, fmt.Errorf("Upgrade error: %w", err)
+	}
+	return true, nil
+}
+
+// UpgradeDatabase opens dbname, upgrades it and closes it again
+func UpgradeDatabase(dbname string) (bool, error) {
+
+	d, err := InitDatabase(dbname)
+	if err != nil {
+		return false, err
+	}
+	upgraded, err := d.Upgrade()
+	return upgraded, errors.Join(err, d.Close())
+}
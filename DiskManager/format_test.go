@@ -0,0 +1,255 @@
+package diskmanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyFixture copies a file of testdata into a directory of the test, opening a
+// database writes next to it
+func copyFixture(t *testing.T, name string) string {
+
+	t.Helper()
+	buf, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), filepath.Base(name))
+	if err := os.WriteFile(path, buf, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// the files of testdata/v1 were written by the first release: oldtree holds the keys
+// -10 to 40 with the values v<key> but a 32 byte one for 7, oldlist the keys 2 to 12
+// and -3 with 5 and 6 deleted and 9 updated and oldempty nothing
+func baselineRows(name string) map[int32]string {
+
+	rows := map[int32]string{}
+	switch name {
+	case "oldtree":
+		for k := int32(-10); k <= 40; k++ {
+			rows[k] = fmt.Sprintf("v%d", k)
+		}
+		rows[7] = "abcdefghijklmnopqrstuvwxyz012345"
+	case "oldlist":
+		for _, k := range []int32{-3, 2, 3, 4, 7, 8, 9, 10, 11, 12} {
+			rows[k] = fmt.Sprintf("v%d", k)
+		}
+		rows[9] = "nine"
+	}
+	return rows
+}
+
+// checkBaselineRows reads every row of the one table of a version 1 file, by key and
+// in a scan
+func checkBaselineRows(t *testing.T, d *DiskManager, name string) {
+
+	t.Helper()
+	table, err := InitTable(d, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	rows := baselineRows(name)
+	for k, want := range rows {
+		if val, err := table.Select(Int32Key(k)); err != nil || val != want {
+			t.Fatalf("%s: key %d is %q, %v, want %q", name, k, val, err, want)
+		}
+	}
+	if _, err := table.Select(Int32Key(41)); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("%s: expected key 41 to be missing, got %v", name, err)
+	}
+	it, err := table.SelectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := 0
+	for it.Next() {
+		if want, ok := rows[int32(BINARY_ORDER.Uint32(it.Key())^1<<31)]; !ok || it.Value() != want {
+			t.Fatalf("%s: scan found %x = %q", name, it.Key(), it.Value())
+		}
+		seen++
+	}
+	if it.Err() != nil || seen != len(rows) {
+		t.Fatalf("%s: scan found %d of %d rows, %v", name, seen, len(rows), it.Err())
+	}
+}
+
+func TestBaselineRead(t *testing.T) {
+
+	for _, name := range []string{"oldtree", "oldlist", "oldempty"} {
+		for _, readOnly := range []bool{true, false} {
+			path := copyFixture(t, "v1/"+name)
+			before, _ := os.ReadFile(path)
+			d, err := OpenDatabaseAt(path, readOnly, 0)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if d.FilVer != 1 || d.Fanout != 3 {
+				t.Fatalf("%s: version %d order %d", name, d.FilVer, d.Fanout)
+			}
+			checkBaselineRows(t, d, name)
+			if report, err := d.IntegrityCheck(); err != nil || len(report.Problems) != 0 {
+				t.Fatalf("%s: integrity check: %+v, %v", name, report, err)
+			}
+
+			// nothing is written in the old layout, not even the header
+			table, _ := InitTable(d, name)
+			if err := table.Insert(Int32Key(100), "new"); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("%s: insert: expected ErrReadOnly, got %v", name, err)
+			}
+			if err := table.Delete(Int32Key(2)); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("%s: delete: expected ErrReadOnly, got %v", name, err)
+			}
+			if _, err := d.Vacuum(); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("%s: vacuum: expected ErrReadOnly, got %v", name, err)
+			}
+			if err := d.Begin(); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("%s: begin: expected ErrReadOnly, got %v", name, err)
+			}
+			checkBaselineRows(t, d, name)
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+				t.Fatalf("%s: the version 1 file was written", name)
+			}
+		}
+	}
+}
+
+func TestBaselineUpgrade(t *testing.T) {
+
+	folder := DB_FOLDER
+	t.Cleanup(func() { DB_FOLDER = folder })
+	for _, name := range []string{"oldtree", "oldlist", "oldempty"} {
+		path := copyFixture(t, "v1/"+name)
+		DB_FOLDER = filepath.Dir(path)
+		if upgraded, err := UpgradeDatabase(name); err != nil || !upgraded {
+			t.Fatalf("%s: upgrade: %v, %v", name, upgraded, err)
+		}
+		if upgraded, err := UpgradeDatabase(name); err != nil || upgraded {
+			t.Fatalf("%s: second upgrade: %v, %v", name, upgraded, err)
+		}
+
+		d, err := InitDatabaseAt(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if d.FilVer != FORMAT_VERSION || !d.ChkSum || d.Fanout != 3 || d.PgSize != TreePageSize(3) {
+			t.Fatalf("%s: version %d sums %v order %d pages %d", name, d.FilVer, d.ChkSum, d.Fanout, d.PgSize)
+		}
+		checkBaselineRows(t, d, name)
+		// the deleted record of oldlist is gone with the rewrite
+		if report, err := d.IntegrityCheck(); err != nil || len(report.Problems) != 0 || report.Orphans != 0 {
+			t.Fatalf("%s: integrity check: %+v, %v", name, report, err)
+		}
+
+		// the upgraded file takes writes: long values, deletes that merge the pages of
+		// the old rows and a table of the other type
+		table, _ := InitTable(d, name)
+		long := strings.Repeat("long ", 20)
+		if err := table.Insert(Int32Key(100), long); err != nil {
+			t.Fatalf("%s: insert: %v", name, err)
+		}
+		for k := range baselineRows(name) {
+			if err := table.Delete(Int32Key(k)); err != nil {
+				t.Fatalf("%s: delete %d: %v", name, k, err)
+			}
+		}
+		if val, err := table.Select(Int32Key(100)); err != nil || val != long {
+			t.Fatalf("%s: key 100 is %q, %v", name, val, err)
+		}
+		if err := d.AddTable("more", "tree", KT_STRING, nil); err != nil {
+			t.Fatalf("%s: add table: %v", name, err)
+		}
+		more, _ := InitTable(d, "more")
+		if err := more.Insert(Key("k"), long); err != nil {
+			t.Fatalf("%s: insert into the new table: %v", name, err)
+		}
+		if report, err := d.IntegrityCheck(); err != nil || len(report.Problems) != 0 || report.Rows != 2 {
+			t.Fatalf("%s: integrity check after writes: %+v, %v", name, report, err)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFormatRefused(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a version from a later build is refused, as is a file that is no database
+	file[len(FILE_MAGIC)+1]++
+	if err := os.WriteFile(path, file, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitDatabaseAt(path); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected a format error for version %d, got %v", FORMAT_VERSION+1, err)
+	}
+	if err := os.WriteFile(path, bytes.Repeat([]byte("not a database "), 10), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitDatabaseAt(path); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected a format error for a text file, got %v", err)
+	}
+	// the header of a version 1 file on records of the wrong size
+	if err := os.WriteFile(path, append([]byte{0, 0, 0, 5, 0}, make([]byte, 99)...), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitDatabaseAt(path); !errors.Is(err, ErrFormat) || strings.Contains(err.Error(), "version 1") {
+		t.Fatalf("expected a format error for a cut version 1 file, got %v", err)
+	}
+}
+
+// version 1 keys were compared as numbers, re-encoded they have to compare the same as
+// bytes
+func TestBaselineNode(t *testing.T) {
+
+	keys := []int32{math.MinInt32, -300, -1, 1, 2, 255, 256, math.MaxInt32}
+	var prev Key
+	for _, k := range keys {
+		old := baselineNode{Key: k}
+		copy(old.Val[:], fmt.Sprint(k))
+		node := old.node()
+		if CompareKeys(node.key(), Int32Key(k)) != 0 {
+			t.Fatalf("key %d became %x", k, node.key())
+		}
+		if prev != nil && CompareKeys(prev, node.key()) >= 0 {
+			t.Fatalf("key %d does not sort after the key before it", k)
+		}
+		prev = node.key()
+		if val := string(node.Val[:node.Size]); val != fmt.Sprint(k) || node.Ovfl != 0 {
+			t.Fatalf("key %d: value %q", k, val)
+		}
+	}
+
+	// a value of all 32 bytes, key 0 with a value and the empty slot
+	full := baselineNode{Key: 7}
+	copy(full.Val[:], strings.Repeat("x", 32))
+	if node := full.node(); node.Size != 32 {
+		t.Fatalf("full value cut to %d bytes", node.Size)
+	}
+	zero := baselineNode{Val: [32]byte{'z'}}
+	if node := zero.node(); IsNodeEmpty(node) || CompareKeys(node.key(), Int32Key(0)) != 0 {
+		t.Fatalf("key 0 became %+v", node)
+	}
+	if node := (baselineNode{}).node(); !IsNodeEmpty(node) {
+		t.Fatalf("empty slot became %+v", node)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package diskmanager
+
+// syncDir is a no-op outside unix, where directories cannot be opened for a flush and
+// a rename is made durable by the file system itself
+func syncDir(path string) error {
+	return nil
+}
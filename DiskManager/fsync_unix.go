@@ -0,0 +1,22 @@
+//go:build unix
+
+package diskmanager
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// syncDir flushes the directory holding path, so a rename into it survives a crash
+func syncDir(path string) error {
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if cerr := dir.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
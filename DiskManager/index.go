@@ -0,0 +1,290 @@
+package diskmanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+// An index is a tree of its own in the table directory with an entry for every row.
+// The key of an entry is the value of one column, encoded so that the bytes order like
+// the values and cut or padded to IDX_VAL_SIZE, followed by a hash of the key of the
+// row, which is what the entry holds. Rows whose value shares a cut key with another
+// are found together, callers check the value of what a lookup returns. NULL is not
+// indexed.
+
+// Columns are the columns of the table, a key value table has the columns key and value
+func (ti *TblInfo) Columns() []Column {
+
+	if ti.TblSch != nil {
+		return ti.TblSch.Columns
+	}
+	keyType := CT_BLOB
+	switch ti.KeyTyp {
+	case KT_INT32, KT_INT64:
+		keyType = CT_INTEGER
+	case KT_STRING:
+		keyType = CT_TEXT
+	}
+	return []Column{
+		{Name: "key", Type: keyType, PrimKey: true},
+		{Name: "value", Type: CT_TEXT},
+	}
+}
+
+// Row decodes a row into the values of Columns
+func (ti *TblInfo) Row(key Key, val string) ([]any, error) {
+
+	if ti.TblSch != nil {
+		return ti.DecodeRow(key, val)
+	}
+	k, err := ti.KeyValue(key)
+	if err != nil {
+		return nil, fmt.Errorf("Row error: %w", err)
+	}
+	return []any{k, val}, nil
+}
+
+// Index returns the index on column col of the table, nil when it has none
+func (ti *TblInfo) Index(col int) *TblInfo {
+
+	for _, idx := range ti.TblIdx {
+		if idx.IdxCol == col+1 {
+			return idx
+		}
+	}
+	return nil
+}
+
+// AddIndex indexes column of table, the rows already in the table included
+func (d *DiskManager) AddIndex(table string, column string) error {
+
+	if TreePageSize(d.Fanout) > d.PgSize {
+		return fmt.Errorf("AddIndex error: the pages of this database were sized for list tables before tables could be mixed, it cannot hold an index")
+	}
+	err := loggedTable{disk: d}.logged(func() error {
+		ti := d.table(table)
+		if ti == nil {
+			return fmt.Errorf("no table %s in the database", table)
+		}
+		col := -1
+		columns := ti.Columns()
+		for i := range columns {
+			if strings.EqualFold(columns[i].Name, column) {
+				col = i
+			}
+		}
+		switch {
+		case col == -1:
+			return fmt.Errorf("table %s has no column %s", table, column)
+		case columns[col].PrimKey:
+			return fmt.Errorf("column %s is the key of table %s, it needs no index", column, table)
+		case ti.Index(col) != nil:
+			return fmt.Errorf("table %s already has an index on %s", table, column)
+		case col+1 > math.MaxUint8:
+			return fmt.Errorf("only the first %d columns can be indexed", math.MaxUint8)
+		}
+
+		entry := DirEntry{KeyType: KT_BYTES, IdxCol: uint8(col + 1)}
+		if ti.DirAdr != 0 {
+			entry.NLen = uint8(len(ti.TblNam))
+			copy(entry.Name[:], ti.TblNam)
+		}
+		dirAddr, dirIdx, err := d.addDirEntry(entry)
+		if err != nil {
+			return err
+		}
+		idx := &TblInfo{TblNam: ti.TblNam, IsTree: true, KeyTyp: KT_BYTES, DirAdr: dirAddr, DirIdx: dirIdx, IdxCol: col + 1}
+		ti.TblIdx = append(ti.TblIdx, idx)
+
+		it, err := d.plainTable(ti).Scan(nil, nil, false)
+		if err != nil {
+			return err
+		}
+		for it.Next() {
+			row, err := ti.Row(it.Key(), it.Value())
+			if err != nil {
+				return err
+			}
+			if ik := indexKey(row[col]); ik != nil {
+				if err := d.indexAdd(idx, ik, it.Key()); err != nil {
+					return err
+				}
+			}
+		}
+		return it.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("AddIndex error: %w", err)
+	}
+	return nil
+}
+
+// IndexLookup returns, in key order, the keys of the rows whose value in column col
+// may lie between from and to, both inclusive and open when nil. Values longer than
+// an index key can hold come back when their cut key is in range, check them.
+func (d *DiskManager) IndexLookup(ti *TblInfo, col int, from, to any) ([]Key, error) {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	idx := ti.Index(col)
+	if idx == nil {
+		return nil, fmt.Errorf("IndexLookup error: table %s has no index on column %d", ti.TblNam, col)
+	}
+	var low, high Key
+	if ik := indexKey(from); ik != nil {
+		low = append(ik, make([]byte, KEY_SIZE-IDX_VAL_SIZE)...)
+	}
+	if ik := indexKey(to); ik != nil {
+		high = append(ik, bytes.Repeat([]byte{0xff}, KEY_SIZE-IDX_VAL_SIZE)...)
+	}
+	it, err := tree{table: d, info: idx}.Scan(low, high, false)
+	if err != nil {
+		return nil, fmt.Errorf("IndexLookup error: %w", err)
+	}
+	var keys []Key
+	for it.Next() {
+		keys = append(keys, Key(it.Value()))
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("IndexLookup error: %w", err)
+	}
+	sort.Slice(keys, func(i, j int) bool { return CompareKeys(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+// reindex moves the row at key in every index of the table from its old value, nil
+// when the row was not there, to its new one, nil once it is deleted
+func (d *DiskManager) reindex(ti *TblInfo, key Key, oldVal, newVal *string) error {
+
+	for _, idx := range ti.TblIdx {
+		var oldKey, newKey Key
+		for _, v := range []struct {
+			val *string
+			ik  *Key
+		}{{oldVal, &oldKey}, {newVal, &newKey}} {
+			if v.val == nil {
+				continue
+			}
+			row, err := ti.Row(key, *v.val)
+			if err != nil {
+				return fmt.Errorf("reindex error: %w", err)
+			}
+			*v.ik = indexKey(row[idx.IdxCol-1])
+		}
+		if CompareKeys(oldKey, newKey) == 0 {
+			continue
+		}
+		if oldKey != nil {
+			if err := d.indexRemove(idx, oldKey, key); err != nil {
+				return fmt.Errorf("reindex error: %w", err)
+			}
+		}
+		if newKey != nil {
+			if err := d.indexAdd(idx, newKey, key); err != nil {
+				return fmt.Errorf("reindex error: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexAdd adds the entry of the row at key under the index key ik. Rows whose keys
+// hash alike take the next free entry after the one of their hash.
+func (d *DiskManager) indexAdd(idx *TblInfo, ik Key, key Key) error {
+
+	t := tree{table: d, info: idx}
+	for entry := entryKey(ik, key); ; {
+		_, err := t.Select(entry)
+		if errors.Is(err, ErrKeyNotFound) {
+			return t.Insert(entry, string(key))
+		}
+		if err != nil {
+			return err
+		}
+		if entry = nextEntry(entry); entry == nil {
+			return fmt.Errorf("indexAdd error: no free entry left for the hash of a key")
+		}
+	}
+}
+
+// indexRemove deletes the entry of the row at key under the index key ik, the first one
+// holding key from the entry of its hash on
+func (d *DiskManager) indexRemove(idx *TblInfo, ik Key, key Key) error {
+
+	t := tree{table: d, info: idx}
+	high := append(bytes.Clone(ik), bytes.Repeat([]byte{0xff}, KEY_SIZE-IDX_VAL_SIZE)...)
+	it, err := t.Scan(entryKey(ik, key), high, false)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		if it.Value() == string(key) {
+			entry := bytes.Clone(it.Key())
+			return t.Delete(entry)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("indexRemove error: %w", &KeyNotFoundError{Key: idx.FormatKey(ik)})
+}
+
+// indexKey is the part of the entries of v in an index that holds the value, nil for
+// NULL. A leading 1 keeps an empty string apart from the padding.
+func indexKey(v any) Key {
+
+	var enc []byte
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		enc = Int64Key(v)
+	case float64:
+		// flip the sign bit of positive numbers and every bit of negative ones
+		bits := math.Float64bits(v)
+		if bits&(1<<63) == 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		enc = BINARY_ORDER.AppendUint64(nil, bits)
+	case bool:
+		enc = []byte{0}
+		if v {
+			enc[0] = 1
+		}
+	case string:
+		enc = []byte(v)
+	case []byte:
+		enc = v
+	}
+	key := make(Key, IDX_VAL_SIZE, KEY_SIZE)
+	key[0] = 1
+	copy(key[1:], enc)
+	return key
+}
+
+// entryKey is the key of the entry of the row at key under the index key ik
+func entryKey(ik Key, key Key) Key {
+
+	hash := fnv.New64a()
+	hash.Write(key)
+	return hash.Sum(bytes.Clone(ik))
+}
+
+// nextEntry is the entry after entry under the same index key, nil past the last one
+func nextEntry(entry Key) Key {
+
+	next := bytes.Clone(entry)
+	suffix := BINARY_ORDER.Uint64(next[IDX_VAL_SIZE:])
+	if suffix == math.MaxUint64 {
+		return nil
+	}
+	BINARY_ORDER.PutUint64(next[IDX_VAL_SIZE:], suffix+1)
+	return next
+}
@@ -0,0 +1,173 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []Column{{Name: "id", Type: CT_INTEGER, PrimKey: true}, {Name: "city", Type: CT_TEXT}}
+	if err := d.AddTable("users", "list", 0, columns); err != nil {
+		t.Fatal(err)
+	}
+	kv, _ := InitTable(d, "app")
+	users, _ := InitTable(d, "users")
+	ti, _ := d.TableInfo("users")
+	app, _ := d.TableInfo("app")
+	cities := []string{"oslo", "rome", "lima"}
+	for i := 0; i < 30; i++ {
+		key, val, err := ti.EncodeRow([]any{int64(i), cities[i%3]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Insert(key, val); err != nil {
+			t.Fatal(err)
+		}
+		// values longer than an index key share the key their first bytes make
+		if err := kv.Insert(Int32Key(int32(i)), strings.Repeat("v", KEY_SIZE)+fmt.Sprint(i%2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rows written before the index are in it as well
+	if err := d.AddIndex("users", "city"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddIndex("app", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddIndex("users", "city"); err == nil {
+		t.Fatal("expected an error for a duplicate index")
+	}
+	if err := d.AddIndex("users", "id"); err == nil {
+		t.Fatal("expected an error for an index on the key")
+	}
+
+	lookup := func(ti *TblInfo, col int, from, to any) []Key {
+		t.Helper()
+		keys, err := d.IndexLookup(ti, col, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	if got := lookup(ti, 1, "rome", "rome"); len(got) != 10 || CompareKeys(got[0], Int64Key(1)) != 0 {
+		t.Fatalf("rome: got %d keys starting at %v", len(got), got[0])
+	}
+	if got := lookup(ti, 1, "lima", "oslo"); len(got) != 20 {
+		t.Fatalf("lima to oslo: got %d keys, want 20", len(got))
+	}
+	if got := lookup(app, 1, nil, nil); len(got) != 30 {
+		t.Fatalf("app: got %d keys, want 30", len(got))
+	}
+
+	// updates and deletes move rows between values
+	key, val, _ := ti.EncodeRow([]any{int64(1), "oslo"})
+	if err := users.Update(key, val); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(Int64Key(4)); err != nil {
+		t.Fatal(err)
+	}
+	key, val, _ = ti.EncodeRow([]any{int64(7), nil})
+	if err := users.Upsert(key, val); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(ti, 1, "rome", "rome"); len(got) != 7 {
+		t.Fatalf("rome after writes: got %d keys, want 7", len(got))
+	}
+	if got := lookup(ti, 1, "oslo", "oslo"); len(got) != 11 {
+		t.Fatalf("oslo after writes: got %d keys, want 11", len(got))
+	}
+
+	// a rolled back write leaves the index the way it was
+	if err := d.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(Int64Key(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddIndex("app", "key"); err == nil {
+		t.Fatal("expected an error for an index on the key")
+	}
+	if err := d.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(ti, 1, "oslo", "oslo"); len(got) != 11 {
+		t.Fatalf("oslo after rollback: got %d keys, want 11", len(got))
+	}
+	if _, err := d.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	ti, _ = d.TableInfo("users")
+	app, _ = d.TableInfo("app")
+	if len(ti.TblIdx) != 1 || len(app.TblIdx) != 1 || len(d.Tables()) != 2 {
+		t.Fatalf("indexes lost on reopen: users %d, app %d, tables %d", len(ti.TblIdx), len(app.TblIdx), len(d.Tables()))
+	}
+	if got := lookup(ti, 1, "oslo", "oslo"); len(got) != 11 {
+		t.Fatalf("oslo after reopen: got %d keys, want 11", len(got))
+	}
+	if got := lookup(app, 1, strings.Repeat("v", KEY_SIZE)+"1", nil); len(got) != 30 {
+		t.Fatalf("cut values: got %d keys, want 30", len(got))
+	}
+}
+
+// rows whose keys hash alike share nothing but the index key, each gets an entry of
+// its own and a delete takes out the right one
+func TestIndexHashCollision(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.AddIndex("app", "value"); err != nil {
+		t.Fatal(err)
+	}
+	ti, _ := d.TableInfo("app")
+	idx := ti.TblIdx[0]
+	ik := indexKey("same")
+	// the same key twice hashes alike like two colliding keys would
+	for _, key := range []Key{Int32Key(1), Int32Key(1), Int32Key(2)} {
+		if err := (loggedTable{disk: d}).logged(func() error { return d.indexAdd(idx, ik, key) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys, err := d.IndexLookup(ti, 1, "same", "same"); err != nil || len(keys) != 3 {
+		t.Fatalf("got %d keys, %v", len(keys), err)
+	}
+	for _, key := range []Key{Int32Key(1), Int32Key(2), Int32Key(1)} {
+		if err := (loggedTable{disk: d}).logged(func() error { return d.indexRemove(idx, ik, key) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (loggedTable{disk: d}).logged(func() error { return d.indexRemove(idx, ik, Int32Key(1)) }); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("removing a missing entry: expected ErrKeyNotFound, got %v", err)
+	}
+	if keys, err := d.IndexLookup(ti, 1, nil, nil); err != nil || len(keys) != 0 {
+		t.Fatalf("got %d keys left, %v", len(keys), err)
+	}
+}
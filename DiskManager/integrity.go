@@ -0,0 +1,325 @@
+package diskmanager
+
+import (
+	"fmt"
+)
+
+// checks an integrity report can fail
+const (
+	IC_READ    = "read"    // the page cannot be read or has the wrong type
+	IC_DELETED = "deleted" // a live page is marked deleted, or sits on the free list
+	IC_SHARED  = "shared"  // a page is reachable twice, from two places or through a cycle
+	IC_ORDER   = "order"   // keys out of order, outside the range of their subtree or repeated
+	IC_KEYS    = "keys"    // key count outside MinKeys and MaxKeys, or keys not packed
+	IC_DEPTH   = "depth"   // leaves at different depths
+	IC_PARENT  = "parent"  // a Parent, IsRoot or child pointer that does not match the page above
+	IC_LIST    = "list"    // Parent and Chld of a list chain that do not agree
+	IC_OVFL    = "ovfl"    // an overflow chain that does not hold the size of its value
+	IC_FREE    = "free"    // a free list that does not match the header
+)
+
+// Problem is one broken invariant. Addr is the page it was found on, 0 for the file.
+type Problem struct {
+	Table string
+	Addr  int32
+	Check string // one of the IC_ constants
+	Msg   string
+}
+
+func (p Problem) String() string {
+	where := "file"
+	if p.Addr != 0 {
+		where = fmt.Sprintf("page %d", p.Addr)
+	}
+	if p.Table != "" {
+		where = fmt.Sprintf("table %s, %s", p.Table, where)
+	}
+	return fmt.Sprintf("%s: %s: %s", where, p.Check, p.Msg)
+}
+
+// IntegrityReport is what IntegrityCheck found. Orphans are records that are neither
+// live nor free, left behind by an interrupted write until the next vacuum.
+type IntegrityReport struct {
+	Tables   int // tables and indexes walked
+	Pages    int // live pages, the header excluded
+	Rows     int // rows of the tables, indexes excluded
+	Free     int // records on the free list
+	Orphans  int
+	Problems []Problem
+}
+
+func (r *IntegrityReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// checker holds the state of one IntegrityCheck
+type checker struct {
+	d      *DiskManager
+	report *IntegrityReport
+	live   map[int32]bool
+	table  string
+}
+
+func (c *checker) problem(addr int32, check string, format string, args ...any) {
+	c.report.Problems = append(c.report.Problems, Problem{Table: c.table, Addr: addr, Check: check, Msg: fmt.Sprintf(format, args...)})
+}
+
+// IntegrityCheck walks every page of the database, the directory, the catalogs,
+// every table and index with their overflow chains and the free list, and reports
+// every invariant it finds broken. An error means the check itself could not run.
+func (d *DiskManager) IntegrityCheck() (*IntegrityReport, error) {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return nil, fmt.Errorf("IntegrityCheck error: %w", err)
+	}
+	c := &checker{d: d, report: &IntegrityReport{}, live: map[int32]bool{}}
+
+	c.chain(head.CtlgAddr, -1)
+	for addr := head.DirAddr; addr != 0; {
+		dsk := c.visit(addr, DT_DIR_PAGE)
+		if dsk == nil {
+			break
+		}
+		page := dsk.RecData.(DirPage)
+		for _, ent := range page.Ents {
+			if !ent.free() {
+				c.chain(ent.CtlgAddr, -1)
+			}
+		}
+		addr = page.Head.Next
+	}
+
+	for _, ti := range d.TblLst {
+		for _, t := range append([]*TblInfo{ti}, ti.TblIdx...) {
+			c.table = t.TblNam
+			if t.IdxCol != 0 {
+				c.table = fmt.Sprintf("%s(%s)", t.TblNam, ti.Columns()[t.IdxCol-1].Name)
+			}
+			c.report.Tables++
+			rows := 0
+			if t.IsTree {
+				rows = c.tree(t.SrtOff)
+			} else {
+				rows = c.list(t.SrtOff)
+			}
+			if t.IdxCol == 0 {
+				c.report.Rows += rows
+			}
+		}
+	}
+	c.table = ""
+	c.report.Pages = len(c.live)
+	c.freeList(head)
+	return c.report, nil
+}
+
+// visit reads a live page of the given type, nil when it cannot be used
+func (c *checker) visit(addr int32, recType int8) *DiskData {
+
+	if addr <= 0 || addr >= c.d.EndOff {
+		c.problem(addr, IC_READ, "address outside the file")
+		return nil
+	}
+	if c.live[addr] {
+		c.problem(addr, IC_SHARED, "page is reached a second time")
+		return nil
+	}
+	c.live[addr] = true
+	dsk, err := c.d.GetDiskData(addr)
+	if err != nil {
+		c.problem(addr, IC_READ, "%s", err.Error())
+		return nil
+	}
+	if dsk.RecHead.Deleted {
+		c.problem(addr, IC_DELETED, "live page is marked deleted")
+	}
+	if dsk.RecHead.RecType != recType {
+		c.problem(addr, IC_READ, "page of type %d where type %d belongs", dsk.RecHead.RecType, recType)
+		return nil
+	}
+	return dsk
+}
+
+// chain checks an overflow chain, size is the length of its value or -1 when not known
+func (c *checker) chain(addr int32, size int32) {
+
+	if addr == 0 {
+		return
+	}
+	start, total := addr, int32(0)
+	for addr != 0 {
+		dsk := c.visit(addr, DT_OVFL_PAGE)
+		if dsk == nil {
+			return
+		}
+		page := dsk.RecData.(OvflPage)
+		if page.Head.Size <= 0 || int(page.Head.Size) > len(page.Data) {
+			c.problem(addr, IC_OVFL, "chunk of %d bytes", page.Head.Size)
+			return
+		}
+		total += page.Head.Size
+		addr = page.Head.Next
+	}
+	if size >= 0 && total != size {
+		c.problem(start, IC_OVFL, "chain holds %d bytes, the value %d", total, size)
+	}
+}
+
+// nodes checks the overflow chains of the keys of a page
+func (c *checker) nodes(nodes []DataNode) {
+	for _, node := range nodes {
+		if node.Ovfl != 0 {
+			c.chain(node.Ovfl, node.Size)
+		}
+	}
+}
+
+// tree checks the tree at root and returns the number of keys in it
+func (c *checker) tree(root int32) int {
+
+	if root == 0 {
+		return 0
+	}
+	leafDepth := -1
+	return c.treePage(root, -1, 0, nil, nil, &leafDepth)
+}
+
+// treePage checks the subtree at addr, whose keys have to lie strictly between lo and
+// hi when they are given
+func (c *checker) treePage(addr, parent int32, depth int, lo, hi Key, leafDepth *int) int {
+
+	dsk := c.visit(addr, DT_TREE_PAGE)
+	if dsk == nil {
+		return 0
+	}
+	page := dsk.RecData.(TreePage)
+	isRoot := parent == -1
+	if page.Head.IsRoot != isRoot || page.Head.Parent != parent {
+		c.problem(addr, IC_PARENT, "page says root %v under %d, found as root %v under %d", page.Head.IsRoot, page.Head.Parent, isRoot, parent)
+	}
+
+	n := NumKeys(page.Data)
+	if !IsNodesEmpty(page.Data[n:]) {
+		c.problem(addr, IC_KEYS, "keys are not packed at the front of the page")
+	}
+	switch {
+	case n > c.d.MaxKeys():
+		c.problem(addr, IC_KEYS, "%d keys, at most %d fit", n, c.d.MaxKeys())
+	case isRoot && n == 0:
+		c.problem(addr, IC_KEYS, "root of a table with rows holds no key")
+	case !isRoot && n < c.d.MinKeys():
+		c.problem(addr, IC_KEYS, "%d keys, at least %d expected", n, c.d.MinKeys())
+	}
+	for i := 0; i < n; i++ {
+		key := page.Data[i].key()
+		switch {
+		case i > 0 && CompareKeys(page.Data[i-1].key(), key) >= 0:
+			c.problem(addr, IC_ORDER, "key %d is not above the one before it", i)
+		case lo != nil && CompareKeys(key, lo) <= 0 || hi != nil && CompareKeys(key, hi) >= 0:
+			c.problem(addr, IC_ORDER, "key %d is outside the range of its subtree", i)
+		}
+	}
+	c.nodes(page.Data[:n])
+
+	if page.Head.IsLeaf {
+		if *leafDepth == -1 {
+			*leafDepth = depth
+		} else if depth != *leafDepth {
+			c.problem(addr, IC_DEPTH, "leaf at depth %d, others at %d", depth, *leafDepth)
+		}
+		return n
+	}
+	rows := n
+	for i := 0; i <= n; i++ {
+		if page.Chld[i] == 0 {
+			c.problem(addr, IC_PARENT, "child %d is missing", i)
+			continue
+		}
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = page.Data[i-1].key()
+		}
+		if i < n {
+			chi = page.Data[i].key()
+		}
+		rows += c.treePage(page.Chld[i], addr, depth+1, clo, chi, leafDepth)
+	}
+	return rows
+}
+
+// list checks the chain of list pages from root and returns the number of keys in it
+func (c *checker) list(root int32) int {
+
+	if root == 0 {
+		return 0
+	}
+	rows := 0
+	seen := map[string]bool{}
+	prev := int32(-1)
+	for addr := root; addr != -1; {
+		dsk := c.visit(addr, DT_LIST_PAGE)
+		if dsk == nil {
+			return rows
+		}
+		page := dsk.RecData.(ListPage)
+		if page.Head.Parent != prev {
+			c.problem(addr, IC_LIST, "Parent is %d, the page before it is %d", page.Head.Parent, prev)
+		}
+		if IsNodesEmpty(page.Data) && (prev != -1 || page.Chld != -1) {
+			c.problem(addr, IC_KEYS, "empty page left in a chain of several")
+		}
+		for _, node := range page.Data {
+			if IsNodeEmpty(node) {
+				continue
+			}
+			if seen[string(node.key())] {
+				c.problem(addr, IC_ORDER, "key 0x%x is repeated", []byte(node.key()))
+			}
+			seen[string(node.key())] = true
+			rows++
+		}
+		c.nodes(page.Data)
+		if page.Chld == 0 {
+			c.problem(addr, IC_LIST, "Chld is 0, the last page has -1")
+			return rows
+		}
+		prev, addr = addr, page.Chld
+	}
+	return rows
+}
+
+// freeList checks that the free list holds FreeCount deleted records none of which is
+// live, and counts the records that are neither
+func (c *checker) freeList(head *TableHeader) {
+
+	recSize := int32(c.d.diskDataSize())
+	records := int((c.d.EndOff - int32(c.d.headSize())) / recSize)
+	free := map[int32]bool{}
+	for addr := head.FreeHead; addr != 0; {
+		if free[addr] || len(free) > records {
+			c.problem(addr, IC_FREE, "free list runs in a cycle")
+			break
+		}
+		free[addr] = true
+		if c.live[addr] {
+			c.problem(addr, IC_DELETED, "live page is on the free list")
+		}
+		hdr, err := c.d.getRecHead(addr)
+		if err != nil {
+			c.problem(addr, IC_FREE, "%s", err.Error())
+			break
+		}
+		if !hdr.Deleted {
+			c.problem(addr, IC_FREE, "page on the free list is not marked deleted")
+		}
+		addr = hdr.NxtFree
+	}
+	if len(free) != int(head.FreeCount) {
+		c.problem(0, IC_FREE, "header counts %d free records, the list holds %d", head.FreeCount, len(free))
+	}
+	c.report.Free = len(free)
+	c.report.Orphans = max(records-len(c.live)-len(free), 0)
+}
@@ -0,0 +1,88 @@
+package diskmanager
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIntegrityCheck(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.AddTable("users", "list", KT_INT32, nil); err != nil {
+		t.Fatal(err)
+	}
+	app, _ := InitTable(d, "app")
+	users, _ := InitTable(d, "users")
+	for i := int32(0); i < 60; i++ {
+		// every tenth value spills onto an overflow chain
+		val := "value"
+		if i%10 == 0 {
+			val = strings.Repeat("x", 400)
+		}
+		if err := app.Insert(Int32Key(i), val); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Insert(Int32Key(i), "user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddIndex("app", "value"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(0); i < 60; i += 3 {
+		if err := app.Delete(Int32Key(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Delete(Int32Key(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := d.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("problems in a sound file: %v", report.Problems)
+	}
+	if report.Tables != 3 || report.Rows != 80 || report.Free == 0 {
+		t.Fatalf("report of %d tables, %d rows, %d free pages", report.Tables, report.Rows, report.Free)
+	}
+
+	// point the first child of the root at the wrong parent
+	ti, _ := d.TableInfo("app")
+	dsk, err := d.GetDiskData(ti.SrtOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dsk.RecData.(TreePage)
+	if root.Head.IsLeaf {
+		t.Fatal("tree is too small to have children")
+	}
+	dsk, err = d.GetDiskData(root.Chld[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := dsk.RecData.(TreePage)
+	child.Head.Parent = root.Chld[1]
+	if err := d.EdtDiskData(root.Chld[0], child); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = d.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Check != IC_PARENT || report.Problems[0].Addr != root.Chld[0] {
+		t.Fatalf("expected a parent problem on page %d, got %v", root.Chld[0], report.Problems)
+	}
+}
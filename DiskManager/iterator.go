@@ -0,0 +1,294 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Iterator walks the rows of a table between two keys, both inclusive, in key order.
+// A nil bound leaves that end of the range open.
+//
+//	it, err := table.Scan(from, to, false)
+//	for it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+//	err = it.Err()
+//
+// An iterator from a Table takes the shared lock of the database for each row. When
+// the table was written in between it seeks again from the last row it returned, rows
+// present for the whole scan are seen exactly once.
+type Iterator struct {
+	disk *DiskManager
+	info *TblInfo
+	lock *sync.RWMutex // nil when the caller already holds the lock
+	from Key
+	to   Key
+	desc bool
+	seen uint64 // ChgCnt of the table when the position was taken
+	skip Key    // the last row returned, skipped once after seeking again
+
+	// tree tables, the path from the root to the next row. In ascending order
+	// Slot is the next key of the page, in descending order the key before it.
+	onTree bool
+	stack  []iterPos
+	// list tables, the rows in range already sorted
+	nodes []DataNode
+
+	key Key
+	val string
+	err error
+}
+
+// errIterDone stops an iterator that walked past the end of its range
+var errIterDone = errors.New("iterator done")
+
+type iterPos struct {
+	Page TreePage
+	Slot int
+}
+
+func (it *Iterator) Key() Key {
+	return it.key
+}
+
+func (it *Iterator) Value() string {
+	return it.val
+}
+
+func (it *Iterator) Err() error {
+	if it.err == errIterDone {
+		return nil
+	}
+	return it.err
+}
+
+// Next moves to the next row, it returns false once the range is exhausted or an
+// error stopped the walk
+func (it *Iterator) Next() bool {
+
+	if it.err != nil {
+		return false
+	}
+	if it.lock != nil {
+		it.lock.RLock()
+		defer it.lock.RUnlock()
+	}
+	if it.seen != it.disk.ChgCnt {
+		bound := it.bound()
+		if it.key != nil {
+			bound, it.skip = it.key, it.key
+		}
+		if err := it.reset(bound); err != nil {
+			it.err = fmt.Errorf("Iterator error: %w", err)
+			return false
+		}
+	}
+	node, ok, err := it.nextNode()
+	if ok && it.skip != nil && CompareKeys(node.key(), it.skip) == 0 {
+		node, ok, err = it.nextNode()
+	}
+	it.skip = nil
+	if err != nil {
+		it.err = fmt.Errorf("Iterator error: %w", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if it.desc && it.from != nil && CompareKeys(node.key(), it.from) < 0 ||
+		!it.desc && it.to != nil && CompareKeys(node.key(), it.to) > 0 {
+		it.err = errIterDone
+		return false
+	}
+	val, err := it.disk.nodeVal(node)
+	if err != nil {
+		it.err = fmt.Errorf("Iterator error: %w", err)
+		return false
+	}
+	it.key, it.val = node.key(), val
+	return true
+}
+
+func (it *Iterator) nextNode() (DataNode, bool, error) {
+
+	if !it.onTree {
+		if len(it.nodes) == 0 {
+			return DataNode{}, false, nil
+		}
+		node := it.nodes[0]
+		it.nodes = it.nodes[1:]
+		return node, true, nil
+	}
+
+	t := tree{table: it.disk, info: it.info}
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if it.desc {
+			if top.Slot == 0 {
+				it.stack = it.stack[:len(it.stack)-1]
+				continue
+			}
+			top.Slot--
+			node := top.Page.Data[top.Slot]
+			if !top.Page.Head.IsLeaf {
+				if err := it.pushEdge(t, top.Page.Chld[top.Slot]); err != nil {
+					return DataNode{}, false, err
+				}
+			}
+			return node, true, nil
+		}
+		if top.Slot == NumKeys(top.Page.Data) {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		node := top.Page.Data[top.Slot]
+		top.Slot++
+		if !top.Page.Head.IsLeaf {
+			if err := it.pushEdge(t, top.Page.Chld[top.Slot]); err != nil {
+				return DataNode{}, false, err
+			}
+		}
+		return node, true, nil
+	}
+	return DataNode{}, false, nil
+}
+
+// pushEdge pushes the path to the first row of the subtree at addr, the last row when
+// walking in descending order
+func (it *Iterator) pushEdge(t tree, addr int32) error {
+
+	for {
+		page, err := t.getPage(addr)
+		if err != nil {
+			return err
+		}
+		slot := 0
+		if it.desc {
+			slot = NumKeys(page.Data)
+		}
+		it.stack = append(it.stack, iterPos{Page: page, Slot: slot})
+		if page.Head.IsLeaf {
+			return nil
+		}
+		addr = page.Chld[slot]
+	}
+}
+
+// seek pushes the path to the first row in range, stopping early at an internal page
+// that holds the bound itself since its child on that side is all out of range
+func (it *Iterator) seek(t tree, addr int32, bound Key) error {
+
+	for {
+		page, err := t.getPage(addr)
+		if err != nil {
+			return err
+		}
+		numKeys := NumKeys(page.Data)
+		slot := sort.Search(numKeys, func(i int) bool {
+			if it.desc {
+				return CompareKeys(page.Data[i].key(), bound) > 0
+			}
+			return CompareKeys(page.Data[i].key(), bound) >= 0
+		})
+		it.stack = append(it.stack, iterPos{Page: page, Slot: slot})
+		if page.Head.IsLeaf {
+			return nil
+		}
+		if it.desc && slot > 0 && CompareKeys(page.Data[slot-1].key(), bound) == 0 ||
+			!it.desc && slot < numKeys && CompareKeys(page.Data[slot].key(), bound) == 0 {
+			return nil
+		}
+		addr = page.Chld[slot]
+	}
+}
+
+// bound is where the scan starts, from in ascending order and to in descending order
+func (it *Iterator) bound() Key {
+	if it.desc {
+		return it.to
+	}
+	return it.from
+}
+
+// reset drops the current position and finds the first row at or past bound. The
+// table may have been converted to the other type since the last position was taken.
+func (it *Iterator) reset(bound Key) error {
+
+	it.seen = it.disk.ChgCnt
+	it.stack, it.nodes = nil, nil
+	it.onTree = it.info.IsTree
+	if it.onTree {
+		return it.resetTree(bound)
+	}
+	return it.resetList(bound)
+}
+
+func (it *Iterator) resetTree(bound Key) error {
+
+	t := tree{table: it.disk, info: it.info}
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		return nil
+	}
+	if bound == nil {
+		return it.pushEdge(t, t.info.SrtOff)
+	}
+	return it.seek(t, t.info.SrtOff, bound)
+}
+
+// a list has to read every page, the rows in range are sorted up front
+func (it *Iterator) resetList(bound Key) error {
+
+	from, to := bound, it.to
+	if it.desc {
+		from, to = it.from, bound
+	}
+	t := it.disk
+	addr := it.info.SrtOff
+	for addr != 0 {
+		dsk, err := t.GetDiskData(addr)
+		if err != nil {
+			return err
+		}
+		lp := dsk.RecData.(ListPage)
+		for _, node := range lp.Data {
+			if IsNodeEmpty(node) ||
+				from != nil && CompareKeys(node.key(), from) < 0 ||
+				to != nil && CompareKeys(node.key(), to) > 0 {
+				continue
+			}
+			it.nodes = append(it.nodes, node)
+		}
+		if lp.Chld == -1 {
+			break
+		}
+		addr = lp.Chld
+	}
+	sort.Slice(it.nodes, func(i, j int) bool {
+		if it.desc {
+			return CompareKeys(it.nodes[i].key(), it.nodes[j].key()) > 0
+		}
+		return CompareKeys(it.nodes[i].key(), it.nodes[j].key()) < 0
+	})
+	return nil
+}
+
+func (t tree) Scan(from, to Key, desc bool) (*Iterator, error) {
+
+	it := &Iterator{disk: t.table, info: t.info, from: from, to: to, desc: desc, onTree: true}
+	if err := it.reset(it.bound()); err != nil {
+		return nil, fmt.Errorf("tree: Scan Error:%w", err)
+	}
+	return it, nil
+}
+
+func (t linear) Scan(from, to Key, desc bool) (*Iterator, error) {
+
+	it := &Iterator{disk: t.table, info: t.info, from: from, to: to, desc: desc}
+	if err := it.reset(it.bound()); err != nil {
+		return nil, fmt.Errorf("list: Scan error: %w", err)
+	}
+	return it, nil
+}
@@ -0,0 +1,144 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Key is a key encoded so that bytes.Compare orders it the way its key type does,
+// integers are stored big endian with the sign bit flipped. Files of version 1 held
+// plain int32 keys, an upgrade re-encodes them, see baselineNode.
+type Key []byte
+
+const (
+	KT_INT32 int8 = iota // zero, the key type of files from before it was recorded
+	KT_INT64
+	KT_STRING
+	KT_BYTES
+)
+
+var keyTypeNames = []string{"int32", "int64", "string", "bytes"}
+
+// KeyTypeByName maps the name used by create to a key type
+func KeyTypeByName(name string) (int8, error) {
+
+	for i, v := range keyTypeNames {
+		if strings.ToLower(name) == v {
+			return int8(i), nil
+		}
+	}
+	return 0, fmt.Errorf("KeyTypeByName error: unknown key type %s, allowed key types are %v", name, keyTypeNames)
+}
+
+func KeyTypeName(keyType int8) string {
+	if keyType < 0 || int(keyType) >= len(keyTypeNames) {
+		return fmt.Sprintf("unknown(%d)", keyType)
+	}
+	return keyTypeNames[keyType]
+}
+
+func Int32Key(v int32) Key {
+	return BINARY_ORDER.AppendUint32(nil, uint32(v)^1<<31)
+}
+
+func Int64Key(v int64) Key {
+	return BINARY_ORDER.AppendUint64(nil, uint64(v)^1<<63)
+}
+
+func CompareKeys(a, b Key) int {
+	return bytes.Compare(a, b)
+}
+
+// ParseKey reads a key typed on the command line, bytes keys are given in hex
+func (ti *TblInfo) ParseKey(text string) (Key, error) {
+
+	var key Key
+	switch ti.KeyTyp {
+	case KT_INT32:
+		v, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ParseKey error: invalid int32 key: %w", err)
+		}
+		return Int32Key(int32(v)), nil
+	case KT_INT64:
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ParseKey error: invalid int64 key: %w", err)
+		}
+		return Int64Key(v), nil
+	case KT_STRING:
+		key = Key(text)
+	case KT_BYTES:
+		buf, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("ParseKey error: invalid hex key: %w", err)
+		}
+		key = buf
+	default:
+		return nil, fmt.Errorf("ParseKey error: unknown key type %d", ti.KeyTyp)
+	}
+	if err := ti.checkKey(key); err != nil {
+		return nil, fmt.Errorf("ParseKey error: %w", err)
+	}
+	return key, nil
+}
+
+// FormatKey is the inverse of ParseKey
+func (ti *TblInfo) FormatKey(key Key) string {
+
+	switch {
+	case ti.KeyTyp == KT_INT32 && len(key) == 4:
+		return strconv.FormatInt(int64(int32(BINARY_ORDER.Uint32(key)^1<<31)), 10)
+	case ti.KeyTyp == KT_INT64 && len(key) == 8:
+		return strconv.FormatInt(int64(BINARY_ORDER.Uint64(key)^1<<63), 10)
+	case ti.KeyTyp == KT_STRING:
+		return string(key)
+	}
+	return "0x" + hex.EncodeToString(key)
+}
+
+// KeyValue decodes key into the value of a column, int64 for integer keys, string for
+// string keys and []byte for bytes keys
+func (ti *TblInfo) KeyValue(key Key) (any, error) {
+
+	if err := ti.checkKey(key); err != nil {
+		return nil, fmt.Errorf("KeyValue error: %w", err)
+	}
+	switch ti.KeyTyp {
+	case KT_INT32:
+		return int64(int32(BINARY_ORDER.Uint32(key) ^ 1<<31)), nil
+	case KT_INT64:
+		return int64(BINARY_ORDER.Uint64(key) ^ 1<<63), nil
+	case KT_STRING:
+		return string(key), nil
+	}
+	return []byte(string(key)), nil
+}
+
+// checkKey makes sure key is a valid encoding for the key type of the table
+func (ti *TblInfo) checkKey(key Key) error {
+
+	switch ti.KeyTyp {
+	case KT_INT32:
+		if len(key) != 4 {
+			return fmt.Errorf("int32 keys are 4 bytes, got %d", len(key))
+		}
+	case KT_INT64:
+		if len(key) != 8 {
+			return fmt.Errorf("int64 keys are 8 bytes, got %d", len(key))
+		}
+	default:
+		// an empty key with an empty value would look like a free slot
+		if len(key) == 0 || len(key) > KEY_SIZE {
+			return fmt.Errorf("%s keys are 1 to %d bytes, got %d", KeyTypeName(ti.KeyTyp), KEY_SIZE, len(key))
+		}
+	}
+	return nil
+}
+
+func (n DataNode) key() Key {
+	return n.Key[:n.KLen]
+}
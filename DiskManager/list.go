@@ -1,96 +1,87 @@
 package diskmanager
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
 )
 
-func (t *DiskManager) ResetCursor() error {
-	hdr, err := t.GetDBHeader()
-	if err != nil {
-		return fmt.Errorf("list: ResetCursor Error:%w", err)
-	}
-
-	t.Cursor = hdr.RootAddr
-	t.SrtOff = hdr.RootAddr
-	return nil
+type linear struct {
+	table *DiskManager
+	info  *TblInfo
 }
 
-func (t *DiskManager) Insert(key int32, val string) error {
+func (t linear) Insert(key Key, val string) error {
 
-	if len(val) > 32 {
-		return fmt.Errorf("list: Insert error: val size length is greater than 32")
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		node, err := t.table.newNode(key, val)
+		if err != nil {
+			return fmt.Errorf("list: Insert error: %w", err)
+		}
+		listPage := t.table.NewListPage()
+		listPage.Head.Parent = -1
+		listPage.Data[0] = node
+		listPage.Chld = -1
+		dsk, err := t.table.WrtDiskData(listPage)
+		if err != nil {
+			return fmt.Errorf("list: Insert error: %w", err)
+		}
+		if err := t.table.setRootAddr(t.info, dsk.RecHead.RecAddr); err != nil {
+			return fmt.Errorf("list: Insert error: %w", err)
+		}
+		return nil
 	}
 
-	buf := String2ByteArr(val)
-	t.Cursor = t.SrtOff
+	addr := t.info.SrtOff
 	for {
-		dsk, err := t.GetDiskData()
-		if errors.Is(err, io.EOF) {
-			break
-		}
+		dsk, err := t.table.GetDiskData(addr)
 		if err != nil {
 			return fmt.Errorf("list: Insert error: %w", err)
 		}
 		lp := dsk.RecData.(ListPage)
+		for i := 0; i < len(lp.Data); i++ {
+			if !IsNodeEmpty(lp.Data[i]) && CompareKeys(lp.Data[i].key(), key) == 0 {
+				return &DuplicateKeyError{Key: t.info.FormatKey(key)}
+			}
+		}
 		if lp.Chld == -1 {
 			break
 		}
-		t.Cursor = lp.Chld
+		addr = lp.Chld
 	}
 
-	dskData, err := t.GetDiskData()
-	if errors.Is(err, io.EOF) {
-		_, err := t.WrtDiskData(ListPage{
-			Head: ListHead{
-				Parent: -1,
-			},
-			Data: [MAX_KEYS]DataNode{{Key: key, Val: buf}},
-			Chld: -1,
-		})
-		if err != nil {
-			return fmt.Errorf("list: Insert error: %w", err)
-		}
-	} else if err != nil {
+	dskData, err := t.table.GetDiskData(addr)
+	if err != nil {
 		return fmt.Errorf("list: Insert error: %w", err)
 	} else {
 		nodes := dskData.RecData.(ListPage).Data
 		var ind int = -1
-		for i := 0; i < MAX_KEYS; i++ {
+		for i := 0; i < len(nodes); i++ {
 			if IsNodeEmpty(nodes[i]) {
 				ind = i
 				break
 			}
 		}
 		listPage := dskData.RecData.(ListPage)
+		node, err := t.table.newNode(key, val)
+		if err != nil {
+			return fmt.Errorf("list: Insert error: %w", err)
+		}
 		if ind != -1 {
-			listPage.Data[ind] = DataNode{
-				Key: key,
-				Val: buf,
-			}
+			listPage.Data[ind] = node
 		} else {
 
-			newNodes := [MAX_KEYS]DataNode{}
-			newNodes[0] = DataNode{
-				Key: key,
-				Val: buf,
-			}
-			dsk, err := t.WrtDiskData(ListPage{
-				Head: ListHead{
-					Parent: dskData.RecHead.RecAddr,
-				},
-				Data: newNodes,
-				Chld: -1,
-			})
-			listPage.Chld = dsk.RecHead.RecAddr
+			newPage := t.table.NewListPage()
+			newPage.Head.Parent = dskData.RecHead.RecAddr
+			newPage.Data[0] = node
+			newPage.Chld = -1
+			dsk, err := t.table.WrtDiskData(newPage)
 			if err != nil {
 				return fmt.Errorf("list: Insert error: %w", err)
 			}
-			fmt.Printf("List Node Inserted in disk:%+v", dsk)
+			listPage.Chld = dsk.RecHead.RecAddr
 		}
-		err := t.EdtDiskData(listPage)
+		err = t.table.EdtDiskData(addr, listPage)
 		if err != nil {
 			return fmt.Errorf("list: Insert error: %w", err)
 		}
@@ -98,52 +89,74 @@ func (t *DiskManager) Insert(key int32, val string) error {
 	return nil
 }
 
-func (t *DiskManager) Select(key int32) (string, error) {
+// Upsert inserts the key or, when it is already present, replaces its value
+func (t linear) Upsert(key Key, val string) error {
+
+	err := t.Insert(key, val)
+	if !errors.As(err, new(*DuplicateKeyError)) {
+		return err
+	}
+	return t.Update(key, val)
+}
+
+func (t linear) Select(key Key) (string, error) {
 
-	t.Cursor = t.SrtOff
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		return "", fmt.Errorf("list: Select error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
+	}
+	addr := t.info.SrtOff
 	for {
-		dsk, err := t.GetDiskData()
+		dsk, err := t.table.GetDiskData(addr)
 		if err != nil {
 			return "", fmt.Errorf("list: Select error: %w", err)
 		}
 		lp := dsk.RecData.(ListPage)
-		for i := 0; i < MAX_KEYS; i++ {
-			if lp.Data[i].Key == key {
-				return string(lp.Data[i].Val[:]), nil
+		for i := 0; i < len(lp.Data); i++ {
+			if !IsNodeEmpty(lp.Data[i]) && CompareKeys(lp.Data[i].key(), key) == 0 {
+				val, err := t.table.nodeVal(lp.Data[i])
+				if err != nil {
+					return "", fmt.Errorf("list: Select error: %w", err)
+				}
+				return val, nil
 			}
 		}
 		if lp.Chld == -1 {
 			break
 		}
-		t.Cursor = lp.Chld
+		addr = lp.Chld
 	}
-	return "", nil
+	return "", fmt.Errorf("list: Select error: %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 }
 
-func (t *DiskManager) Update(key int32, val string) error {
+func (t linear) Update(key Key, val string) error {
 
-	if len(val) > 32 {
-		return fmt.Errorf("list: Update error: val size length is greater than 32")
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		return fmt.Errorf("list: Update error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-
-	t.Cursor = t.SrtOff
+	addr := t.info.SrtOff
 	for {
-		dsk, err := t.GetDiskData()
+		dsk, err := t.table.GetDiskData(addr)
 		if err != nil {
 			return fmt.Errorf("list: Update error: %w", err)
 		}
 		lp := dsk.RecData.(ListPage)
-		isUpdated := false
-		for i := 0; i < MAX_KEYS; i++ {
-			if lp.Data[i].Key == key {
-				buf := String2ByteArr(val)
-				lp.Data[i].Val = buf
-				isUpdated = true
-				break
+		for i := 0; i < len(lp.Data); i++ {
+			if IsNodeEmpty(lp.Data[i]) || CompareKeys(lp.Data[i].key(), key) != 0 {
+				continue
 			}
-		}
-		if isUpdated {
-			err := t.EdtDiskData(lp)
+			node, err := t.table.newNode(key, val)
+			if err != nil {
+				return fmt.Errorf("list: Update error: %w", err)
+			}
+			oldNode := lp.Data[i]
+			lp.Data[i] = node
+			err = t.table.EdtDiskData(addr, lp)
+			if err != nil {
+				return fmt.Errorf("list: Update error: %w", err)
+			}
+			err = t.table.freeNode(oldNode)
 			if err != nil {
 				return fmt.Errorf("list: Update error: %w", err)
 			}
@@ -152,83 +165,80 @@ func (t *DiskManager) Update(key int32, val string) error {
 		if lp.Chld == -1 {
 			break
 		}
-		t.Cursor = lp.Chld
+		addr = lp.Chld
 
 	}
-	return fmt.Errorf("list: Update error: key not found")
+	return fmt.Errorf("list: Update error: %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 }
 
-func (t *DiskManager) Delete(key int32) error {
+func (t linear) Delete(key Key) error {
 
-	t.Cursor = t.SrtOff
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		return fmt.Errorf("list: Delete error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
+	}
+	addr := t.info.SrtOff
 	for {
-		dsk, err := t.GetDiskData()
+		dsk, err := t.table.GetDiskData(addr)
 		if err != nil {
 			return fmt.Errorf("list: Delete error: %w", err)
 		}
 		lp := dsk.RecData.(ListPage)
 		isDeleted := false
-		for i := 0; i < MAX_KEYS; i++ {
-			if lp.Data[i].Key == key {
+		for i := 0; i < len(lp.Data); i++ {
+			if !IsNodeEmpty(lp.Data[i]) && CompareKeys(lp.Data[i].key(), key) == 0 {
+				err = t.table.freeNode(lp.Data[i])
+				if err != nil {
+					return fmt.Errorf("list: Delete error: %w", err)
+				}
 				lp.Data[i] = DataNode{}
 				isDeleted = true
 				break
 			}
 		}
 		if isDeleted {
-			if IsNodesEmpty(lp.Data) {
+			// an emptied page is unlinked and freed, unless it is the only page left
+			if IsNodesEmpty(lp.Data) && (lp.Head.Parent != -1 || lp.Chld != -1) {
 				parentAddr := lp.Head.Parent
 				childAddr := lp.Chld
-				currentAddr := dsk.RecHead.RecAddr
 				if parentAddr != -1 {
-					t.Cursor = parentAddr
-					dskP, err := t.GetDiskData()
+					dskP, err := t.table.GetDiskData(parentAddr)
 					if err != nil {
 						return fmt.Errorf("list: Delete error: %w", err)
 					}
 					plp := dskP.RecData.(ListPage)
 					plp.Chld = childAddr
-					t.Cursor = parentAddr
-					err = t.EdtDiskData(plp)
+					err = t.table.EdtDiskData(parentAddr, plp)
 					if err != nil {
 						return fmt.Errorf("list: Delete error: %w", err)
 					}
 				} else {
-					head, err := t.GetDBHeader()
+					err := t.table.setRootAddr(t.info, childAddr)
 					if err != nil {
 						return fmt.Errorf("list: Delete error: %w", err)
 					}
-					head.RootAddr = childAddr
-					err = t.WrtDBHeader(*head)
-					if err != nil {
-						return fmt.Errorf("list: Delete error: %w", err)
-					}
-					t.SrtOff = childAddr
 				}
 
 				if childAddr != -1 {
-					t.Cursor = childAddr
-					dskC, err := t.GetDiskData()
+					dskC, err := t.table.GetDiskData(childAddr)
 					if err != nil {
 						return fmt.Errorf("list: Delete error: %w", err)
 					}
 					clp := dskC.RecData.(ListPage)
 					clp.Head.Parent = parentAddr
-					t.Cursor = childAddr
-					err = t.EdtDiskData(clp)
+					err = t.table.EdtDiskData(childAddr, clp)
 					if err != nil {
 						return fmt.Errorf("list: Delete error: %w", err)
 					}
 				}
 
-				t.Cursor = currentAddr
-				err = t.DelDiskData()
+				err = t.table.DelDiskData(addr)
 				if err != nil {
 					return fmt.Errorf("list: Delete error: %w", err)
 				}
 				return nil
 			}
-			err = t.EdtDiskData(lp)
+			err = t.table.EdtDiskData(addr, lp)
 			if err != nil {
 				return fmt.Errorf("list: Delete error: %w", err)
 			}
@@ -237,31 +247,13 @@ func (t *DiskManager) Delete(key int32) error {
 		if lp.Chld == -1 {
 			break
 		}
-		t.Cursor = lp.Chld
+		addr = lp.Chld
 	}
-	return fmt.Errorf("list: Delete error: key not found")
+	return fmt.Errorf("list: Delete error: %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 
 }
 
-func (t *DiskManager) SelectAll() error {
-
-	t.Cursor = t.SrtOff
-	for {
-		dsk, err := t.GetDiskData()
-		if err != nil {
-			return fmt.Errorf("list: Select error: %s", err.Error())
-		}
-		lp := dsk.RecData.(ListPage)
-		for i := 0; i < MAX_KEYS; i++ {
-			if !IsNodeEmpty(lp.Data[i]) {
-				fmt.Printf("key: %d , Value: %s\n", lp.Data[i].Key, string(bytes.TrimRight(lp.Data[i].Val[:], "\x00")))
-			}
-		}
-		if lp.Chld == -1 {
-			break
-		}
-		t.Cursor = lp.Chld
-
-	}
-	return nil
+// SelectAll returns an iterator over every row in key order
+func (t linear) SelectAll() (*Iterator, error) {
+	return t.Scan(nil, nil, false)
 }
@@ -0,0 +1,41 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when another process kept the database locked for longer than
+// the busy timeout
+var ErrLocked = errors.New("database is locked")
+
+// ErrReadOnly is returned by every write to a database opened read only
+var ErrReadOnly = errors.New("database is read only")
+
+// lockDatabase takes the advisory lock of a database, shared by any number of readers or
+// held by a single writer. It is taken on the log, which unlike the database file is
+// never replaced by a vacuum. A reader of a database without a log locks the database
+// file instead, which a writer locks as well. A busy lock is retried until timeout has
+// passed.
+func lockDatabase(file *os.File, exclusive bool, timeout time.Duration) error {
+
+	deadline := time.Now().Add(timeout)
+	wait := time.Millisecond
+	for {
+		busy, err := tryLock(file, exclusive)
+		if err != nil {
+			return fmt.Errorf("lockDatabase error: %w", err)
+		}
+		if !busy {
+			return nil
+		}
+		left := time.Until(deadline)
+		if left <= 0 {
+			return fmt.Errorf("%w, gave up after %s", ErrLocked, timeout)
+		}
+		time.Sleep(min(wait, left))
+		wait = min(wait*2, 100*time.Millisecond)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// there is no file locking to keep other processes out, a database is not opened at all
+// rather than opened unprotected
+func tryLock(file *os.File, exclusive bool) (bool, error) {
+	return false, fmt.Errorf("no file locking on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
@@ -0,0 +1,93 @@
+//go:build unix || windows
+
+package diskmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flock and LockFileEx locks belong to the open file, two opens in one process contend
+// like two processes would
+func TestDatabaseLock(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "locked")
+	if err := CreateDatabaseAt(path, "tree", 0, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := OpenDatabaseAt(path, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDatabaseAt(path, false, 20*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second writer: expected ErrLocked, got %v", err)
+	}
+	if _, err := OpenDatabaseAt(path, true, 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("reader next to a writer: expected ErrLocked, got %v", err)
+	}
+
+	// a waiting open gets the lock once the holder lets go
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		writer.Close()
+	}()
+	readers := make([]*DiskManager, 2)
+	for i := range readers {
+		readers[i], err = OpenDatabaseAt(path, true, time.Second)
+		if err != nil {
+			t.Fatalf("reader %d: %v", i, err)
+		}
+		defer readers[i].Close()
+	}
+	if _, err := OpenDatabaseAt(path, false, 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("writer next to readers: expected ErrLocked, got %v", err)
+	}
+	table, err := InitTable(readers[0], "locked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Insert(Int32Key(1), "one"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("insert on a reader: expected ErrReadOnly, got %v", err)
+	}
+	if _, err := readers[0].Vacuum(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("vacuum on a reader: expected ErrReadOnly, got %v", err)
+	}
+}
+
+// a reader never creates the log, without one it locks the database file against writers
+func TestReadOnlyWithoutLog(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "nolog")
+	if err := CreateDatabaseAt(path, "tree", 0, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenDatabaseAt(path, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + WAL_SUFFIX); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("a read only open created the log: %v", err)
+	}
+	if _, err := OpenDatabaseAt(path, false, 20*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("writer next to a reader without a log: expected ErrLocked, got %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a vacuum replaces the locked file and locks the new one
+	writer, err := OpenDatabaseAt(path, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if _, err := writer.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package diskmanager
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock reports busy instead of blocking when another open file holds the lock
+func tryLock(file *os.File, exclusive bool) (bool, error) {
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return false, nil
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return true, nil
+		case !errors.Is(err, syscall.EINTR):
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package diskmanager
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// tryLock reports busy instead of blocking when another open handle holds the lock.
+// Windows locks keep other handles from reading and writing the range, so the lock is
+// taken on a byte far past anything the log or the database file ever holds.
+func tryLock(file *os.File, exclusive bool) (bool, error) {
+
+	flags := uint32(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	overlapped := &syscall.Overlapped{OffsetHigh: 0x40000000}
+	ok, _, err := procLockFileEx.Call(file.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	switch {
+	case ok != 0:
+		return false, nil
+	case errors.Is(err, errorLockViolation):
+		return true, nil
+	default:
+		return false, err
+	}
+}
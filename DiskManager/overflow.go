@@ -0,0 +1,106 @@
+package diskmanager
+
+import "fmt"
+
+// newNode builds the slot for key, a value longer than INLINE_VAL_LEN is first written
+// out to a chain of overflow pages. The key type is checked by the table, the slot only
+// bounds the key length.
+func (d *DiskManager) newNode(key Key, val string) (DataNode, error) {
+
+	// an empty key with an empty value would look like a free slot
+	if len(key) == 0 || len(key) > KEY_SIZE {
+		return DataNode{}, fmt.Errorf("newNode error: keys are 1 to %d bytes, got %d", KEY_SIZE, len(key))
+	}
+	node := DataNode{KLen: uint8(len(key)), Size: int32(len(val))}
+	copy(node.Key[:], key)
+	if len(val) <= INLINE_VAL_LEN {
+		copy(node.Val[:], val)
+		return node, nil
+	}
+	addr, err := d.writeChain(val)
+	if err != nil {
+		return DataNode{}, fmt.Errorf("newNode error: %w", err)
+	}
+	node.Ovfl = addr
+	return node, nil
+}
+
+// nodeVal returns the exact value stored in the slot, following its overflow chain
+func (d *DiskManager) nodeVal(node DataNode) (string, error) {
+
+	if node.Ovfl == 0 {
+		return string(node.Val[:node.Size]), nil
+	}
+	val, err := d.readChain(node.Ovfl, node.Size)
+	if err != nil {
+		return "", fmt.Errorf("nodeVal error: key 0x%x: %w", []byte(node.key()), err)
+	}
+	return val, nil
+}
+
+// writeChain stores val in a chain of overflow pages and returns the address of the first
+func (d *DiskManager) writeChain(val string) (int32, error) {
+
+	// the chain is written back to front so every page already knows its successor
+	chunk := d.ovflCap()
+	var next int32
+	for end := len(val); end > 0; end -= chunk {
+		start := max(end-chunk, 0)
+		page := d.NewOvflPage()
+		page.Head = OvflHead{Next: next, Size: int32(end - start)}
+		copy(page.Data, val[start:end])
+		dsk, err := d.WrtDiskData(page)
+		if err != nil {
+			return 0, fmt.Errorf("writeChain error: %w", err)
+		}
+		next = dsk.RecHead.RecAddr
+	}
+	return next, nil
+}
+
+// readChain reads back the size bytes written by writeChain
+func (d *DiskManager) readChain(addr int32, size int32) (string, error) {
+
+	val := make([]byte, 0, size)
+	for addr != 0 {
+		page, err := d.getOvflPage(addr)
+		if err != nil {
+			return "", fmt.Errorf("readChain error: %w", err)
+		}
+		val = append(val, page.Data[:page.Head.Size]...)
+		addr = page.Head.Next
+	}
+	if len(val) != int(size) {
+		return "", fmt.Errorf("readChain error: value has %d bytes, expected %d", len(val), size)
+	}
+	return string(val), nil
+}
+
+// freeNode releases the overflow chain of a slot that is being removed or overwritten
+func (d *DiskManager) freeNode(node DataNode) error {
+
+	for addr := node.Ovfl; addr != 0; {
+		page, err := d.getOvflPage(addr)
+		if err != nil {
+			return fmt.Errorf("freeNode error: %w", err)
+		}
+		if err := d.DelDiskData(addr); err != nil {
+			return fmt.Errorf("freeNode error: %w", err)
+		}
+		addr = page.Head.Next
+	}
+	return nil
+}
+
+func (d *DiskManager) getOvflPage(addr int32) (OvflPage, error) {
+
+	dsk, err := d.GetDiskData(addr)
+	if err != nil {
+		return OvflPage{}, err
+	}
+	page, ok := dsk.RecData.(OvflPage)
+	if !ok || dsk.RecHead.Deleted {
+		return OvflPage{}, fmt.Errorf("record %d is not a live overflow page", addr)
+	}
+	return page, nil
+}
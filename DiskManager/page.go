@@ -0,0 +1,144 @@
+package diskmanager
+
+import "fmt"
+
+// MaxKeys is the number of key slots in every page of the database
+func (d *DiskManager) MaxKeys() int {
+	return d.Fanout - 1
+}
+
+// MinKeys is the fewest keys a tree page other than the root may hold
+func (d *DiskManager) MinKeys() int {
+	return (d.Fanout+1)/2 - 1
+}
+
+func (d *DiskManager) NewTreePage() TreePage {
+	return TreePage{
+		Data: make([]DataNode, d.MaxKeys()),
+		Chld: make([]int32, d.Fanout),
+	}
+}
+
+func (d *DiskManager) NewListPage() ListPage {
+	return ListPage{
+		Data: make([]DataNode, d.MaxKeys()),
+	}
+}
+
+func TreePageSize(order int) int {
+	return TREE_HEAD_SIZE + (order-1)*DATA_NODE_SIZE + order*4
+}
+
+func ListPageSize(order int) int {
+	return LIST_HEAD_SIZE + (order-1)*DATA_NODE_SIZE + 4
+}
+
+// OrderForPageSize returns the largest fanout whose pages fit in pageSize bytes, list
+// pages are padded to the size of tree pages so both fit in the same records
+func OrderForPageSize(pageSize int) int {
+
+	order := MIN_TREE_ORDER
+	for order < MAX_TREE_ORDER && HEADER_SIZE+TreePageSize(order+1) <= pageSize {
+		order++
+	}
+	return order
+}
+
+// filePageSize is the payload size of every record of a file. Files from before
+// tables could share a file size them after the type of their one table.
+func filePageSize(head *TableHeader, order int) int {
+	if head.Flags&FL_TREE_SIZED != 0 || !head.IsLinear {
+		return TreePageSize(order)
+	}
+	return ListPageSize(order)
+}
+
+// ovflCap is how many value bytes fit in one overflow page
+func (d *DiskManager) ovflCap() int {
+	return d.PgSize - OVFL_HEAD_SIZE
+}
+
+// dirCap is how many tables one directory page lists
+func (d *DiskManager) dirCap() int {
+	return (d.PgSize - DIR_HEAD_SIZE) / DIR_ENTRY_SIZE
+}
+
+func (d *DiskManager) NewDirPage() DirPage {
+	return DirPage{
+		Ents: make([]DirEntry, d.dirCap()),
+	}
+}
+
+func (d *DiskManager) NewOvflPage() OvflPage {
+	return OvflPage{
+		Data: make([]byte, d.ovflCap()),
+	}
+}
+
+// diskDataSize is the full on disk size, header included, of a record. Every record of
+// a file has the same size whatever its type.
+func (d *DiskManager) diskDataSize() int {
+	return d.hdrSize() + d.PgSize
+}
+
+// checkPage makes sure a page about to be written has the slot counts of this database
+func (d *DiskManager) checkPage(data interface{}) error {
+
+	switch page := data.(type) {
+	case TreePage:
+		if len(page.Data) != d.MaxKeys() || len(page.Chld) != d.Fanout {
+			return fmt.Errorf("tree page has %d keys and %d children, expected %d and %d",
+				len(page.Data), len(page.Chld), d.MaxKeys(), d.Fanout)
+		}
+	case ListPage:
+		if len(page.Data) != d.MaxKeys() {
+			return fmt.Errorf("list page has %d keys, expected %d", len(page.Data), d.MaxKeys())
+		}
+	case OvflPage:
+		if len(page.Data) != d.ovflCap() {
+			return fmt.Errorf("overflow page holds %d bytes, expected %d", len(page.Data), d.ovflCap())
+		}
+	case DirPage:
+		if len(page.Ents) != d.dirCap() {
+			return fmt.Errorf("directory page has %d entries, expected %d", len(page.Ents), d.dirCap())
+		}
+	}
+	return nil
+}
+
+func (p TreePage) Clone() TreePage {
+	p.Data = append([]DataNode(nil), p.Data...)
+	p.Chld = append([]int32(nil), p.Chld...)
+	return p
+}
+
+func (p ListPage) Clone() ListPage {
+	p.Data = append([]DataNode(nil), p.Data...)
+	return p
+}
+
+func (p OvflPage) Clone() OvflPage {
+	p.Data = append([]byte(nil), p.Data...)
+	return p
+}
+
+func (p DirPage) Clone() DirPage {
+	p.Ents = append([]DirEntry(nil), p.Ents...)
+	return p
+}
+
+// cloneDiskData deep copies the page so callers never share slices with the cache
+func cloneDiskData(data DiskData) DiskData {
+
+	switch page := data.RecData.(type) {
+	case TreePage:
+		data.RecData = page.Clone()
+	case ListPage:
+		data.RecData = page.Clone()
+	case OvflPage:
+		data.RecData = page.Clone()
+	case DirPage:
+		data.RecData = page.Clone()
+	}
+	return data
+}
@@ -0,0 +1,471 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// column types of a table made by create table, the Go type a row holds for each is
+// int64, string, float64, []byte and bool, nil is NULL
+const (
+	CT_INTEGER int8 = iota + 1
+	CT_TEXT
+	CT_REAL
+	CT_BLOB
+	CT_BOOLEAN
+)
+
+var columnTypeNames = []string{"", "integer", "text", "real", "blob", "boolean"}
+
+type Column struct {
+	Name    string
+	Type    int8 // one of the CT_ constants
+	PrimKey bool // the column is the key of the tree, exactly one column has it
+}
+
+// Schema is what the catalog pages of a database hold
+type Schema struct {
+	Name    string
+	Columns []Column
+}
+
+// ColumnTypeByName maps the name used by create table to a column type
+func ColumnTypeByName(name string) (int8, error) {
+
+	for i, v := range columnTypeNames[1:] {
+		if strings.ToLower(name) == v {
+			return int8(i + 1), nil
+		}
+	}
+	return 0, fmt.Errorf("ColumnTypeByName error: unknown column type %s, allowed column types are %v", name, columnTypeNames[1:])
+}
+
+func ColumnTypeName(colType int8) string {
+	if colType < CT_INTEGER || int(colType) >= len(columnTypeNames) {
+		return fmt.Sprintf("unknown(%d)", colType)
+	}
+	return columnTypeNames[colType]
+}
+
+// keyTypeOf is the key type of a tree keyed by a column of colType
+func keyTypeOf(colType int8) (int8, error) {
+
+	switch colType {
+	case CT_INTEGER:
+		return KT_INT64, nil
+	case CT_TEXT:
+		return KT_STRING, nil
+	case CT_BLOB:
+		return KT_BYTES, nil
+	}
+	return 0, fmt.Errorf("a %s column cannot be the primary key, use integer, text or blob", ColumnTypeName(colType))
+}
+
+// PrimKey is the index of the primary key column
+func (s *Schema) PrimKey() int {
+
+	for i, col := range s.Columns {
+		if col.PrimKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// Column is the index of the column called name, -1 when there is none
+func (s *Schema) Column(name string) int {
+
+	for i, col := range s.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// String is the create table statement of the schema
+func (s *Schema) String() string {
+
+	cols := make([]string, len(s.Columns))
+	for i, col := range s.Columns {
+		cols[i] = col.Name + " " + ColumnTypeName(col.Type)
+		if col.PrimKey {
+			cols[i] += " primary key"
+		}
+	}
+	return fmt.Sprintf("create table %s (%s)", s.Name, strings.Join(cols, ", "))
+}
+
+func (s *Schema) check() error {
+
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("table %s has no columns", s.Name)
+	}
+	primKeys := 0
+	for i, col := range s.Columns {
+		if col.Name == "" || len(col.Name) >= 32 {
+			return fmt.Errorf("column names are 1 to 31 bytes, got %q", col.Name)
+		}
+		if s.Column(col.Name) != i {
+			return fmt.Errorf("duplicate column %s", col.Name)
+		}
+		if col.Type < CT_INTEGER || col.Type > CT_BOOLEAN {
+			return fmt.Errorf("column %s has invalid type %d", col.Name, col.Type)
+		}
+		if col.PrimKey {
+			primKeys++
+			if _, err := keyTypeOf(col.Type); err != nil {
+				return fmt.Errorf("column %s: %w", col.Name, err)
+			}
+		}
+	}
+	if primKeys != 1 {
+		return fmt.Errorf("table %s needs exactly one primary key column, got %d", s.Name, primKeys)
+	}
+	return nil
+}
+
+// encodeSchema lays out the name and then every column as its name, type and flags,
+// names are prefixed by their length
+func encodeSchema(s *Schema) string {
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte(uint8(len(s.Name)))
+	buf.WriteString(s.Name)
+	binary.Write(buf, BINARY_ORDER, uint16(len(s.Columns)))
+	for _, col := range s.Columns {
+		buf.WriteByte(uint8(len(col.Name)))
+		buf.WriteString(col.Name)
+		buf.WriteByte(byte(col.Type))
+		var flags uint8
+		if col.PrimKey {
+			flags |= 1
+		}
+		buf.WriteByte(flags)
+	}
+	return buf.String()
+}
+
+func decodeSchema(enc string) (*Schema, error) {
+
+	reader := strings.NewReader(enc)
+	readName := func() (string, error) {
+		n, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(reader, name); err != nil {
+			return "", err
+		}
+		return string(name), nil
+	}
+
+	s := &Schema{}
+	var err error
+	if s.Name, err = readName(); err != nil {
+		return nil, fmt.Errorf("decodeSchema error: %w", err)
+	}
+	var count uint16
+	if err := binary.Read(reader, BINARY_ORDER, &count); err != nil {
+		return nil, fmt.Errorf("decodeSchema error: %w", err)
+	}
+	for range count {
+		var col Column
+		var fields [2]byte
+		if col.Name, err = readName(); err != nil {
+			return nil, fmt.Errorf("decodeSchema error: %w", err)
+		}
+		if _, err := io.ReadFull(reader, fields[:]); err != nil {
+			return nil, fmt.Errorf("decodeSchema error: %w", err)
+		}
+		col.Type = int8(fields[0])
+		col.PrimKey = fields[1]&1 != 0
+		s.Columns = append(s.Columns, col)
+	}
+	if err := s.check(); err != nil {
+		return nil, fmt.Errorf("decodeSchema error: %w", err)
+	}
+	return s, nil
+}
+
+// CreateTable creates a tree database whose rows have the given columns, the
+// primary key column is the key of the tree. order 0 picks TREE_ORDER.
+func CreateTable(dbname string, columns []Column, order int) error {
+	return CreateTableAt(DB_FOLDER+"/"+dbname, columns, order)
+}
+
+// CreateTableAt is CreateTable for a file outside DB_FOLDER
+func CreateTableAt(dbFile string, columns []Column, order int) error {
+
+	schema := &Schema{Name: filepath.Base(dbFile), Columns: columns}
+	if err := schema.check(); err != nil {
+		return fmt.Errorf("CreateTable error: %w", err)
+	}
+	keyType, _ := keyTypeOf(columns[schema.PrimKey()].Type)
+	if err := CreateDatabaseAt(dbFile, "tree", order, keyType); err != nil {
+		return fmt.Errorf("CreateTable error: %w", err)
+	}
+	d, err := OpenDatabaseAt(dbFile, false, BUSY_TIMEOUT)
+	if err == nil {
+		err = errors.Join(d.setCatalog(schema), d.Close())
+	}
+	if err != nil {
+		// a table without its catalog would pass for a key value database
+		os.Remove(dbFile)
+		os.Remove(dbFile + WAL_SUFFIX)
+		return fmt.Errorf("CreateTable error: %w", err)
+	}
+	return nil
+}
+
+// setCatalog gives the table in the file header its columns
+func (d *DiskManager) setCatalog(schema *Schema) error {
+
+	err := loggedTable{disk: d}.logged(func() error {
+		addr, size, err := d.writeCatalog(schema)
+		if err != nil {
+			return err
+		}
+		head, err := d.GetDBHeader()
+		if err != nil {
+			return err
+		}
+		head.CtlgAddr, head.CtlgSize = addr, size
+		return d.WrtDBHeader(*head)
+	})
+	if err != nil {
+		return fmt.Errorf("setCatalog error: %w", err)
+	}
+	d.TblLst[0].TblSch = schema
+	return nil
+}
+
+// writeCatalog stores the schema in a chain of pages and returns where and how long it is
+func (d *DiskManager) writeCatalog(schema *Schema) (int32, int32, error) {
+
+	enc := encodeSchema(schema)
+	addr, err := d.writeChain(enc)
+	if err != nil {
+		return 0, 0, fmt.Errorf("writeCatalog error: %w", err)
+	}
+	return addr, int32(len(enc)), nil
+}
+
+func (d *DiskManager) readCatalog(addr int32, size int32) (*Schema, error) {
+
+	enc, err := d.readChain(addr, size)
+	if err != nil {
+		return nil, fmt.Errorf("readCatalog error: %w", err)
+	}
+	schema, err := decodeSchema(enc)
+	if err != nil {
+		return nil, fmt.Errorf("readCatalog error: %w", err)
+	}
+	return schema, nil
+}
+
+// ParseValue reads a value typed on the command line for a column of colType, blobs
+// are given in hex
+func ParseValue(colType int8, text string) (any, error) {
+
+	switch colType {
+	case CT_INTEGER:
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ParseValue error: invalid integer: %w", err)
+		}
+		return v, nil
+	case CT_TEXT:
+		return text, nil
+	case CT_REAL:
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ParseValue error: invalid real: %w", err)
+		}
+		return v, nil
+	case CT_BLOB:
+		v, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("ParseValue error: invalid hex blob: %w", err)
+		}
+		return v, nil
+	case CT_BOOLEAN:
+		v, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("ParseValue error: invalid boolean: %w", err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("ParseValue error: unknown column type %d", colType)
+}
+
+// FormatValue is the inverse of ParseValue, NULL for nil
+func FormatValue(v any) string {
+
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// EncodeRow splits a row of the table into its key and the record stored as the value.
+// The record holds every other column in order as a tag, the column type or 0 for
+// NULL, followed by 8 bytes for integers and reals, 1 for booleans and a varint length
+// and the bytes for text and blobs.
+func (ti *TblInfo) EncodeRow(row []any) (Key, string, error) {
+
+	if ti.TblSch == nil {
+		return nil, "", fmt.Errorf("EncodeRow error: table %s has no columns", ti.TblNam)
+	}
+	cols := ti.TblSch.Columns
+	if len(row) != len(cols) {
+		return nil, "", fmt.Errorf("EncodeRow error: table %s has %d columns, got %d values", ti.TblNam, len(cols), len(row))
+	}
+
+	var key Key
+	buf := new(bytes.Buffer)
+	for i, col := range cols {
+		v := row[i]
+		if v == nil {
+			if col.PrimKey {
+				return nil, "", fmt.Errorf("EncodeRow error: primary key %s cannot be NULL", col.Name)
+			}
+			buf.WriteByte(0)
+			continue
+		}
+		var enc []byte
+		switch v := v.(type) {
+		case int64:
+			if col.Type == CT_INTEGER {
+				enc = BINARY_ORDER.AppendUint64(nil, uint64(v))
+			}
+		case float64:
+			if col.Type == CT_REAL {
+				enc = BINARY_ORDER.AppendUint64(nil, math.Float64bits(v))
+			}
+		case bool:
+			if col.Type == CT_BOOLEAN {
+				enc = []byte{0}
+				if v {
+					enc[0] = 1
+				}
+			}
+		case string:
+			if col.Type == CT_TEXT {
+				enc = binary.AppendUvarint(nil, uint64(len(v)))
+				enc = append(enc, v...)
+			}
+		case []byte:
+			if col.Type == CT_BLOB {
+				enc = binary.AppendUvarint(nil, uint64(len(v)))
+				enc = append(enc, v...)
+			}
+		}
+		if enc == nil {
+			return nil, "", fmt.Errorf("EncodeRow error: column %s is %s, got %T", col.Name, ColumnTypeName(col.Type), v)
+		}
+		if col.PrimKey {
+			switch v := v.(type) {
+			case int64:
+				key = Int64Key(v)
+			case string:
+				key = Key(v)
+			case []byte:
+				key = Key(v)
+			}
+			if err := ti.checkKey(key); err != nil {
+				return nil, "", fmt.Errorf("EncodeRow error: primary key %s: %w", col.Name, err)
+			}
+			continue
+		}
+		buf.WriteByte(byte(col.Type))
+		buf.Write(enc)
+	}
+	return key, buf.String(), nil
+}
+
+// DecodeRow is the inverse of EncodeRow
+func (ti *TblInfo) DecodeRow(key Key, val string) ([]any, error) {
+
+	if ti.TblSch == nil {
+		return nil, fmt.Errorf("DecodeRow error: table %s has no columns", ti.TblNam)
+	}
+	row := make([]any, len(ti.TblSch.Columns))
+	reader := strings.NewReader(val)
+	for i, col := range ti.TblSch.Columns {
+		if col.PrimKey {
+			v, err := ti.KeyValue(key)
+			if err != nil {
+				return nil, fmt.Errorf("DecodeRow error: %w", err)
+			}
+			row[i] = v
+			continue
+		}
+		tag, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("DecodeRow error: key %s: record ends before column %s", ti.FormatKey(key), col.Name)
+		}
+		if tag == 0 {
+			continue
+		}
+		if int8(tag) != col.Type {
+			return nil, fmt.Errorf("DecodeRow error: key %s: column %s holds type %d", ti.FormatKey(key), col.Name, tag)
+		}
+		switch col.Type {
+		case CT_INTEGER, CT_REAL:
+			var bits uint64
+			err = binary.Read(reader, BINARY_ORDER, &bits)
+			if col.Type == CT_INTEGER {
+				row[i] = int64(bits)
+			} else {
+				row[i] = math.Float64frombits(bits)
+			}
+		case CT_BOOLEAN:
+			var b byte
+			b, err = reader.ReadByte()
+			row[i] = b != 0
+		case CT_TEXT, CT_BLOB:
+			var n uint64
+			if n, err = binary.ReadUvarint(reader); err != nil {
+				break
+			}
+			if n > uint64(reader.Len()) {
+				err = fmt.Errorf("length %d past the end of the record", n)
+				break
+			}
+			data := make([]byte, n)
+			reader.Read(data)
+			if col.Type == CT_TEXT {
+				row[i] = string(data)
+			} else {
+				row[i] = data
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("DecodeRow error: key %s: column %s: %w", ti.FormatKey(key), col.Name, err)
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("DecodeRow error: key %s: %d bytes left after the last column", ti.FormatKey(key), reader.Len())
+	}
+	return row, nil
+}
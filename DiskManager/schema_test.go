@@ -0,0 +1,89 @@
+package diskmanager
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTableRows(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users")
+	columns := []Column{
+		{Name: "name", Type: CT_TEXT},
+		{Name: "id", Type: CT_INTEGER, PrimKey: true},
+		{Name: "score", Type: CT_REAL},
+		{Name: "admin", Type: CT_BOOLEAN},
+		{Name: "pic", Type: CT_BLOB},
+	}
+	if err := CreateTableAt(path, columns, 0); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]any{
+		{"alice", int64(-3), 9.5, true, []byte{0xde, 0xad}},
+		{"a name long enough to move the record to overflow pages", int64(7), nil, false, nil},
+		{"", int64(1 << 40), -0.25, nil, []byte{}},
+	}
+
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := InitTable(d, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := d.Tables()[0]
+	for _, row := range rows {
+		key, val, err := ti.EncodeRow(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := table.Insert(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := ti.EncodeRow([]any{"x", nil, 1.0, true, nil}); err == nil {
+		t.Fatal("expected an error for a NULL primary key")
+	}
+	if _, _, err := ti.EncodeRow([]any{"x", int64(1), "1.0", true, nil}); err == nil {
+		t.Fatal("expected an error for text in a real column")
+	}
+	if _, err := d.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	// the schema is read back from the catalog, after the vacuum moved it
+	d, err = InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if table, err = InitTable(d, "users"); err != nil {
+		t.Fatal(err)
+	}
+	ti = d.Tables()[0]
+	if want := (&Schema{Name: "users", Columns: columns}); !reflect.DeepEqual(ti.TblSch, want) {
+		t.Fatalf("schema: got %v, want %v", ti.TblSch, want)
+	}
+	it, err := table.SelectAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range rows {
+		if !it.Next() {
+			t.Fatalf("missing row %v: %v", want, it.Err())
+		}
+		got, err := ti.DecodeRow(it.Key(), it.Value())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row: got %v, want %v", got, want)
+		}
+	}
+	if it.Next() {
+		t.Fatalf("unexpected row %s", ti.FormatKey(it.Key()))
+	}
+}
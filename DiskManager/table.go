@@ -1,21 +1,198 @@
 package diskmanager
 
+import (
+	"errors"
+	"fmt"
+)
+
+// Table is safe for concurrent use, lookups and scans run side by side while every
+// write waits for the others to finish
 type Table interface {
-	ResetCursor() error
-	Insert(key int32, val string) error
-	Select(key int32) (string, error)
-	Delete(key int32) error
-	Update(key int32, val string) error
-	SelectAll() error
-}
-
-// Compulsary initdb before initTable else it might cause some bugs
-func InitTable(d *DiskManager) Table {
-	if d.IsTree {
-		d.Cursor = d.SrtOff
+	Insert(key Key, val string) error
+	Upsert(key Key, val string) error
+	Select(key Key) (string, error)
+	Delete(key Key) error
+	Update(key Key, val string) error
+	SelectAll() (*Iterator, error)
+	Scan(from, to Key, desc bool) (*Iterator, error)
+}
+
+// returned by Insert when the key is already present in the table
+type DuplicateKeyError struct {
+	Key string // formatted for the key type of the table
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %s", e.Key)
+}
+
+// ErrKeyNotFound matches every KeyNotFoundError with errors.Is
+var ErrKeyNotFound = errors.New("key not found")
+
+// returned by Select, Update and Delete when the key is not in the table
+type KeyNotFoundError struct {
+	Key string // formatted for the key type of the table
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key %s not found", e.Key)
+}
+
+func (e *KeyNotFoundError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
+
+// loggedTable runs every mutating call as one write-ahead logged operation, so a
+// crash half way through a split or merge never leaves the file inconsistent. It is
+// also where the table takes the lock of the database. The tree or list underneath
+// is looked up on every call, a table converted by SetTableType stays usable.
+type loggedTable struct {
+	disk *DiskManager
+	info *TblInfo
+}
+
+func (l loggedTable) plain() Table {
+	return l.disk.plainTable(l.info)
+}
+
+func (l loggedTable) logged(op func() error) error {
+
+	if err := l.disk.writable(); err != nil {
+		return err
+	}
+	l.disk.MuLock.Lock()
+	defer l.disk.MuLock.Unlock()
+	l.disk.BeginOp()
+	err := op()
+	if err != nil {
+		if abortErr := l.disk.AbortOp(); abortErr != nil {
+			return fmt.Errorf("%w (abort error: %s)", err, abortErr.Error())
+		}
+		return err
+	}
+	return l.disk.CommitOp()
+}
+
+func (l loggedTable) Insert(key Key, val string) error {
+	if err := l.info.checkKey(key); err != nil {
+		return fmt.Errorf("Insert error: %w", err)
+	}
+	return l.logged(func() error {
+		if err := l.plain().Insert(key, val); err != nil {
+			return err
+		}
+		return l.disk.reindex(l.info, key, nil, &val)
+	})
+}
+
+func (l loggedTable) Upsert(key Key, val string) error {
+	if err := l.info.checkKey(key); err != nil {
+		return fmt.Errorf("Upsert error: %w", err)
+	}
+	return l.logged(func() error {
+		old, err := l.indexed(key)
+		if err != nil {
+			return err
+		}
+		if err := l.plain().Upsert(key, val); err != nil {
+			return err
+		}
+		return l.disk.reindex(l.info, key, old, &val)
+	})
+}
+
+func (l loggedTable) Delete(key Key) error {
+	return l.logged(func() error {
+		old, err := l.indexed(key)
+		if err != nil {
+			return err
+		}
+		if err := l.plain().Delete(key); err != nil {
+			return err
+		}
+		return l.disk.reindex(l.info, key, old, nil)
+	})
+}
+
+func (l loggedTable) Update(key Key, val string) error {
+	return l.logged(func() error {
+		old, err := l.indexed(key)
+		if err != nil {
+			return err
+		}
+		if err := l.plain().Update(key, val); err != nil {
+			return err
+		}
+		return l.disk.reindex(l.info, key, old, &val)
+	})
+}
+
+// indexed is the value at key the indexes of the table hold, nil when the key is not
+// in the table or the table has no index to keep up to date
+func (l loggedTable) indexed(key Key) (*string, error) {
+
+	if len(l.info.TblIdx) == 0 {
+		return nil, nil
+	}
+	val, err := l.plain().Select(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+func (l loggedTable) Select(key Key) (string, error) {
+
+	l.disk.MuLock.RLock()
+	defer l.disk.MuLock.RUnlock()
+	return l.plain().Select(key)
+}
+
+func (l loggedTable) SelectAll() (*Iterator, error) {
+	return l.Scan(nil, nil, false)
+}
+
+// Scan holds the shared lock while it finds the first row, the iterator takes it again
+// on every call to Next
+func (l loggedTable) Scan(from, to Key, desc bool) (*Iterator, error) {
+
+	l.disk.MuLock.RLock()
+	defer l.disk.MuLock.RUnlock()
+	it, err := l.plain().Scan(from, to, desc)
+	if err != nil {
+		return nil, err
+	}
+	it.lock = &l.disk.MuLock
+	return it, nil
+}
+
+// Compulsary initdb before initTable else it might cause some bugs. The table the
+// database was created with is named after its file.
+func InitTable(d *DiskManager, name string) (Table, error) {
+	ti, err := d.TableInfo(name)
+	if err != nil {
+		return nil, fmt.Errorf("InitTable error: %w", err)
+	}
+	return loggedTable{
+		disk: d,
+		info: ti,
+	}, nil
+}
+
+// plainTable is the table without the lock and the log, for callers holding the lock
+// inside an operation
+func (d *DiskManager) plainTable(ti *TblInfo) Table {
+	if ti.IsTree {
 		return tree{
 			table: d,
+			info:  ti,
 		}
 	}
-	return d
+	return linear{
+		table: d,
+		info:  ti,
+	}
 }
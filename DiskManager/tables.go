@@ -0,0 +1,247 @@
+package diskmanager
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Tables lists every table of the database, the one it was created with first
+func (d *DiskManager) Tables() []*TblInfo {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	return append([]*TblInfo(nil), d.TblLst...)
+}
+
+// TableInfo returns the table called name
+func (d *DiskManager) TableInfo(name string) (*TblInfo, error) {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	ti := d.table(name)
+	if ti == nil {
+		return nil, fmt.Errorf("TableInfo error: no table %s in the database", name)
+	}
+	return ti, nil
+}
+
+func (d *DiskManager) table(name string) *TblInfo {
+
+	for _, ti := range d.TblLst {
+		if ti.TblNam == name {
+			return ti
+		}
+	}
+	return nil
+}
+
+// AddTable adds an empty table of type tree or list to the database. With columns the
+// rows of the table are records of those columns and the primary key column decides the
+// key type, otherwise keyType does.
+func (d *DiskManager) AddTable(name string, dbtype string, keyType int8, columns []Column) error {
+
+	if name == "" || len(name) >= KEY_SIZE {
+		return fmt.Errorf("AddTable error: table names are 1 to %d bytes, got %q", KEY_SIZE-1, name)
+	}
+	var isTree bool
+	switch dbtype {
+	case "tree":
+		isTree = true
+	case "list":
+		isTree = false
+	default:
+		return fmt.Errorf("AddTable error: invalid table type")
+	}
+	if isTree && TreePageSize(d.Fanout) > d.PgSize {
+		return fmt.Errorf("AddTable error: the pages of this database were sized for list tables before tables could be mixed, it cannot hold a tree table")
+	}
+	var schema *Schema
+	if columns != nil {
+		schema = &Schema{Name: name, Columns: columns}
+		if err := schema.check(); err != nil {
+			return fmt.Errorf("AddTable error: %w", err)
+		}
+		keyType, _ = keyTypeOf(columns[schema.PrimKey()].Type)
+	}
+	if keyType < KT_INT32 || keyType > KT_BYTES {
+		return fmt.Errorf("AddTable error: invalid key type %d", keyType)
+	}
+
+	err := loggedTable{disk: d}.logged(func() error {
+		if d.table(name) != nil {
+			return fmt.Errorf("table %s already exists", name)
+		}
+		entry := DirEntry{NLen: uint8(len(name)), IsLinear: !isTree, KeyType: keyType}
+		copy(entry.Name[:], name)
+		if schema != nil {
+			addr, size, err := d.writeCatalog(schema)
+			if err != nil {
+				return err
+			}
+			entry.CtlgAddr, entry.CtlgSize = addr, size
+		}
+		dirAddr, dirIdx, err := d.addDirEntry(entry)
+		if err != nil {
+			return err
+		}
+		d.TblLst = append(d.TblLst, &TblInfo{
+			TblNam: name,
+			IsTree: isTree,
+			KeyTyp: keyType,
+			TblSch: schema,
+			DirAdr: dirAddr,
+			DirIdx: dirIdx,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("AddTable error: %w", err)
+	}
+	return nil
+}
+
+// addDirEntry stores entry in the first free slot of the directory, growing it by a
+// page when every slot is taken
+func (d *DiskManager) addDirEntry(entry DirEntry) (int32, int, error) {
+
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+	}
+	var last int32
+	for addr := head.DirAddr; addr != 0; {
+		page, err := d.getDirPage(addr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+		}
+		for i, ent := range page.Ents {
+			if ent.free() {
+				page.Ents[i] = entry
+				if err := d.EdtDiskData(addr, page); err != nil {
+					return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+				}
+				return addr, i, nil
+			}
+		}
+		last, addr = addr, page.Head.Next
+	}
+
+	page := d.NewDirPage()
+	page.Ents[0] = entry
+	dsk, err := d.WrtDiskData(page)
+	if err != nil {
+		return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+	}
+	newAddr := dsk.RecHead.RecAddr
+	if last == 0 {
+		// the write may have taken a page off the free list, read the header again
+		if head, err = d.GetDBHeader(); err != nil {
+			return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+		}
+		head.DirAddr = newAddr
+		err = d.WrtDBHeader(*head)
+	} else {
+		var lastPage DirPage
+		if lastPage, err = d.getDirPage(last); err == nil {
+			lastPage.Head.Next = newAddr
+			err = d.EdtDiskData(last, lastPage)
+		}
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("addDirEntry error: %w", err)
+	}
+	return newAddr, 0, nil
+}
+
+func (d *DiskManager) getDirPage(addr int32) (DirPage, error) {
+
+	dsk, err := d.GetDiskData(addr)
+	if err != nil {
+		return DirPage{}, err
+	}
+	page, ok := dsk.RecData.(DirPage)
+	if !ok || dsk.RecHead.Deleted {
+		return DirPage{}, fmt.Errorf("record %d is not a live directory page", addr)
+	}
+	return page, nil
+}
+
+// loadTables reads the tables from the file header and the directory. Tables already
+// known keep their TblInfo, so Table values in use see roots moved by a rollback or a
+// vacuum.
+func (d *DiskManager) loadTables() error {
+
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return fmt.Errorf("loadTables error: %w", err)
+	}
+	first := &TblInfo{
+		TblNam: filepath.Base(d.FilObj.Name()),
+		SrtOff: head.RootAddr,
+		IsTree: !head.IsLinear,
+		KeyTyp: head.KeyType,
+	}
+	if head.CtlgAddr != 0 {
+		if first.TblSch, err = d.readCatalog(head.CtlgAddr, head.CtlgSize); err != nil {
+			return fmt.Errorf("loadTables error: %w", err)
+		}
+	}
+	tables := []*TblInfo{first}
+	var indexes []*TblInfo
+
+	for addr := head.DirAddr; addr != 0; {
+		page, err := d.getDirPage(addr)
+		if err != nil {
+			return fmt.Errorf("loadTables error: %w", err)
+		}
+		for i, ent := range page.Ents {
+			if ent.free() {
+				continue
+			}
+			ti := &TblInfo{
+				TblNam: string(ent.Name[:ent.NLen]),
+				SrtOff: ent.RootAddr,
+				IsTree: !ent.IsLinear,
+				KeyTyp: ent.KeyType,
+				DirAdr: addr,
+				DirIdx: i,
+				IdxCol: int(ent.IdxCol),
+			}
+			if ti.IdxCol != 0 {
+				if ti.TblNam == "" {
+					ti.TblNam = first.TblNam
+				}
+				indexes = append(indexes, ti)
+				continue
+			}
+			if ent.CtlgAddr != 0 {
+				if ti.TblSch, err = d.readCatalog(ent.CtlgAddr, ent.CtlgSize); err != nil {
+					return fmt.Errorf("loadTables error: table %s: %w", ti.TblNam, err)
+				}
+			}
+			tables = append(tables, ti)
+		}
+		addr = page.Head.Next
+	}
+	for _, idx := range indexes {
+		var owner *TblInfo
+		for _, ti := range tables {
+			if ti.TblNam == idx.TblNam {
+				owner = ti
+			}
+		}
+		if owner == nil {
+			return fmt.Errorf("loadTables error: index on column %d of a missing table %s", idx.IdxCol-1, idx.TblNam)
+		}
+		owner.TblIdx = append(owner.TblIdx, idx)
+	}
+
+	for i, ti := range tables {
+		if old := d.table(ti.TblNam); old != nil {
+			*old = *ti
+			tables[i] = old
+		}
+	}
+	d.TblLst = tables
+	return nil
+}
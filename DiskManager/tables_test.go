@@ -0,0 +1,111 @@
+package diskmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_STRING); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []Column{{Name: "id", Type: CT_INTEGER, PrimKey: true}, {Name: "name", Type: CT_TEXT}}
+	if err := d.AddTable("users", "list", 0, columns); err != nil {
+		t.Fatal(err)
+	}
+	// enough tables to spill the directory onto a second page
+	for i := 0; i < d.dirCap()+2; i++ {
+		if err := d.AddTable(fmt.Sprintf("kv%d", i), "tree", KT_INT32, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddTable("users", "tree", KT_INT32, nil); err == nil {
+		t.Fatal("expected an error for a duplicate table")
+	}
+
+	// every table gets rows of its own
+	names := []string{"app", "users", "kv0", fmt.Sprintf("kv%d", d.dirCap()+1)}
+	for i, name := range names {
+		table, err := InitTable(d, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ti, _ := d.TableInfo(name)
+		for j := 0; j <= i*10; j++ {
+			var key Key
+			var val string
+			if ti.TblSch != nil {
+				key, val, err = ti.EncodeRow([]any{int64(j), name})
+			} else {
+				key, err = ti.ParseKey(fmt.Sprint(j))
+				val = name
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := table.Insert(key, val); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	}
+
+	// a table added in a rolled back transaction is gone again
+	if err := d.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddTable("tmp", "tree", KT_INT32, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.TableInfo("tmp"); err == nil {
+		t.Fatal("table tmp survived the rollback")
+	}
+	if _, err := d.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if got, want := len(d.Tables()), d.dirCap()+4; got != want {
+		t.Fatalf("tables: got %d, want %d", got, want)
+	}
+	for i, name := range names {
+		table, err := InitTable(d, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it, err := table.SelectAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := 0
+		for it.Next() {
+			if it.Value() != name && name != "users" {
+				t.Fatalf("%s: row from another table %q", name, it.Value())
+			}
+			rows++
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if rows != i*10+1 {
+			t.Errorf("%s: got %d rows, want %d", name, rows, i*10+1)
+		}
+	}
+	if _, err := InitTable(d, "tmp"); err == nil {
+		t.Fatal("expected an error for a missing table")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 type tree struct {
 	table *DiskManager
+	info  *TblInfo
 }
 
 // helps in split logic maintaining function signature
@@ -18,9 +19,9 @@ type InsertKeyError struct {
 
 func (e *InsertKeyError) Error() string {
 	if e.Err != nil {
-		return fmt.Sprintf("promoted key %d, new child ref %v: %s", e.PromotedNode.Key, e.NewChildNode, e.Err.Error())
+		return fmt.Sprintf("promoted key %x, new child ref %v: %s", e.PromotedNode.key(), e.NewChildNode, e.Err.Error())
 	}
-	return fmt.Sprintf("promoted key %d, new child ref %v", e.PromotedNode.Key, e.NewChildNode)
+	return fmt.Sprintf("promoted key %x, new child ref %v", e.PromotedNode.key(), e.NewChildNode)
 }
 
 // Unwrap allows this error to be unwrapped to reveal the underlying error
@@ -47,87 +48,285 @@ func (e *DeleteKeyError) Unwrap() error {
 	return e.Err
 }
 
-func (t tree) ResetCursor() error {
-
-	hdr, err := t.table.GetDBHeader()
-	if err != nil {
-		return fmt.Errorf("tree: ResetCursor error:%w", err)
-	}
-	t.table.Cursor = hdr.RootAddr
-	t.table.SrtOff = hdr.RootAddr
-	return nil
-}
-
 func (t tree) updatePageParent(pageAddr int32, parentAddr int32, isRoot bool) error {
 
 	if pageAddr == 0 || pageAddr == -1 {
 		return fmt.Errorf("tree: updatePageParent: invalid pageAddr %d", pageAddr)
 	}
-	savedCursor := t.table.Cursor
-	t.table.Cursor = pageAddr
-	dskData, err := t.table.GetDiskData()
+	dskData, err := t.table.GetDiskData(pageAddr)
 	if err != nil {
-		t.table.Cursor = savedCursor
 		return fmt.Errorf("tree: updatePageParent (get page %d): %w", pageAddr, err)
 	}
 	var pageToUpdate TreePage // Assuming all pages in the tree are TreePage
 	if dskData.RecHead.RecType != DT_TREE_PAGE {
-		t.table.Cursor = savedCursor
 		return fmt.Errorf("tree: updatePageParent: page %d is not a TreePage, type %T", pageAddr, dskData.RecData)
 	}
 	pageToUpdate = dskData.RecData.(TreePage)
 	pageToUpdate.Head.Parent = parentAddr
 	pageToUpdate.Head.IsRoot = isRoot // Update IsRoot status as well
-	err = t.table.EdtDiskData(pageToUpdate)
-	t.table.Cursor = savedCursor
+	err = t.table.EdtDiskData(pageAddr, pageToUpdate)
 	if err != nil {
 		return fmt.Errorf("tree: updatePageParent (edit page %d): %w", pageAddr, err)
 	}
 	return nil
 }
 
+// getPage reads the tree page stored at addr
+func (t tree) getPage(addr int32) (TreePage, error) {
+
+	if addr == 0 || addr == -1 {
+		return TreePage{}, fmt.Errorf("tree: getPage: invalid pageAddr %d", addr)
+	}
+	dskData, err := t.table.GetDiskData(addr)
+	if err != nil {
+		return TreePage{}, fmt.Errorf("tree: getPage (get page %d): %w", addr, err)
+	}
+	if dskData.RecHead.RecType != DT_TREE_PAGE {
+		return TreePage{}, fmt.Errorf("tree: getPage: page %d is not a TreePage, type %T", addr, dskData.RecData)
+	}
+	return dskData.RecData.(TreePage), nil
+}
+
+// edtPage overwrites the tree page stored at addr
+func (t tree) edtPage(addr int32, page TreePage) error {
+
+	err := t.table.EdtDiskData(addr, page)
+	if err != nil {
+		return fmt.Errorf("tree: edtPage (edit page %d): %w", addr, err)
+	}
+	return nil
+}
+
+// delPage marks the tree page stored at addr as deleted
+func (t tree) delPage(addr int32) error {
+
+	err := t.table.DelDiskData(addr)
+	if err != nil {
+		return fmt.Errorf("tree: delPage (delete page %d): %w", addr, err)
+	}
+	return nil
+}
+
+// BorrowLeaf refills the underfull child at currIndex of the page at currPageAddr by
+// rotating a key through the parent from its left or right sibling (-1 when absent).
+// Internal children take the adjacent grandchild along with the key. When neither
+// sibling can spare a key a DeleteKeyError with BorrowPossible false is returned.
 func (t tree) BorrowLeaf(currPageAddr int32, currIndex int32, leftChildAddr int32, rightChildAddr int32) error {
 
+	parentPage, err := t.getPage(currPageAddr)
+	if err != nil {
+		return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+	}
+	childAddr := parentPage.Chld[currIndex]
+	childPage, err := t.getPage(childAddr)
+	if err != nil {
+		return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+	}
+	numChildKeys := NumKeys(childPage.Data)
+
+	if leftChildAddr != -1 {
+		leftPage, err := t.getPage(leftChildAddr)
+		if err != nil {
+			return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+		}
+		numLeftKeys := NumKeys(leftPage.Data)
+		if numLeftKeys > t.table.MinKeys() {
+
+			// shift child right by one and pull the separator down into slot 0
+			copy(childPage.Data[1:numChildKeys+1], childPage.Data[:numChildKeys])
+			childPage.Data[0] = parentPage.Data[currIndex-1]
+			parentPage.Data[currIndex-1] = leftPage.Data[numLeftKeys-1]
+			leftPage.Data[numLeftKeys-1] = DataNode{}
+
+			var movedChild int32 = -1
+			if !childPage.Head.IsLeaf {
+				copy(childPage.Chld[1:numChildKeys+2], childPage.Chld[:numChildKeys+1])
+				movedChild = leftPage.Chld[numLeftKeys]
+				childPage.Chld[0] = movedChild
+				leftPage.Chld[numLeftKeys] = 0
+			}
+
+			if err := t.edtPage(leftChildAddr, leftPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if err := t.edtPage(childAddr, childPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if err := t.edtPage(currPageAddr, parentPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if movedChild != -1 {
+				if err := t.updatePageParent(movedChild, childAddr, false); err != nil {
+					return fmt.Errorf("tree: BorrowLeaf (update parent of moved child %d): %w", movedChild, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	if rightChildAddr != -1 {
+		rightPage, err := t.getPage(rightChildAddr)
+		if err != nil {
+			return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+		}
+		numRightKeys := NumKeys(rightPage.Data)
+		if numRightKeys > t.table.MinKeys() {
+
+			// append the separator to the child and lift the right sibling's first key
+			childPage.Data[numChildKeys] = parentPage.Data[currIndex]
+			parentPage.Data[currIndex] = rightPage.Data[0]
+			copy(rightPage.Data[:numRightKeys-1], rightPage.Data[1:numRightKeys])
+			rightPage.Data[numRightKeys-1] = DataNode{}
+
+			var movedChild int32 = -1
+			if !childPage.Head.IsLeaf {
+				movedChild = rightPage.Chld[0]
+				childPage.Chld[numChildKeys+1] = movedChild
+				copy(rightPage.Chld[:numRightKeys], rightPage.Chld[1:numRightKeys+1])
+				rightPage.Chld[numRightKeys] = 0
+			}
+
+			if err := t.edtPage(rightChildAddr, rightPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if err := t.edtPage(childAddr, childPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if err := t.edtPage(currPageAddr, parentPage); err != nil {
+				return fmt.Errorf("tree: BorrowLeaf Error:%w", err)
+			}
+			if movedChild != -1 {
+				if err := t.updatePageParent(movedChild, childAddr, false); err != nil {
+					return fmt.Errorf("tree: BorrowLeaf (update parent of moved child %d): %w", movedChild, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	return &DeleteKeyError{
+		IsUnderfill:    true,
+		IsLeaf:         childPage.Head.IsLeaf,
+		BorrowPossible: false,
+		Err:            nil,
+	}
+}
+
+// mergeChildren folds the child right of the separator at sepIdx, together with the
+// separator itself, into the child left of it and releases the emptied right page.
+// A root left without keys is replaced by the merged child.
+func (t tree) mergeChildren(parentAddr int32, sepIdx int) error {
+
+	parentPage, err := t.getPage(parentAddr)
+	if err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+	leftAddr, rightAddr := parentPage.Chld[sepIdx], parentPage.Chld[sepIdx+1]
+	leftPage, err := t.getPage(leftAddr)
+	if err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+	rightPage, err := t.getPage(rightAddr)
+	if err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+	numLeftKeys, numRightKeys := NumKeys(leftPage.Data), NumKeys(rightPage.Data)
+	numParentKeys := NumKeys(parentPage.Data)
+
+	leftPage.Data[numLeftKeys] = parentPage.Data[sepIdx]
+	copy(leftPage.Data[numLeftKeys+1:], rightPage.Data[:numRightKeys])
+	if !leftPage.Head.IsLeaf {
+		copy(leftPage.Chld[numLeftKeys+1:], rightPage.Chld[:numRightKeys+1])
+	}
+
+	// drop the separator and the pointer to the right page from the parent
+	copy(parentPage.Data[sepIdx:], parentPage.Data[sepIdx+1:numParentKeys])
+	parentPage.Data[numParentKeys-1] = DataNode{}
+	copy(parentPage.Chld[sepIdx+1:], parentPage.Chld[sepIdx+2:numParentKeys+1])
+	parentPage.Chld[numParentKeys] = 0
+
+	if err := t.edtPage(leftAddr, leftPage); err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+	if !leftPage.Head.IsLeaf {
+		for _, childAddrMoved := range rightPage.Chld[:numRightKeys+1] {
+			if err := t.updatePageParent(childAddrMoved, leftAddr, false); err != nil {
+				return fmt.Errorf("tree: mergeChildren (update parent of child %d to left page %d): %w", childAddrMoved, leftAddr, err)
+			}
+		}
+	}
+	if err := t.delPage(rightAddr); err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+
+	// root ran out of keys, the merged child takes its place
+	if parentPage.Head.IsRoot && numParentKeys-1 == 0 {
+		if err := t.updatePageParent(leftAddr, -1, true); err != nil {
+			return fmt.Errorf("tree: mergeChildren (promote page %d to root): %w", leftAddr, err)
+		}
+		err = t.table.setRootAddr(t.info, leftAddr)
+		if err != nil {
+			return fmt.Errorf("tree: mergeChildren Error:%w", err)
+		}
+		if err := t.delPage(parentAddr); err != nil {
+			return fmt.Errorf("tree: mergeChildren Error:%w", err)
+		}
+		return nil
+	}
+
+	if err := t.edtPage(parentAddr, parentPage); err != nil {
+		return fmt.Errorf("tree: mergeChildren Error:%w", err)
+	}
+	if !parentPage.Head.IsRoot && numParentKeys-1 < t.table.MinKeys() {
+		return &DeleteKeyError{
+			IsUnderfill:    true,
+			IsLeaf:         false,
+			BorrowPossible: false,
+			Err:            nil,
+		}
+	}
 	return nil
 }
 
-func (t tree) Insert(key int32, val string) error {
+func (t tree) Insert(key Key, val string) error {
 
 	// if table is empty
-	if t.table.SrtOff == t.table.EndOff {
+	if t.info.SrtOff == 0 {
 		// if table is empty, create a new root node
-		root, err := t.table.WrtDiskData(TreePage{
-			Head: TreeHead{
-				IsLeaf: true,
-				IsRoot: true,
-				Parent: -1,
-			},
-			Data: [MAX_KEYS]DataNode{{Key: key, Val: String2ByteArr(val)}},
-			Chld: [MAX_CHILDREN]int32{},
-		})
+		rootPage := t.table.NewTreePage()
+		rootPage.Head = TreeHead{
+			IsLeaf: true,
+			IsRoot: true,
+			Parent: -1,
+		}
+		node, err := t.table.newNode(key, val)
+		if err != nil {
+			return fmt.Errorf("tree: Insert (empty tree newNode): %w", err)
+		}
+		rootPage.Data[0] = node
+		root, err := t.table.WrtDiskData(rootPage)
 		if err != nil {
 			return fmt.Errorf("tree: Insert (empty tree WrtDiskData): %w", err)
 		}
-		err = t.table.WrtDBHeader(TableHeader{
-			RootAddr: root.RecHead.RecAddr,
-			IsLinear: false,
-		})
+		err = t.table.setRootAddr(t.info, root.RecHead.RecAddr)
 		if err != nil {
 			return fmt.Errorf("tree: Insert (empty tree WrtDiskData): %w", err)
 		}
-		t.table.SrtOff = root.RecHead.RecAddr
-		t.table.Cursor = root.RecHead.RecAddr // Set cursor to the new root
 		return nil
 
 	}
+	return t.insert(t.info.SrtOff, key, val)
+}
+
+// insert adds key to the subtree rooted at addr, a split that does not reach the root
+// is handed back to the caller as an InsertKeyError
+func (t tree) insert(addr int32, key Key, val string) error {
 
-	// if table is not empty, we need to insert into the tree
-	dsk, err := t.table.GetDiskData()
+	currentPage, err := t.getPage(addr)
 	if err != nil {
 		return fmt.Errorf("tree: Insert Error:%w", err)
 	}
-	currentPage := dsk.RecData.(TreePage)
-	currentPageAddr := dsk.RecHead.RecAddr
+	currentPageAddr := addr
 
 	// if the current page is a leaf, we can insert directly
 	if currentPage.Head.IsLeaf {
@@ -137,27 +336,31 @@ func (t tree) Insert(key int32, val string) error {
 			if IsNodeEmpty(v) {
 				break
 			}
-			if v.Key < key {
+			if CompareKeys(v.key(), key) == 0 {
+				return &DuplicateKeyError{Key: t.info.FormatKey(key)}
+			}
+			if CompareKeys(v.key(), key) < 0 {
 				insertIdx++
 			}
 			numCurrentKeys++
 		}
 
+		node, err := t.table.newNode(key, val)
+		if err != nil {
+			return fmt.Errorf("tree: Insert Error:%w", err)
+		}
 		var NodeBuf []DataNode = make([]DataNode, numCurrentKeys+1)
 
 		copy(NodeBuf, currentPage.Data[:insertIdx])
-		NodeBuf[insertIdx] = DataNode{
-			Key: key,
-			Val: String2ByteArr(val),
-		}
+		NodeBuf[insertIdx] = node
 		copy(NodeBuf[insertIdx+1:], currentPage.Data[insertIdx:numCurrentKeys])
 
 		// if the current page is not full, we can just copy the existing leaf page children
-		currentPage.Data = [MAX_KEYS]DataNode{}
-		if len(NodeBuf) <= MAX_KEYS {
+		currentPage.Data = make([]DataNode, t.table.MaxKeys())
+		if len(NodeBuf) <= t.table.MaxKeys() {
 
 			copy(currentPage.Data[:], NodeBuf)
-			err = t.table.EdtDiskData(currentPage)
+			err = t.table.EdtDiskData(currentPageAddr, currentPage)
 			if err != nil {
 				return fmt.Errorf("tree: Insert Error:%w", err)
 			}
@@ -166,21 +369,17 @@ func (t tree) Insert(key int32, val string) error {
 		}
 
 		// if the current page is full, we need to split it
-		var leftPge, rightPge TreePage
+		leftPge, rightPge := t.table.NewTreePage(), t.table.NewTreePage()
 
 		copy(leftPge.Data[:], NodeBuf[:len(NodeBuf)/2])
 		leftPge.Head = currentPage.Head
 		leftPge.Head.IsRoot = false
-		// page has no children, so we can just copy the existing leaf page children
-		leftPge.Chld = currentPage.Chld
 
 		copy(rightPge.Data[:], NodeBuf[len(NodeBuf)/2+1:])
 		rightPge.Head = currentPage.Head
 		rightPge.Head.IsRoot = false
-		// page has no children, so we can just copy the existing leaf page children
-		rightPge.Chld = currentPage.Chld
 
-		err = t.table.EdtDiskData(leftPge)
+		err = t.table.EdtDiskData(currentPageAddr, leftPge)
 		if err != nil {
 			return fmt.Errorf("tree: Insert Error:%w", err)
 		}
@@ -191,24 +390,22 @@ func (t tree) Insert(key int32, val string) error {
 		rightPgeAddr := nd.RecHead.RecAddr // Address of the right page, to update parent later
 
 		if currentPage.Head.IsRoot {
-			root, err := t.table.WrtDiskData(TreePage{
-				Head: TreeHead{
-					IsLeaf: false,
-					IsRoot: true,
-					Parent: -1,
-				},
-				Data: [MAX_KEYS]DataNode{{Key: NodeBuf[len(NodeBuf)/2].Key, Val: NodeBuf[len(NodeBuf)/2].Val}},
-				Chld: [MAX_CHILDREN]int32{dsk.RecHead.RecAddr, nd.RecHead.RecAddr},
-			})
+			rootPage := t.table.NewTreePage()
+			rootPage.Head = TreeHead{
+				IsLeaf: false,
+				IsRoot: true,
+				Parent: -1,
+			}
+			rootPage.Data[0] = NodeBuf[len(NodeBuf)/2]
+			rootPage.Chld[0], rootPage.Chld[1] = currentPageAddr, nd.RecHead.RecAddr
+			root, err := t.table.WrtDiskData(rootPage)
+			if err != nil {
+				return fmt.Errorf("tree: Insert Error:%w", err)
+			}
+			err = t.table.setRootAddr(t.info, root.RecHead.RecAddr)
 			if err != nil {
 				return fmt.Errorf("tree: Insert Error:%w", err)
 			}
-			t.table.WrtDBHeader(TableHeader{
-				RootAddr: root.RecHead.RecAddr,
-				IsLinear: false,
-			})
-			t.table.SrtOff = root.RecHead.RecAddr
-			t.table.Cursor = root.RecHead.RecAddr // Set cursor to the new root
 			// Update parent pointers of the two new children
 			if err := t.updatePageParent(currentPageAddr, root.RecHead.RecAddr, false); err != nil { // Left child
 				return fmt.Errorf("TreeInsert (leaf root split: update parent of left child %d): %w", currentPageAddr, err)
@@ -225,33 +422,35 @@ func (t tree) Insert(key int32, val string) error {
 		}
 	}
 	// internal node case, we need to find the child node to insert into
-	savedCursor := t.table.Cursor
+	var childAddr int32
 	foundChild := false
 	numValidKeys := 0
 	for i, v := range currentPage.Data {
 		if IsNodeEmpty(v) {
 			break
 		}
-		if v.Key > key {
+		if CompareKeys(v.key(), key) == 0 {
+			return &DuplicateKeyError{Key: t.info.FormatKey(key)}
+		}
+		if CompareKeys(v.key(), key) > 0 {
 			foundChild = true
-			t.table.Cursor = currentPage.Chld[i]
+			childAddr = currentPage.Chld[i]
 			break
 		}
 		numValidKeys++
 	}
 	if !foundChild {
-		t.table.Cursor = currentPage.Chld[numValidKeys]
+		childAddr = currentPage.Chld[numValidKeys]
 	}
 
-	// Recursive call to Insert
-	err = t.Insert(key, val)
-	t.table.Cursor = savedCursor
+	// Recursive call to insert
+	err = t.insert(childAddr, key, val)
 
 	var promotedNodeFromChild DataNode
 	var newChildAddrFromPromotion int32
 	if errors.As(err, new(*InsertKeyError)) {
 		promotedNodeFromChild, newChildAddrFromPromotion = err.(*InsertKeyError).PromotedNode, err.(*InsertKeyError).NewChildNode
-		key = promotedNodeFromChild.Key
+		key = promotedNodeFromChild.key()
 	} else if err != nil {
 		return fmt.Errorf("tree: Insert Error:%w", err)
 	} else {
@@ -260,15 +459,8 @@ func (t tree) Insert(key int32, val string) error {
 
 	// Insert promoted key and new child pointer into THIS internal node (tp)
 	insertIdx := 0
-	numCurrentKeys := 0
-	for _, v := range currentPage.Data {
-		if IsNodeEmpty(v) {
-			break
-		}
-		numCurrentKeys++
-		if key < v.Key {
-			break
-		}
+	numCurrentKeys := NumKeys(currentPage.Data)
+	for insertIdx < numCurrentKeys && CompareKeys(currentPage.Data[insertIdx].key(), key) < 0 {
 		insertIdx++
 	}
 	var NodeBuf []DataNode = make([]DataNode, numCurrentKeys+1)
@@ -277,16 +469,16 @@ func (t tree) Insert(key int32, val string) error {
 	copy(NodeBuf[:insertIdx], currentPage.Data[:insertIdx])
 	copy(chldBuf[:insertIdx+1], currentPage.Chld[:insertIdx+1])
 
-	NodeBuf[insertIdx] = DataNode{Key: key, Val: promotedNodeFromChild.Val}
+	NodeBuf[insertIdx] = promotedNodeFromChild
 	chldBuf[insertIdx+1] = newChildAddrFromPromotion
 
 	copy(NodeBuf[insertIdx+1:], currentPage.Data[insertIdx:numCurrentKeys])
 	copy(chldBuf[insertIdx+2:], currentPage.Chld[insertIdx+1:numCurrentKeys+1])
 
-	if len(NodeBuf) <= MAX_KEYS {
+	if len(NodeBuf) <= t.table.MaxKeys() {
 
-		currentPage.Data = [MAX_KEYS]DataNode{}
-		currentPage.Chld = [MAX_CHILDREN]int32{}
+		currentPage.Data = make([]DataNode, t.table.MaxKeys())
+		currentPage.Chld = make([]int32, t.table.Fanout)
 		copy(currentPage.Data[:], NodeBuf)
 		copy(currentPage.Chld[:], chldBuf)
 		if newChildAddrFromPromotion != 0 && newChildAddrFromPromotion != -1 {
@@ -294,7 +486,7 @@ func (t tree) Insert(key int32, val string) error {
 				return fmt.Errorf("TreeInsert (internal no-split: update parent of new child %d): %w", newChildAddrFromPromotion, err)
 			}
 		}
-		err = t.table.EdtDiskData(currentPage)
+		err = t.table.EdtDiskData(currentPageAddr, currentPage)
 		if err != nil {
 			return fmt.Errorf("tree: Insert Error:%w", err)
 		}
@@ -305,17 +497,19 @@ func (t tree) Insert(key int32, val string) error {
 	medianIdx := len(NodeBuf) / 2
 	promotedNodeFromInternal := NodeBuf[medianIdx]
 
-	leftIntenalPage := TreePage{Head: currentPage.Head}
+	leftIntenalPage := t.table.NewTreePage()
+	leftIntenalPage.Head = currentPage.Head
 	leftIntenalPage.Head.IsRoot = false // No longer root after split
 	copy(leftIntenalPage.Data[:], NodeBuf[:medianIdx])
 	copy(leftIntenalPage.Chld[:], chldBuf[:medianIdx+1]) // Children for left page
 
-	rightInternalPage := TreePage{Head: currentPage.Head}
+	rightInternalPage := t.table.NewTreePage()
+	rightInternalPage.Head = currentPage.Head
 	rightInternalPage.Head.IsRoot = false
 	copy(rightInternalPage.Data[:], NodeBuf[medianIdx+1:])
 	copy(rightInternalPage.Chld[:], chldBuf[medianIdx+1:]) // Children for right page
 
-	err = t.table.EdtDiskData(leftIntenalPage)
+	err = t.table.EdtDiskData(currentPageAddr, leftIntenalPage)
 	if err != nil {
 		return fmt.Errorf("tree: Insert Error:%w", err)
 	}
@@ -340,27 +534,22 @@ func (t tree) Insert(key int32, val string) error {
 	// If the split internal node was the ROOT
 	if currentPage.Head.IsRoot {
 
-		rewRoot, err := t.table.WrtDiskData(TreePage{
-			Head: TreeHead{
-				IsLeaf: false, // Root of internal nodes is not a leaf
-				IsRoot: true,
-				Parent: -1,
-			},
-			Data: [MAX_KEYS]DataNode{promotedNodeFromInternal},
-			Chld: [MAX_CHILDREN]int32{currentPageAddr, newRightInternalPageAddr},
-		})
+		rootPage := t.table.NewTreePage()
+		rootPage.Head = TreeHead{
+			IsLeaf: false, // Root of internal nodes is not a leaf
+			IsRoot: true,
+			Parent: -1,
+		}
+		rootPage.Data[0] = promotedNodeFromInternal
+		rootPage.Chld[0], rootPage.Chld[1] = currentPageAddr, newRightInternalPageAddr
+		rewRoot, err := t.table.WrtDiskData(rootPage)
 		if err != nil {
 			return fmt.Errorf("tree: Insert Error:%w", err)
 		}
-		err = t.table.WrtDBHeader(TableHeader{
-			RootAddr: rewRoot.RecHead.RecAddr,
-			IsLinear: false,
-		})
+		err = t.table.setRootAddr(t.info, rewRoot.RecHead.RecAddr)
 		if err != nil {
 			return fmt.Errorf("tree: Insert Error:%w", err)
 		}
-		t.table.SrtOff = rewRoot.RecHead.RecAddr
-		t.table.Cursor = rewRoot.RecHead.RecAddr // Set cursor to the new root
 
 		// Update parent pointers of the two new children (split internal nodes)
 		if err := t.updatePageParent(currentPageAddr, rewRoot.RecHead.RecAddr, false); err != nil { // Left child
@@ -379,46 +568,66 @@ func (t tree) Insert(key int32, val string) error {
 	}
 }
 
-func (t tree) Select(key int32) (string, error) {
+// Upsert inserts the key or, when it is already present, replaces its value
+func (t tree) Upsert(key Key, val string) error {
+
+	err := t.Insert(key, val)
+	if !errors.As(err, new(*DuplicateKeyError)) {
+		return err
+	}
+	return t.Update(key, val)
+}
+
+func (t tree) Select(key Key) (string, error) {
 
 	// if table is empty
-	if t.table.SrtOff == t.table.EndOff {
-		return "", fmt.Errorf("tree: Select Error: table is empty")
+	if t.info.SrtOff == 0 {
+		return "", fmt.Errorf("tree: Select Error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	// if table is not empty, we need to select all from the tree
-	dsk, err := t.table.GetDiskData()
+	return t.selectAt(t.info.SrtOff, key)
+}
+
+// selectAt looks key up in the subtree rooted at addr
+func (t tree) selectAt(addr int32, key Key) (string, error) {
+
+	currentPage, err := t.getPage(addr)
 	if err != nil {
 		return "", fmt.Errorf("tree: Select Error:%w", err)
 	}
-	currentPage := dsk.RecData.(TreePage)
 	if currentPage.Head.IsLeaf {
 		for _, v := range currentPage.Data {
 			if IsNodeEmpty(v) {
 				break
 			}
-			if v.Key == key {
-				return ByteArr2String(v.Val), nil
+			if CompareKeys(v.key(), key) == 0 {
+				val, err := t.table.nodeVal(v)
+				if err != nil {
+					return "", fmt.Errorf("tree: Select Error:%w", err)
+				}
+				return val, nil
 			}
 		}
-		return "", fmt.Errorf("tree: Select Error: key %d not found", key)
+		return "", fmt.Errorf("tree: Select Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	for i := 0; i < MAX_KEYS; i++ {
+	for i := 0; i < t.table.MaxKeys(); i++ {
 		if IsNodeEmpty(currentPage.Data[i]) {
 			if currentPage.Chld[i] == -1 || currentPage.Chld[i] == 0 {
-				return "", fmt.Errorf("tree: Select Error: key %d not found", key)
+				return "", fmt.Errorf("tree: Select Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 			}
-			t.table.Cursor = currentPage.Chld[i]
-			return t.Select(key)
+			return t.selectAt(currentPage.Chld[i], key)
 		}
-		if currentPage.Data[i].Key == key {
-			return ByteArr2String(currentPage.Data[i].Val), nil
+		if CompareKeys(currentPage.Data[i].key(), key) == 0 {
+			val, err := t.table.nodeVal(currentPage.Data[i])
+			if err != nil {
+				return "", fmt.Errorf("tree: Select Error:%w", err)
+			}
+			return val, nil
 		}
-		if currentPage.Data[i].Key > key {
+		if CompareKeys(currentPage.Data[i].key(), key) > 0 {
 			if currentPage.Chld[i] == -1 || currentPage.Chld[i] == 0 {
-				return "", fmt.Errorf("tree: Select Error: key %d not found", key)
+				return "", fmt.Errorf("tree: Select Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 			}
-			t.table.Cursor = currentPage.Chld[i]
-			return t.Select(key)
+			return t.selectAt(currentPage.Chld[i], key)
 		}
 	}
 	numValidKeysInNode := 0
@@ -429,70 +638,198 @@ func (t tree) Select(key int32) (string, error) {
 		numValidKeysInNode++
 	}
 	if currentPage.Chld[numValidKeysInNode] == 0 || currentPage.Chld[numValidKeysInNode] == -1 {
-		return "", fmt.Errorf("tree: Select Error: key %d not found (no rightmost child path)", key)
+		return "", fmt.Errorf("tree: Select Error:%w (no rightmost child path)", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	t.table.Cursor = currentPage.Chld[numValidKeysInNode]
-	return t.Select(key)
+	return t.selectAt(currentPage.Chld[numValidKeysInNode], key)
 }
 
-func (t tree) Delete(key int32) error {
-	return fmt.Errorf("tree:delete not implemented")
+func (t tree) Delete(key Key) error {
+
+	// if table is empty
+	if t.info.SrtOff == 0 {
+		return fmt.Errorf("tree: Delete Error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
+	}
+	return t.remove(t.info.SrtOff, key, true)
 }
 
-func (t tree) Update(key int32, val string) error {
+// remove takes key out of the subtree rooted at addr, ownsVal is false once the key is
+// a predecessor whose value was moved up into an internal page and must be kept
+func (t tree) remove(addr int32, key Key, ownsVal bool) error {
 
-	if len(val) > 32 {
-		return fmt.Errorf("tree: Update Error: val size length is greater than 32")
+	currentPage, err := t.getPage(addr)
+	if err != nil {
+		return fmt.Errorf("tree: Delete Error:%w", err)
 	}
+	currentPageAddr := addr
+
+	numCurrentKeys := NumKeys(currentPage.Data)
+	keyIdx := 0
+	for keyIdx < numCurrentKeys && CompareKeys(currentPage.Data[keyIdx].key(), key) < 0 {
+		keyIdx++
+	}
+	found := keyIdx < numCurrentKeys && CompareKeys(currentPage.Data[keyIdx].key(), key) == 0
+
+	// if the current page is a leaf, we can remove the key directly
+	if currentPage.Head.IsLeaf {
+		if !found {
+			return fmt.Errorf("tree: Delete Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
+		}
+		removed := currentPage.Data[keyIdx]
+		copy(currentPage.Data[keyIdx:], currentPage.Data[keyIdx+1:numCurrentKeys])
+		currentPage.Data[numCurrentKeys-1] = DataNode{}
+		err = t.table.EdtDiskData(currentPageAddr, currentPage)
+		if err != nil {
+			return fmt.Errorf("tree: Delete Error:%w", err)
+		}
+		if ownsVal {
+			if err := t.table.freeNode(removed); err != nil {
+				return fmt.Errorf("tree: Delete Error:%w", err)
+			}
+		}
+		// root is allowed to underfill, an empty root leaf is an empty table
+		if !currentPage.Head.IsRoot && numCurrentKeys-1 < t.table.MinKeys() {
+			return &DeleteKeyError{
+				IsUnderfill:    true,
+				IsLeaf:         true,
+				BorrowPossible: false,
+				Err:            nil,
+			}
+		}
+		return nil
+	}
+
+	// internal node case, a matching key is swapped with its in-order predecessor
+	// which is then removed from the left subtree
+	if found {
+		predAddr := currentPage.Chld[keyIdx]
+		predPage, err := t.getPage(predAddr)
+		if err != nil {
+			return fmt.Errorf("tree: Delete Error:%w", err)
+		}
+		for !predPage.Head.IsLeaf {
+			predAddr = predPage.Chld[NumKeys(predPage.Data)]
+			predPage, err = t.getPage(predAddr)
+			if err != nil {
+				return fmt.Errorf("tree: Delete Error:%w", err)
+			}
+		}
+		predNode := predPage.Data[NumKeys(predPage.Data)-1]
+		removed := currentPage.Data[keyIdx]
+		currentPage.Data[keyIdx] = predNode
+		err = t.table.EdtDiskData(currentPageAddr, currentPage)
+		if err != nil {
+			return fmt.Errorf("tree: Delete Error:%w", err)
+		}
+		if ownsVal {
+			if err := t.table.freeNode(removed); err != nil {
+				return fmt.Errorf("tree: Delete Error:%w", err)
+			}
+		}
+		key = predNode.key()
+		ownsVal = false
+	}
+
+	if currentPage.Chld[keyIdx] == 0 || currentPage.Chld[keyIdx] == -1 {
+		return fmt.Errorf("tree: Delete Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
+	}
+
+	// Recursive call to remove
+	err = t.remove(currentPage.Chld[keyIdx], key, ownsVal)
+
+	var delErr *DeleteKeyError
+	if !errors.As(err, &delErr) {
+		if err != nil {
+			return fmt.Errorf("tree: Delete Error:%w", err)
+		}
+		return nil
+	}
+	if delErr.Err != nil || !delErr.IsUnderfill {
+		return fmt.Errorf("tree: Delete Error:%w", err)
+	}
+
+	// child at keyIdx underfilled, borrow from a sibling or merge with one
+	var leftSibling, rightSibling int32 = -1, -1
+	if keyIdx > 0 {
+		leftSibling = currentPage.Chld[keyIdx-1]
+	}
+	if keyIdx < numCurrentKeys {
+		rightSibling = currentPage.Chld[keyIdx+1]
+	}
+	err = t.BorrowLeaf(currentPageAddr, int32(keyIdx), leftSibling, rightSibling)
+	if !errors.As(err, &delErr) {
+		if err != nil {
+			return fmt.Errorf("tree: Delete Error:%w", err)
+		}
+		return nil
+	}
+	if delErr.Err != nil || delErr.BorrowPossible {
+		return fmt.Errorf("tree: Delete Error:%w", err)
+	}
+
+	sepIdx := keyIdx
+	if leftSibling != -1 {
+		sepIdx = keyIdx - 1
+	}
+	err = t.mergeChildren(currentPageAddr, sepIdx)
+	if errors.As(err, &delErr) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("tree: Delete Error:%w", err)
+	}
+	return nil
+}
+
+func (t tree) Update(key Key, val string) error {
+
 	// if table is empty
-	if t.table.SrtOff == t.table.EndOff {
-		return fmt.Errorf("tree: Update Error: table is empty")
+	if t.info.SrtOff == 0 {
+		return fmt.Errorf("tree: Update Error: table is empty, %w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	buf := String2ByteArr(val)
-	// if table is not empty, we need to select all from the tree
-	dsk, err := t.table.GetDiskData()
+	return t.updateAt(t.info.SrtOff, key, val)
+}
+
+// updateAt replaces the value of key in the subtree rooted at addr
+func (t tree) updateAt(addr int32, key Key, val string) error {
+
+	currentPage, err := t.getPage(addr)
 	if err != nil {
 		return fmt.Errorf("tree: Update Error:%w", err)
 	}
-	currentPage := dsk.RecData.(TreePage)
 	if currentPage.Head.IsLeaf {
 		for i, v := range currentPage.Data {
 			if IsNodeEmpty(v) {
 				break
 			}
-			if v.Key == key {
-				currentPage.Data[i].Val = buf
-				err = t.table.EdtDiskData(currentPage)
+			if CompareKeys(v.key(), key) == 0 {
+				err = t.setVal(addr, currentPage, i, val)
 				if err != nil {
 					return fmt.Errorf("tree: Update Error:%w", err)
 				}
 				return nil
 			}
 		}
-		return fmt.Errorf("tree: Update Error: key %d not found", key)
+		return fmt.Errorf("tree: Update Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	for i := 0; i < MAX_KEYS; i++ {
+	for i := 0; i < t.table.MaxKeys(); i++ {
 		if IsNodeEmpty(currentPage.Data[i]) {
 			if currentPage.Chld[i] == -1 || currentPage.Chld[i] == 0 {
-				return fmt.Errorf("tree: Update Error: key %d not found", key)
+				return fmt.Errorf("tree: Update Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 			}
-			t.table.Cursor = currentPage.Chld[i]
-			return t.Update(key, val)
+			return t.updateAt(currentPage.Chld[i], key, val)
 		}
-		if currentPage.Data[i].Key == key {
-			currentPage.Data[i].Val = buf
-			err = t.table.EdtDiskData(currentPage)
+		if CompareKeys(currentPage.Data[i].key(), key) == 0 {
+			err = t.setVal(addr, currentPage, i, val)
 			if err != nil {
 				return fmt.Errorf("tree: Update Error:%w", err)
 			}
 			return nil
 		}
-		if currentPage.Data[i].Key > key {
+		if CompareKeys(currentPage.Data[i].key(), key) > 0 {
 			if currentPage.Chld[i] == -1 || currentPage.Chld[i] == 0 {
-				return fmt.Errorf("tree: Update Error: key %d not found", key)
+				return fmt.Errorf("tree: Update Error:%w", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 			}
-			t.table.Cursor = currentPage.Chld[i]
-			return t.Update(key, val)
+			return t.updateAt(currentPage.Chld[i], key, val)
 		}
 	}
 	numValidKeysInNode := 0
@@ -503,49 +840,28 @@ func (t tree) Update(key int32, val string) error {
 		numValidKeysInNode++
 	}
 	if currentPage.Chld[numValidKeysInNode] == 0 || currentPage.Chld[numValidKeysInNode] == -1 {
-		return fmt.Errorf("tree: Update Error: key %d not found (no rightmost child path)", key)
+		return fmt.Errorf("tree: Update Error:%w (no rightmost child path)", &KeyNotFoundError{Key: t.info.FormatKey(key)})
 	}
-	t.table.Cursor = currentPage.Chld[numValidKeysInNode]
-	return t.Update(key, val)
+	return t.updateAt(currentPage.Chld[numValidKeysInNode], key, val)
 }
 
-func (t tree) SelectAll() error {
+// setVal replaces the value in slot idx of the page at addr and releases the overflow
+// chain of the old one
+func (t tree) setVal(addr int32, page TreePage, idx int, val string) error {
 
-	// if table is empty
-	if t.table.SrtOff == t.table.EndOff {
-		return fmt.Errorf("tree: SelectAll Error: table is empty")
-	}
-	// if table is not empty, we need to select all from the tree
-	dsk, err := t.table.GetDiskData()
+	node, err := t.table.newNode(page.Data[idx].key(), val)
 	if err != nil {
-		return fmt.Errorf("tree: SelectAll Error:%w", err)
+		return err
 	}
-	currentPage := dsk.RecData.(TreePage)
-	if currentPage.Head.IsLeaf {
-		for _, v := range currentPage.Data {
-			if IsNodeEmpty(v) {
-				break
-			}
-			fmt.Printf("Key: %d, Value: %s\n", v.Key, v.Val)
-		}
-		return nil
+	oldNode := page.Data[idx]
+	page.Data[idx] = node
+	if err := t.table.EdtDiskData(addr, page); err != nil {
+		return err
 	}
-	for idx, chld := range currentPage.Chld {
-		if chld == -1 || chld == 0 {
-			break
-		}
-		t.table.Cursor = chld
-		err = t.SelectAll()
-		if err != nil {
-			return fmt.Errorf("tree: SelectAll Error:%w", err)
-		}
-		if idx == MAX_CHILDREN-1 {
-			break
-		}
-		if IsNodeEmpty(currentPage.Data[idx]) {
-			break
-		}
-		fmt.Printf("Key: %d, Value: %s\n", currentPage.Data[idx].Key, currentPage.Data[idx].Val)
-	}
-	return nil
+	return t.table.freeNode(oldNode)
+}
+
+// SelectAll returns an iterator over every row in key order
+func (t tree) SelectAll() (*Iterator, error) {
+	return t.Scan(nil, nil, false)
 }
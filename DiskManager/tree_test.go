@@ -0,0 +1,162 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// checkTree walks the tree of ti and fails unless its keys are exactly want, in order,
+// every page points at its parent, no page but the root is short of MinKeys, every
+// leaf is at the same depth and the file header holds the root
+func checkTree(t *testing.T, d *DiskManager, ti *TblInfo, want []int32) {
+
+	t.Helper()
+	head, err := d.GetDBHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.RootAddr != ti.SrtOff {
+		t.Fatalf("header root %d, table root %d", head.RootAddr, ti.SrtOff)
+	}
+	if ti.SrtOff == 0 {
+		if len(want) != 0 {
+			t.Fatalf("empty tree, want %d keys", len(want))
+		}
+		return
+	}
+
+	var keys []Key
+	leafDepth := -1
+	var walk func(addr, parent int32, depth int)
+	walk = func(addr, parent int32, depth int) {
+		page, err := tree{table: d, info: ti}.getPage(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Head.Parent != parent || page.Head.IsRoot != (parent == -1) {
+			t.Fatalf("page %d: parent %d root %v, found under %d", addr, page.Head.Parent, page.Head.IsRoot, parent)
+		}
+		n := NumKeys(page.Data)
+		if parent != -1 && n < d.MinKeys() {
+			t.Fatalf("page %d: %d keys, at least %d expected", addr, n, d.MinKeys())
+		}
+		if page.Head.IsLeaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			} else if depth != leafDepth {
+				t.Fatalf("page %d: leaf at depth %d, others at %d", addr, depth, leafDepth)
+			}
+			for _, node := range page.Data[:n] {
+				keys = append(keys, node.key())
+			}
+			return
+		}
+		for i := 0; i <= n; i++ {
+			walk(page.Chld[i], addr, depth+1)
+			if i < n {
+				keys = append(keys, page.Data[i].key())
+			}
+		}
+	}
+	walk(ti.SrtOff, -1, 0)
+
+	if len(keys) != len(want) {
+		t.Fatalf("%d keys in the tree, want %d", len(keys), len(want))
+	}
+	for i := range keys {
+		if CompareKeys(keys[i], Int32Key(want[i])) != 0 {
+			t.Fatalf("key %d is %x, want %d", i, []byte(keys[i]), want[i])
+		}
+	}
+}
+
+// TestTreeDelete deletes every key in several orders, so that pages borrow from their
+// left and right siblings, leaves and internal pages merge, keys of internal pages are
+// swapped with their predecessor and the root shrinks until the tree is empty
+func TestTreeDelete(t *testing.T) {
+
+	orders := map[string]func(keys []int32){
+		"ascending": func(keys []int32) {},
+		"descending": func(keys []int32) {
+			for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+				keys[i], keys[j] = keys[j], keys[i]
+			}
+		},
+		"middle out": func(keys []int32) {
+			mid := len(keys) / 2
+			out := []int32{}
+			for i := 0; i <= mid; i++ {
+				if mid+i < len(keys) {
+					out = append(out, keys[mid+i])
+				}
+				if i > 0 && mid-i >= 0 {
+					out = append(out, keys[mid-i])
+				}
+			}
+			copy(keys, out)
+		},
+		"random": func(keys []int32) {
+			rand.New(rand.NewSource(7)).Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		},
+	}
+	cases := []struct {
+		order int
+		n     int
+	}{
+		{3, 40},
+		{4, 60},
+		{5, 80},
+		{6, 100},
+	}
+
+	for _, c := range cases {
+		for name, shuffle := range orders {
+			t.Run(fmt.Sprintf("order %d %s", c.order, name), func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "app")
+				if err := CreateDatabaseAt(path, "tree", c.order, KT_INT32); err != nil {
+					t.Fatal(err)
+				}
+				d, err := InitDatabaseAt(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer d.Close()
+				table, _ := InitTable(d, "app")
+				ti, _ := d.TableInfo("app")
+
+				var remaining []int32
+				for i := 0; i < c.n; i++ {
+					if err := table.Insert(Int32Key(int32(i)), fmt.Sprint(i)); err != nil {
+						t.Fatal(err)
+					}
+					remaining = append(remaining, int32(i))
+				}
+				checkTree(t, d, ti, remaining)
+
+				del := append([]int32(nil), remaining...)
+				shuffle(del)
+				for _, k := range del {
+					if err := table.Delete(Int32Key(k)); err != nil {
+						t.Fatalf("delete %d: %v", k, err)
+					}
+					for i, r := range remaining {
+						if r == k {
+							remaining = append(remaining[:i], remaining[i+1:]...)
+							break
+						}
+					}
+					checkTree(t, d, ti, remaining)
+					if _, err := table.Select(Int32Key(k)); !errors.Is(err, ErrKeyNotFound) {
+						t.Fatalf("deleted key %d: %v", k, err)
+					}
+				}
+				if err := table.Delete(Int32Key(0)); !errors.Is(err, ErrKeyNotFound) {
+					t.Fatalf("delete from an empty tree: %v", err)
+				}
+			})
+		}
+	}
+}
@@ -4,34 +4,69 @@ import (
 	"encoding/binary"
 	"os"
 	"sync"
+	"time"
 )
 
 var (
-	TREE_FILE            string = "Data/tree"
-	LIST_FILE            string = "Data/list"
-	TEST_FILE            string = "Data/test"
-	DB_FOLDER            string = "Data/database"
-	HEADER_SIZE          int    = binary.Size(DskDataHdr{})
-	BINARY_ORDER                = binary.BigEndian
-	TBL_HEAD_SIZE        int    = binary.Size(TableHeader{})
-	TREE_PAGE_SIZE       int    = binary.Size(TreePage{})
-	LINEAR_PAGE_SIZE     int    = binary.Size(ListPage{})
-	TREE_DISKDATA_SIZE   int    = HEADER_SIZE + TREE_PAGE_SIZE
-	LINEAR_DISKDATA_SIZE int    = HEADER_SIZE + LINEAR_PAGE_SIZE
+	TREE_FILE               string = "Data/tree"
+	LIST_FILE               string = "Data/list"
+	TEST_FILE               string = "Data/test"
+	DB_FOLDER               string = "Data/database"
+	WAL_SUFFIX              string = "-wal"
+	PAGE_CACHE_SIZE         int    = 256             // pages cached per open database
+	BULK_LOAD_PAGES         int    = 256             // pending pages at which a bulk load commits
+	BUSY_TIMEOUT                   = 5 * time.Second // how long an open waits for another process
+	HEADER_SIZE             int    = binary.Size(DskDataHdr{})
+	NOSUM_HEADER_SIZE       int    = HEADER_SIZE - CHKSUM_SIZE // record header of files without FL_CHECKSUM
+	BINARY_ORDER                   = binary.BigEndian
+	TBL_HEAD_SIZE           int    = binary.Size(TableHeader{})
+	BASELINE_HEAD_SIZE      int    = binary.Size(baselineHeader{})
+	BASELINE_REC_HEAD_SIZE  int    = binary.Size(baselineRecHead{})
+	BASELINE_TREE_PAGE_SIZE int    = binary.Size(baselineTreePage{})
+	BASELINE_LIST_PAGE_SIZE int    = binary.Size(baselineListPage{})
+	TREE_HEAD_SIZE          int    = binary.Size(TreeHead{})
+	LIST_HEAD_SIZE          int    = binary.Size(ListHead{})
+	DATA_NODE_SIZE          int    = binary.Size(DataNode{})
+	OVFL_HEAD_SIZE          int    = binary.Size(OvflHead{})
+	DIR_HEAD_SIZE           int    = binary.Size(DirHead{})
+	DIR_ENTRY_SIZE          int    = binary.Size(DirEntry{})
+	WAL_HEAD_SIZE           int    = binary.Size(WalOpHead{})
+	WAL_FRAME_HEAD_SIZE     int    = binary.Size(WalFrameHead{})
 )
 
 const (
-	DB_FILE      string = "Data/"
-	TREE_ORDER   int    = 3
-	MAX_CHILDREN int    = TREE_ORDER
-	MIN_CHILDREN int    = (TREE_ORDER + 1) / 2
-	MAX_KEYS     int    = TREE_ORDER - 1
-	MIN_KEYS     int    = (TREE_ORDER+1)/2 - 1
+	DB_FILE        string = "Data/"
+	TREE_ORDER     int    = 3 // fanout of databases created without one, and of older files
+	MIN_TREE_ORDER int    = 3
+	MAX_TREE_ORDER int    = 512
+	INLINE_VAL_LEN int    = 32 // longer values are moved to a chain of overflow pages
+	KEY_SIZE       int    = 32 // longest string or bytes key
+	IDX_VAL_SIZE   int    = 24 // bytes of an index key holding the value, the rest tells rows apart
+	CHKSUM_SIZE    int    = 4  // crc32c closing the record header
+)
+
+const (
+	FILE_MAGIC     string = "sqlClone"
+	FORMAT_VERSION uint16 = 2 // version 1 is every file written before the header had a magic
+)
+
+const (
+	WAL_MAGIC uint32 = 0x57414c31 // "WAL1", marks the start of a logged operation
 )
 
 const (
 	DT_LIST_PAGE = iota
 	DT_TREE_PAGE
+	DT_OVFL_PAGE
+	DT_DIR_PAGE
+)
+
+// flags of the file header
+const (
+	FL_TREE_SIZED uint8 = 1 << iota // every record is as large as a tree page, list and tree tables can share the file
+	FL_CHECKSUM                     // record headers end in a checksum of the record
+
+	FL_KNOWN = FL_TREE_SIZED | FL_CHECKSUM // a file with any other flag is refused
 )
 
 const (
@@ -51,6 +86,8 @@ type DskDataHdr struct {
 	RecAddr int32
 	RecSize int32
 	RecType int8
+	NxtFree int32  // next record of the free list, only meaningful once Deleted
+	Chksum  uint32 // crc32c of the record with this field zeroed, not stored without FL_CHECKSUM
 }
 
 type DiskData struct {
@@ -60,22 +97,82 @@ type DiskData struct {
 
 type DiskManager struct {
 	FilObj *os.File
-	SrtOff int32
-	Cursor int32
 	EndOff int32
+	Fanout int              // children per tree page, pages hold Fanout-1 keys
+	PgSize int              // payload bytes of every record of the file
+	MuLock sync.RWMutex     // shared by lookups and scans, exclusive for anything that writes
+	WalObj *os.File         // nil for a reader of a database without a log
+	OpSavs []OpSave         // state saved by every open, possibly nested, operation
+	PndPgs map[int32][]byte // writes held back until the outermost operation commits
+	InTrxn bool             // an explicit transaction holds the outermost operation
+	PgCach *pageCache
+	ChgCnt uint64     // moved by every write, open iterators seek again when it changes
+	RdOnly bool       // opened under a shared lock, every write fails with ErrReadOnly
+	FilVer uint16     // format version of the file, older ones are read until Upgrade
+	ChkSum bool       // records carry a checksum, files from before FL_CHECKSUM do not
+	Salvge bool       // opened to salvage a damaged file, pages failing their checksum are read anyway
+	TblLst []*TblInfo // the table in the file header first, then the directory in order
+}
+
+// TblInfo is one table of a database file. The table the file was created with is
+// named after the file and keeps its root in the file header, tables added later keep
+// theirs in an entry of the table directory.
+type TblInfo struct {
+	TblNam string
+	SrtOff int32 // root page, 0 while the table is empty
 	IsTree bool
-	MuLock sync.Mutex // just in case
+	KeyTyp int8       // how keys are parsed and printed, every type compares as bytes
+	TblSch *Schema    // columns of a table made by create table, nil for a key value table
+	DirAdr int32      // directory page holding the entry of the table, 0 for the file header
+	DirIdx int        // entry of the table in that page
+	IdxCol int        // on an index, 1 + the column of TblNam it covers, 0 on a table
+	TblIdx []*TblInfo // indexes of the table
+}
+
+// OpSave is what an aborted operation rolls back to
+type OpSave struct {
+	Undo   map[int32][]byte // pending writes replaced by a nested operation, nil where none were
+	EndOff int32
 }
 
+// TableHeader starts every database file. Files of version 1 start with a shorter
+// header without the magic, the version and the page size, see baselineHeader.
 type TableHeader struct {
-	RootAddr int32
-	IsLinear bool
+	Magic     [8]byte // FILE_MAGIC
+	Version   uint16  // layout of the file, refused when newer than FORMAT_VERSION
+	PageSize  int32   // payload bytes of every record
+	TreeOrder int32   // fanout of every page, 0 in files written before it was configurable
+	Flags     uint8   // FL_ constants
+	RootAddr  int32
+	IsLinear  bool
+	FreeHead  int32    // first deleted record available for reuse, 0 when the list is empty
+	FreeCount int32    // number of records on the free list
+	KeyType   int8     // one of KT_INT32, KT_INT64, KT_STRING or KT_BYTES
+	CtlgAddr  int32    // first page of the schema catalog, 0 for a key value table
+	CtlgSize  int32    // bytes of the encoded schema
+	DirAddr   int32    // first page of the table directory, 0 until a table is added
+	Reserved  [16]byte // room for later header fields without moving the first page
 }
 
+// one logical operation in the write-ahead log is a WalOpHead, BodyLen bytes of
+// frames (a WalFrameHead followed by the bytes written at that offset) and a
+// crc32 of everything before it
+type WalOpHead struct {
+	Magic   uint32
+	Frames  int32
+	BodyLen int32
+}
+
+type WalFrameHead struct {
+	Offset int32
+	Length int32
+}
+
+// Data always holds Fanout-1 slots and Chld Fanout slots, unused slots stay zero
 type TreePage struct {
 	Head TreeHead
-	Data [MAX_KEYS]DataNode
-	Chld [MAX_CHILDREN]int32
+	Data []DataNode
+	Chld []int32
 }
 
 type TreeHead struct {
@@ -84,9 +181,10 @@ type TreeHead struct {
 	Parent int32
 }
 
+// Data always holds Fanout-1 slots, unused slots stay zero
 type ListPage struct {
 	Head ListHead
-	Data [MAX_KEYS]DataNode
+	Data []DataNode
 	Chld int32
 }
 
@@ -94,9 +192,56 @@ type ListHead struct {
 	Parent int32
 }
 
+// Key holds KLen bytes of the encoded key. Size is the exact value length, values up
+// to INLINE_VAL_LEN bytes live in Val and longer ones in the overflow chain starting
+// at Ovfl.
 type DataNode struct {
-	Key int32
-	Val [32]byte
+	Key  [KEY_SIZE]byte
+	KLen uint8
+	Size int32
+	Ovfl int32
+	Val  [INLINE_VAL_LEN]byte
+}
+
+// OvflPage holds one chunk of a long value, overflow records are as large as the table
+// pages of their database so every record of a file has the same size
+type OvflPage struct {
+	Head OvflHead
+	Data []byte
+}
+
+type OvflHead struct {
+	Next int32 // next page of the chain, 0 on the last one
+	Size int32 // bytes of Data in use
+}
+
+// DirPage lists the tables added to a database after the one it was created with.
+// Ents always holds as many entries as fit in a record, a free entry has NLen 0.
+type DirPage struct {
+	Head DirHead
+	Ents []DirEntry
+}
+
+type DirHead struct {
+	Next int32 // next page of the directory, 0 on the last one
+}
+
+type DirEntry struct {
+	Name     [KEY_SIZE]byte
+	NLen     uint8
+	RootAddr int32 // 0 while the table is empty
+	IsLinear bool
+	KeyType  int8
+	CtlgAddr int32 // first page of the schema catalog, 0 for a key value table
+	CtlgSize int32
+	// on an index, 1 + the column it covers. Name is the table of the index, empty for
+	// the table the file was created with.
+	IdxCol uint8
+}
+
+// free tells whether the slot holds neither a table nor an index
+func (ent DirEntry) free() bool {
+	return ent.NLen == 0 && ent.IdxCol == 0
 }
 
 type Data interface {
@@ -9,14 +9,10 @@ import (
 )
 
 func IsNodeEmpty(n DataNode) bool {
-	empty := [32]byte{}
-	if n.Key == 0 && n.Val == empty {
-		return true
-	}
-	return false
+	return n == DataNode{}
 }
 
-func IsNodesEmpty(nodes [MAX_KEYS]DataNode) bool {
+func IsNodesEmpty(nodes []DataNode) bool {
 
 	for _, node := range nodes {
 		if !IsNodeEmpty(node) {
@@ -26,6 +22,19 @@ func IsNodesEmpty(nodes [MAX_KEYS]DataNode) bool {
 	return true
 }
 
+// NumKeys counts the occupied slots of a page, occupied slots are always packed at the front
+func NumKeys(nodes []DataNode) int {
+
+	count := 0
+	for _, node := range nodes {
+		if IsNodeEmpty(node) {
+			break
+		}
+		count++
+	}
+	return count
+}
+
 func DBExists(name string) (bool, error) {
 	_, err := os.Stat(name)
 	if err == nil {
@@ -37,17 +46,6 @@ func DBExists(name string) (bool, error) {
 	return false, err
 }
 
-func String2ByteArr(str string) [32]byte {
-
-	var buf [32]byte
-	copy(buf[:], []byte(str))
-	return buf
-}
-
-func ByteArr2String(buf [32]byte) string {
-	return string(bytes.Trim(buf[:], "\x00"))
-}
-
 func SerializeDiskData(data *DiskData) ([]byte, error) {
 
 	if data == nil {
@@ -68,8 +66,10 @@ func SerializeDiskData(data *DiskData) ([]byte, error) {
 			return nil, fmt.Errorf("invalid RecData type: expected ListPage, got %T for RecType DT_LIST_PAGE", data.RecData)
 		}
 
-		if err := binary.Write(buf, BINARY_ORDER, listPageData); err != nil {
-			return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_LIST_PAGE): %s", err.Error())
+		for _, field := range []interface{}{listPageData.Head, listPageData.Data, listPageData.Chld} {
+			if err := binary.Write(buf, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_LIST_PAGE): %s", err.Error())
+			}
 		}
 
 	case DT_TREE_PAGE:
@@ -79,18 +79,53 @@ func SerializeDiskData(data *DiskData) ([]byte, error) {
 			return nil, fmt.Errorf("invalid RecData type: expected TreePage, got %T for RecType DT_TREE_PAGE", data.RecData)
 		}
 
-		if err := binary.Write(buf, BINARY_ORDER, treePageData); err != nil {
-			return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_TREE_PAGE): %s", err.Error())
+		for _, field := range []interface{}{treePageData.Head, treePageData.Data, treePageData.Chld} {
+			if err := binary.Write(buf, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_TREE_PAGE): %s", err.Error())
+			}
+		}
+
+	case DT_OVFL_PAGE:
+
+		ovflPageData, ok := data.RecData.(OvflPage)
+		if !ok {
+			return nil, fmt.Errorf("invalid RecData type: expected OvflPage, got %T for RecType DT_OVFL_PAGE", data.RecData)
+		}
+
+		for _, field := range []interface{}{ovflPageData.Head, ovflPageData.Data} {
+			if err := binary.Write(buf, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_OVFL_PAGE): %s", err.Error())
+			}
+		}
+
+	case DT_DIR_PAGE:
+
+		dirPageData, ok := data.RecData.(DirPage)
+		if !ok {
+			return nil, fmt.Errorf("invalid RecData type: expected DirPage, got %T for RecType DT_DIR_PAGE", data.RecData)
+		}
+
+		for _, field := range []interface{}{dirPageData.Head, dirPageData.Ents} {
+			if err := binary.Write(buf, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData serialisation error, writing PageData(DT_DIR_PAGE): %s", err.Error())
+			}
 		}
 
 	default:
 		return nil, fmt.Errorf("DiskData serialisation error: invalid data type")
 	}
 
+	// pages smaller than the records of the file, such as list pages next to tree
+	// tables, are padded so every record is written whole
+	if pad := HEADER_SIZE + int(data.RecHead.RecSize) - buf.Len(); pad > 0 {
+		buf.Write(make([]byte, pad))
+	}
+	sumRecord(buf.Bytes())
 	return buf.Bytes(), nil
 }
 
-func DeserializeDskData(buf []byte) (*DiskData, error) {
+// order is the fanout of the database the record was read from, it sizes the page slots
+func DeserializeDskData(buf []byte, order int) (*DiskData, error) {
 
 	var data *DiskData = &DiskData{}
 	reader := bytes.NewReader(buf)
@@ -100,21 +135,51 @@ func DeserializeDskData(buf []byte) (*DiskData, error) {
 	}
 	switch data.RecHead.RecType {
 	case DT_LIST_PAGE:
-		var listpge *ListPage = &ListPage{}
-		if err := binary.Read(reader, BINARY_ORDER, listpge); err != nil {
-			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_LIST_PAGE): %w", err)
+		var listpge *ListPage = &ListPage{Data: make([]DataNode, order-1)}
+		for _, field := range []interface{}{&listpge.Head, listpge.Data, &listpge.Chld} {
+			if err := binary.Read(reader, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_LIST_PAGE): %w", err)
+			}
 		}
 
 		data.RecData = *listpge
 
 	case DT_TREE_PAGE:
-		var treepge *TreePage = &TreePage{}
+		var treepge *TreePage = &TreePage{Data: make([]DataNode, order-1), Chld: make([]int32, order)}
 
-		if err := binary.Read(reader, BINARY_ORDER, treepge); err != nil {
-			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_TREE_PAGE): %w", err)
+		for _, field := range []interface{}{&treepge.Head, treepge.Data, treepge.Chld} {
+			if err := binary.Read(reader, BINARY_ORDER, field); err != nil {
+				return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_TREE_PAGE): %w", err)
+			}
 		}
 
 		data.RecData = *treepge
+
+	case DT_OVFL_PAGE:
+		// the chunk fills the rest of the record
+		var ovflpge *OvflPage = &OvflPage{}
+		if err := binary.Read(reader, BINARY_ORDER, &ovflpge.Head); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_OVFL_PAGE): %w", err)
+		}
+		ovflpge.Data = make([]byte, reader.Len())
+		if _, err := reader.Read(ovflpge.Data); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_OVFL_PAGE): %w", err)
+		}
+
+		data.RecData = *ovflpge
+
+	case DT_DIR_PAGE:
+		// as many entries as fit in the rest of the record
+		var dirpge *DirPage = &DirPage{}
+		if err := binary.Read(reader, BINARY_ORDER, &dirpge.Head); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_DIR_PAGE): %w", err)
+		}
+		dirpge.Ents = make([]DirEntry, reader.Len()/DIR_ENTRY_SIZE)
+		if err := binary.Read(reader, BINARY_ORDER, dirpge.Ents); err != nil {
+			return nil, fmt.Errorf("DiskData deserialisation error, reading PageData(DT_DIR_PAGE): %w", err)
+		}
+
+		data.RecData = *dirpge
 	default:
 		return nil, fmt.Errorf("DiskData deserialisation error: invalid data type")
 	}
@@ -0,0 +1,324 @@
+package diskmanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Vacuum copies the table directory and the catalog and every page reachable from the
+// root of each table into a fresh file, remapping the Chld, Parent, Next, RootAddr,
+// CtlgAddr and DirAddr pointers to the new layout, and atomically renames it over the
+// database file. Deleted and orphaned records are left
+// behind. It returns the number of bytes reclaimed.
+func (d *DiskManager) Vacuum() (int64, error) {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	reclaimed, err := d.rewrite(false)
+	if err != nil {
+		return 0, fmt.Errorf("Vacuum error: %w", err)
+	}
+	return reclaimed, nil
+}
+
+// rewrite is Vacuum, and Upgrade when upgrade is set, which writes the new file in
+// the layout of FORMAT_VERSION whatever the version of the old one
+func (d *DiskManager) rewrite(upgrade bool) (int64, error) {
+
+	// Upgrade is the one write a version 1 file takes
+	if err := d.writable(); err != nil && (d.RdOnly || !upgrade) {
+		return 0, err
+	}
+	if len(d.OpSavs) > 0 {
+		return 0, fmt.Errorf("cannot rewrite the file inside an open operation")
+	}
+	head, err := d.GetDBHeader()
+	if err != nil {
+		return 0, err
+	}
+	// the catalog goes first, where create table put it, then the table and the
+	// directory followed by the catalog and pages of every table it lists
+	livePages, err := d.tablePages(head.CtlgAddr, head.RootAddr)
+	if err != nil {
+		return 0, err
+	}
+	dirPages, err := d.livePages(head.DirAddr)
+	if err != nil {
+		return 0, err
+	}
+	livePages = append(livePages, dirPages...)
+	for _, dsk := range dirPages {
+		for _, ent := range dsk.RecData.(DirPage).Ents {
+			if ent.free() {
+				continue
+			}
+			pages, err := d.tablePages(ent.CtlgAddr, ent.RootAddr)
+			if err != nil {
+				return 0, fmt.Errorf("table %s: %w", ent.Name[:ent.NLen], err)
+			}
+			livePages = append(livePages, pages...)
+		}
+	}
+
+	newHead := *head
+	sums := d.ChkSum
+	pageSize := d.PgSize
+	if upgrade {
+		// version 1 pages grow to the current nodes, sized for a tree so that tables
+		// of either type can be added
+		if d.FilVer < 2 {
+			pageSize = TreePageSize(d.Fanout)
+			newHead.Flags |= FL_TREE_SIZED
+		}
+		copy(newHead.Magic[:], FILE_MAGIC)
+		newHead.Version = FORMAT_VERSION
+		newHead.PageSize = int32(pageSize)
+		newHead.TreeOrder = int32(d.Fanout)
+		newHead.Flags |= FL_CHECKSUM
+		sums = true
+	}
+	nextAddr := int32(TBL_HEAD_SIZE)
+	recSize := NOSUM_HEADER_SIZE + pageSize
+	if sums {
+		recSize = HEADER_SIZE + pageSize
+	}
+
+	// live pages are packed right after the header in traversal order
+	remap := make(map[int32]int32, len(livePages))
+	for _, pge := range livePages {
+		remap[pge.RecHead.RecAddr] = nextAddr
+		nextAddr += int32(recSize)
+	}
+	// version 1 did not keep the parents of its pages up to date, they are taken from
+	// the traversal instead
+	parents := map[int32]int32{}
+	if d.FilVer < 2 {
+		for _, pge := range livePages {
+			switch page := pge.RecData.(type) {
+			case TreePage:
+				if !page.Head.IsLeaf {
+					for _, chld := range page.Chld[:NumKeys(page.Data)+1] {
+						parents[chld] = pge.RecHead.RecAddr
+					}
+				}
+			case ListPage:
+				if page.Chld != -1 {
+					parents[page.Chld] = pge.RecHead.RecAddr
+				}
+			}
+		}
+	}
+	parentOf := func(addr int32) (int32, bool) {
+		if parent, ok := parents[addr]; ok {
+			return parent, true
+		}
+		return -1, false
+	}
+	mapAddr := func(addr int32) int32 {
+		if newAddr, ok := remap[addr]; ok {
+			return newAddr
+		}
+		return addr
+	}
+
+	dbFile := d.FilObj.Name()
+	tmpFile := dbFile + ".vacuum"
+	file, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+	if err != nil {
+		return 0, fmt.Errorf("create file error: %w", err)
+	}
+	defer os.Remove(tmpFile)
+
+	newHead.RootAddr = mapAddr(head.RootAddr)
+	newHead.CtlgAddr = mapAddr(head.CtlgAddr)
+	newHead.DirAddr = mapAddr(head.DirAddr)
+	newHead.FreeHead = 0
+	newHead.FreeCount = 0
+	buf, err := encodeHeader(newHead)
+	if err != nil {
+		file.Close()
+		return 0, fmt.Errorf("header to bytes failed: %w", err)
+	}
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("write header failed: %w", err)
+	}
+
+	for _, pge := range livePages {
+		addr := pge.RecHead.RecAddr
+		pge.RecHead.RecAddr = remap[addr]
+		pge.RecHead.RecSize = int32(pageSize)
+		pge.RecHead.NxtFree = 0
+		switch page := pge.RecData.(type) {
+		case TreePage:
+			if d.FilVer < 2 {
+				parent, ok := parentOf(addr)
+				page.Head.Parent, page.Head.IsRoot = parent, !ok
+			}
+			page.Head.Parent = mapAddr(page.Head.Parent)
+			if !page.Head.IsLeaf {
+				for i, chld := range page.Chld {
+					page.Chld[i] = mapAddr(chld)
+				}
+			}
+			remapOvfl(page.Data, mapAddr)
+			pge.RecData = page
+		case ListPage:
+			if d.FilVer < 2 {
+				page.Head.Parent, _ = parentOf(addr)
+			}
+			page.Head.Parent = mapAddr(page.Head.Parent)
+			page.Chld = mapAddr(page.Chld)
+			remapOvfl(page.Data, mapAddr)
+			pge.RecData = page
+		case OvflPage:
+			page.Head.Next = mapAddr(page.Head.Next)
+			pge.RecData = page
+		case DirPage:
+			page.Head.Next = mapAddr(page.Head.Next)
+			for i := range page.Ents {
+				page.Ents[i].RootAddr = mapAddr(page.Ents[i].RootAddr)
+				page.Ents[i].CtlgAddr = mapAddr(page.Ents[i].CtlgAddr)
+			}
+			pge.RecData = page
+		}
+		recBuf, err := encodeRecord(pge, sums)
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+		if _, err := file.WriteAt(recBuf, int64(pge.RecHead.RecAddr)); err != nil {
+			file.Close()
+			return 0, fmt.Errorf("write page failed: %w", err)
+		}
+	}
+
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("sync failed: %w", err)
+	}
+	// windows cannot rename over a file that is open, both are closed first. The lock
+	// is held on the log, which stays open.
+	d.FilObj.Close()
+	if err := os.Rename(tmpFile, dbFile); err != nil {
+		return 0, errors.Join(fmt.Errorf("replace file failed: %w", err), d.reopen(dbFile))
+	}
+	if err := d.reopen(dbFile); err != nil {
+		return 0, err
+	}
+
+	reclaimed := int64(d.EndOff - nextAddr)
+	d.EndOff = nextAddr
+	d.FilVer = newHead.Version
+	d.PgSize = pageSize
+	d.ChkSum = sums
+	d.ChgCnt++
+	d.PgCach.clear()
+	if err := d.loadTables(); err != nil {
+		return 0, err
+	}
+	// the rename only survives a crash once the directory is flushed, the caller must not
+	// write to the new file if this fails
+	if err := syncDir(dbFile); err != nil {
+		return 0, fmt.Errorf("sync directory failed: %w", err)
+	}
+	return reclaimed, nil
+}
+
+// reopen opens the database file again after a rewrite closed it
+func (d *DiskManager) reopen(dbFile string) error {
+
+	file, err := os.OpenFile(dbFile, os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("reopen file failed: %w", err)
+	}
+	// closing the file let go of its lock
+	if err := lockDatabase(file, true, 0); err != nil {
+		file.Close()
+		return fmt.Errorf("reopen file failed: %w", err)
+	}
+	d.FilObj = file
+	return nil
+}
+
+func remapOvfl(nodes []DataNode, mapAddr func(int32) int32) {
+	for i := range nodes {
+		if nodes[i].Ovfl != 0 {
+			nodes[i].Ovfl = mapAddr(nodes[i].Ovfl)
+		}
+	}
+}
+
+// tablePages returns the catalog pages of a table followed by its live pages
+func (d *DiskManager) tablePages(ctlgAddr, rootAddr int32) ([]*DiskData, error) {
+
+	pages, err := d.livePages(ctlgAddr)
+	if err != nil {
+		return nil, err
+	}
+	tablePages, err := d.livePages(rootAddr)
+	if err != nil {
+		return nil, err
+	}
+	return append(pages, tablePages...), nil
+}
+
+// livePages walks the table from rootAddr and returns every reachable page, parents
+// before their children for trees and in chain order for lists and directories.
+// Overflow chains are queued behind the page holding their value.
+func (d *DiskManager) livePages(rootAddr int32) ([]*DiskData, error) {
+
+	// empty table, or no catalog or directory
+	if rootAddr == 0 {
+		return nil, nil
+	}
+
+	var pages []*DiskData
+	queue := []int32{rootAddr}
+	for len(queue) > 0 {
+		dsk, err := d.GetDiskData(queue[0])
+		queue = queue[1:]
+		if err != nil {
+			return nil, fmt.Errorf("livePages error: %w", err)
+		}
+		pages = append(pages, dsk)
+
+		switch page := dsk.RecData.(type) {
+		case TreePage:
+			queue = appendOvfl(queue, page.Data)
+			if page.Head.IsLeaf {
+				continue
+			}
+			for _, chld := range page.Chld[:NumKeys(page.Data)+1] {
+				queue = append(queue, chld)
+			}
+		case ListPage:
+			queue = appendOvfl(queue, page.Data)
+			if page.Chld != -1 {
+				queue = append(queue, page.Chld)
+			}
+		case OvflPage:
+			if page.Head.Next != 0 {
+				queue = append(queue, page.Head.Next)
+			}
+		case DirPage:
+			if page.Head.Next != 0 {
+				queue = append(queue, page.Head.Next)
+			}
+		}
+	}
+	return pages, nil
+}
+
+func appendOvfl(queue []int32, nodes []DataNode) []int32 {
+	for _, node := range nodes {
+		if node.Ovfl != 0 {
+			queue = append(queue, node.Ovfl)
+		}
+	}
+	return queue
+}
@@ -0,0 +1,296 @@
+package diskmanager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// BeginOp opens a logical operation. Until the outermost CommitOp every write is kept
+// in memory and reads see those pending writes first. Operations nest, aborting an
+// inner one only drops the writes made since it began.
+func (d *DiskManager) BeginOp() {
+
+	saved := OpSave{EndOff: d.EndOff}
+	if len(d.OpSavs) == 0 {
+		d.PndPgs = make(map[int32][]byte)
+	} else {
+		saved.Undo = make(map[int32][]byte)
+	}
+	d.OpSavs = append(d.OpSavs, saved)
+}
+
+// CommitOp closes a logical operation. The outermost commit appends every pending
+// write to the write-ahead log and fsyncs it before the database file is touched.
+func (d *DiskManager) CommitOp() error {
+
+	if len(d.OpSavs) == 0 {
+		return fmt.Errorf("CommitOp error: no open operation")
+	}
+	saved := d.OpSavs[len(d.OpSavs)-1]
+	d.OpSavs = d.OpSavs[:len(d.OpSavs)-1]
+	if len(d.OpSavs) > 0 {
+		// an abort of the enclosing operation now undoes these writes too, where
+		// both wrote the same page the enclosing one saw it first
+		if parent := d.OpSavs[len(d.OpSavs)-1]; parent.Undo != nil {
+			for off, prev := range saved.Undo {
+				if _, ok := parent.Undo[off]; !ok {
+					parent.Undo[off] = prev
+				}
+			}
+		}
+		return nil
+	}
+	pending := d.PndPgs
+	d.PndPgs = nil
+	if len(pending) == 0 {
+		return nil
+	}
+
+	offsets := make([]int32, 0, len(pending))
+	for off := range pending {
+		offsets = append(offsets, off)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	body := new(bytes.Buffer)
+	for _, off := range offsets {
+		frame := WalFrameHead{Offset: off, Length: int32(len(pending[off]))}
+		if err := binary.Write(body, BINARY_ORDER, frame); err != nil {
+			return fmt.Errorf("CommitOp error, frame to bytes failed: %w", err)
+		}
+		body.Write(pending[off])
+	}
+	buf := new(bytes.Buffer)
+	opHead := WalOpHead{Magic: WAL_MAGIC, Frames: int32(len(offsets)), BodyLen: int32(body.Len())}
+	if err := binary.Write(buf, BINARY_ORDER, opHead); err != nil {
+		return fmt.Errorf("CommitOp error, header to bytes failed: %w", err)
+	}
+	buf.Write(body.Bytes())
+	if err := binary.Write(buf, BINARY_ORDER, crc32.ChecksumIEEE(buf.Bytes())); err != nil {
+		return fmt.Errorf("CommitOp error, checksum to bytes failed: %w", err)
+	}
+
+	if _, err := d.WalObj.WriteAt(buf.Bytes(), 0); err != nil {
+		return d.failCommit(saved, fmt.Errorf("CommitOp error, write log failed: %w", err))
+	}
+	if err := d.WalObj.Sync(); err != nil {
+		return d.failCommit(saved, fmt.Errorf("CommitOp error, sync log failed: %w", err))
+	}
+
+	// the operation is durable from here on, a crash while applying it is replayed
+	for _, off := range offsets {
+		if _, err := d.FilObj.WriteAt(pending[off], int64(off)); err != nil {
+			return fmt.Errorf("CommitOp error, apply write at %d failed: %w", off, err)
+		}
+	}
+	if err := d.FilObj.Sync(); err != nil {
+		return fmt.Errorf("CommitOp error, sync database failed: %w", err)
+	}
+	if err := d.WalObj.Truncate(0); err != nil {
+		return fmt.Errorf("CommitOp error, truncate log failed: %w", err)
+	}
+	d.PgCach.markClean()
+	return nil
+}
+
+// failCommit rolls back an outermost operation whose log could not be written, like
+// AbortOp would, since its save is gone the caller cannot abort it any more. What made
+// it into the log is cut off, a later recovery must not replay an operation that failed.
+func (d *DiskManager) failCommit(saved OpSave, err error) error {
+
+	d.EndOff = saved.EndOff
+	d.ChgCnt++
+	d.PgCach.dropDirty()
+	if truncErr := d.WalObj.Truncate(0); truncErr != nil {
+		err = fmt.Errorf("%w (truncate log failed: %s)", err, truncErr.Error())
+	}
+	if loadErr := d.loadTables(); loadErr != nil {
+		err = fmt.Errorf("%w (reload tables failed: %s)", err, loadErr.Error())
+	}
+	return err
+}
+
+// AbortOp throws away the pending writes of the innermost open operation and restores
+// the in memory offsets and tables from the file as that operation found it
+func (d *DiskManager) AbortOp() error {
+
+	if len(d.OpSavs) == 0 {
+		return fmt.Errorf("AbortOp error: no open operation")
+	}
+	saved := d.OpSavs[len(d.OpSavs)-1]
+	d.OpSavs = d.OpSavs[:len(d.OpSavs)-1]
+	if len(d.OpSavs) == 0 {
+		d.PndPgs = nil
+	}
+	for off, prev := range saved.Undo {
+		if prev == nil {
+			delete(d.PndPgs, off)
+		} else {
+			d.PndPgs[off] = prev
+		}
+	}
+	d.EndOff = saved.EndOff
+	d.ChgCnt++
+	d.PgCach.dropDirty()
+	if err := d.loadTables(); err != nil {
+		return fmt.Errorf("AbortOp error: %w", err)
+	}
+	return nil
+}
+
+// Begin starts a transaction, every statement until Commit is applied as one operation.
+// There is one transaction per database, writes made from other goroutines while it is
+// open become part of it.
+func (d *DiskManager) Begin() error {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	if err := d.writable(); err != nil {
+		return fmt.Errorf("Begin error: %w", err)
+	}
+	if d.InTrxn {
+		return fmt.Errorf("Begin error: transaction already open")
+	}
+	d.BeginOp()
+	d.InTrxn = true
+	return nil
+}
+
+// Commit makes every change of the open transaction durable at once
+func (d *DiskManager) Commit() error {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	if !d.InTrxn {
+		return fmt.Errorf("Commit error: no open transaction")
+	}
+	d.InTrxn = false
+	err := d.CommitOp()
+	if err != nil {
+		return fmt.Errorf("Commit error: %w", err)
+	}
+	return nil
+}
+
+// Rollback drops every change of the open transaction, none of it ever reached the file
+func (d *DiskManager) Rollback() error {
+
+	d.MuLock.Lock()
+	defer d.MuLock.Unlock()
+	if !d.InTrxn {
+		return fmt.Errorf("Rollback error: no open transaction")
+	}
+	d.InTrxn = false
+	err := d.AbortOp()
+	if err != nil {
+		return fmt.Errorf("Rollback error: %w", err)
+	}
+	return nil
+}
+
+// InTransaction reports whether Begin opened a transaction that is still open
+func (d *DiskManager) InTransaction() bool {
+
+	d.MuLock.RLock()
+	defer d.MuLock.RUnlock()
+	return d.InTrxn
+}
+
+// readAt reads from the database file, serving writes of the open operation first
+func (d *DiskManager) readAt(buf []byte, off int32) (int, error) {
+
+	if pending, ok := d.PndPgs[off]; ok && len(pending) >= len(buf) {
+		return copy(buf, pending), nil
+	}
+	return d.FilObj.ReadAt(buf, int64(off))
+}
+
+// writeAt writes to the database file directly, or holds the write back while an
+// operation is open
+func (d *DiskManager) writeAt(buf []byte, off int32) (int, error) {
+
+	if err := d.writable(); err != nil {
+		return 0, err
+	}
+	d.ChgCnt++
+	if len(d.OpSavs) == 0 {
+		return d.FilObj.WriteAt(buf, int64(off))
+	}
+	// the first write of a nested operation to a page saves what was pending there,
+	// nil for nothing, never modify a pending slice in place as the save shares it
+	if undo := d.OpSavs[len(d.OpSavs)-1].Undo; undo != nil {
+		if _, ok := undo[off]; !ok {
+			undo[off] = d.PndPgs[off]
+		}
+	}
+	pending := bytes.Clone(buf)
+	if prev, ok := d.PndPgs[off]; ok && len(prev) > len(buf) {
+		pending = append(pending, prev[len(buf):]...)
+	}
+	d.PndPgs[off] = pending
+	return len(buf), nil
+}
+
+// recoverWal replays every complete operation left in the write-ahead log onto the
+// database file and discards a trailing operation that was only partially logged
+func recoverWal(file *os.File, wal *os.File) error {
+
+	info, err := wal.Stat()
+	if err != nil {
+		return fmt.Errorf("recoverWal error: %w", err)
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	logBuf := make([]byte, info.Size())
+	if _, err := wal.ReadAt(logBuf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("recoverWal error, read log failed: %w", err)
+	}
+
+	reader := bytes.NewReader(logBuf)
+	for {
+		start := len(logBuf) - reader.Len()
+		opHead := WalOpHead{}
+		if err := binary.Read(reader, BINARY_ORDER, &opHead); err != nil {
+			break
+		}
+		if opHead.Magic != WAL_MAGIC || opHead.BodyLen < 0 || int(opHead.BodyLen)+4 > reader.Len() {
+			break
+		}
+		end := start + WAL_HEAD_SIZE + int(opHead.BodyLen)
+		checksum := BINARY_ORDER.Uint32(logBuf[end : end+4])
+		if crc32.ChecksumIEEE(logBuf[start:end]) != checksum {
+			break
+		}
+
+		body := bytes.NewReader(logBuf[start+WAL_HEAD_SIZE : end])
+		for i := int32(0); i < opHead.Frames; i++ {
+			frame := WalFrameHead{}
+			if err := binary.Read(body, BINARY_ORDER, &frame); err != nil {
+				return fmt.Errorf("recoverWal error, frame decode error: %w", err)
+			}
+			data := make([]byte, frame.Length)
+			if _, err := io.ReadFull(body, data); err != nil {
+				return fmt.Errorf("recoverWal error, frame decode error: %w", err)
+			}
+			if _, err := file.WriteAt(data, int64(frame.Offset)); err != nil {
+				return fmt.Errorf("recoverWal error, replay write at %d failed: %w", frame.Offset, err)
+			}
+		}
+		reader.Seek(int64(end+4), io.SeekStart)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("recoverWal error, sync database failed: %w", err)
+	}
+	if err := wal.Truncate(0); err != nil {
+		return fmt.Errorf("recoverWal error, truncate log failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package diskmanager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCommitLogFailure makes the log refuse writes, a commit that cannot be logged has
+// to leave the database as the operation found it and the next commit has to work
+func TestCommitLogFailure(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	table, _ := InitTable(d, "app")
+	for i := 0; i < 20; i++ {
+		if err := table.Insert(Int32Key(int32(i)), "before"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	endOff := d.EndOff
+	root := d.Tables()[0].SrtOff
+
+	// a read only handle on the log fails every write
+	wal := d.WalObj
+	d.WalObj, err = os.Open(wal.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 20; i < 60; i++ {
+		if err := table.Insert(Int32Key(int32(i)), "lost"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.AddTable("lost", "tree", KT_INT32, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Commit(); err == nil {
+		t.Fatal("expected the commit to fail on a log that refuses writes")
+	}
+	if err := table.Insert(Int32Key(60), "lost"); err == nil {
+		t.Fatal("expected the insert to fail on a log that refuses writes")
+	}
+	d.WalObj.Close()
+	d.WalObj = wal
+
+	if d.EndOff != endOff || len(d.OpSavs) != 0 || d.PndPgs != nil {
+		t.Fatalf("end %d, want %d, %d open operations, %d pending pages", d.EndOff, endOff, len(d.OpSavs), len(d.PndPgs))
+	}
+	if _, err := d.TableInfo("lost"); err == nil {
+		t.Fatal("table lost survived the failed commit")
+	}
+	ti, _ := d.TableInfo("app")
+	if ti.SrtOff != root {
+		t.Fatalf("root %d, want %d", ti.SrtOff, root)
+	}
+	checkTree(t, d, ti, seq(20))
+	if _, err := table.Select(Int32Key(30)); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("row of the failed commit: %v", err)
+	}
+
+	// the same writes go through once the log takes them
+	for i := 20; i < 60; i++ {
+		if err := table.Insert(Int32Key(int32(i)), "after"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkTree(t, d, ti, seq(60))
+	if report, err := d.IntegrityCheck(); err != nil || !report.OK() {
+		t.Fatalf("integrity check %+v, %v", report, err)
+	}
+}
+
+// TestNestedOps aborts and commits operations nested in one another, an abort has to
+// bring back exactly the pending writes its operation found
+func TestNestedOps(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "app")
+	if err := CreateDatabaseAt(path, "tree", 4, KT_INT32); err != nil {
+		t.Fatal(err)
+	}
+	d, err := InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// pages past the end of the file, only ever pending
+	a, b, c := d.EndOff, d.EndOff+100, d.EndOff+200
+	write := func(off int32, text string) {
+		if _, err := d.writeAt([]byte(text), off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(step string, want map[int32]string) {
+		t.Helper()
+		if len(d.PndPgs) != len(want) {
+			t.Fatalf("%s: %d pending pages, want %d", step, len(d.PndPgs), len(want))
+		}
+		for off, text := range want {
+			if got := string(d.PndPgs[off]); got != text {
+				t.Fatalf("%s: %q pending at %d, want %q", step, got, off, text)
+			}
+		}
+	}
+
+	d.BeginOp()
+	write(a, "a1")
+	d.BeginOp()
+	write(a, "a2")
+	write(b, "b2")
+	d.BeginOp()
+	write(b, "b3")
+	write(a, "a")
+	write(c, "c3")
+	if err := d.CommitOp(); err != nil {
+		t.Fatal(err)
+	}
+	expect("inner commit", map[int32]string{a: "a2", b: "b3", c: "c3"})
+	if err := d.AbortOp(); err != nil {
+		t.Fatal(err)
+	}
+	expect("abort after an inner commit", map[int32]string{a: "a1"})
+
+	d.BeginOp()
+	write(b, "b4")
+	d.BeginOp()
+	write(b, "b5")
+	if err := d.AbortOp(); err != nil {
+		t.Fatal(err)
+	}
+	expect("inner abort", map[int32]string{a: "a1", b: "b4"})
+	if err := d.CommitOp(); err != nil {
+		t.Fatal(err)
+	}
+	expect("commit after an inner abort", map[int32]string{a: "a1", b: "b4"})
+
+	if err := d.AbortOp(); err != nil {
+		t.Fatal(err)
+	}
+	if d.PndPgs != nil || len(d.OpSavs) != 0 {
+		t.Fatalf("%d pending pages, %d open operations after the outermost abort", len(d.PndPgs), len(d.OpSavs))
+	}
+}
+
+// seq returns the keys 0 to n-1
+func seq(n int) []int32 {
+
+	keys := make([]int32, n)
+	for i := range keys {
+		keys[i] = int32(i)
+	}
+	return keys
+}
@@ -0,0 +1,238 @@
+package parser
+
+// Stmt is one statement of the input, the concrete types below are its nodes
+type Stmt interface {
+	Start() Pos
+}
+
+// Literal is a key, a value or an option argument as it was typed. Keys are only
+// given a type once the database they are used on is known.
+type Literal struct {
+	Pos  Pos
+	Kind TokenKind // TK_WORD, TK_NUMBER or TK_STRING
+	Text string
+}
+
+// Option is a name value pair trailing a statement, such as order 4 or key string
+type Option struct {
+	Pos   Pos
+	Name  string // lower case
+	Value Literal
+}
+
+type BeginStmt struct {
+	Pos Pos
+}
+
+type CommitStmt struct {
+	Pos Pos
+}
+
+type RollbackStmt struct {
+	Pos Pos
+}
+
+// InsertStmt is insert or, with Upsert set, upsert. A row of a table made by create
+// table is given as Values, in column order, and leaves Key and Value empty. Table is
+// empty unless the statement names one, in this and the statements below.
+type InsertStmt struct {
+	Pos    Pos
+	Upsert bool
+	Table  Literal
+	Key    Literal
+	Value  Literal
+	Values []Literal
+}
+
+// SelectStmt reads one key or, with All set, every row or the rows matching Where
+type SelectStmt struct {
+	Pos   Pos
+	All   bool
+	Key   Literal
+	Table Literal
+	Where Expr // nil without a where clause
+}
+
+// UpdateStmt replaces the Value of Key or, on a table made by create table, the
+// columns named in Set. With Where the columns are set on every matching row and Key
+// is empty.
+type UpdateStmt struct {
+	Pos   Pos
+	Key   Literal
+	Value Literal
+	Set   []Assignment
+	Table Literal
+	Where Expr
+}
+
+// Assignment is one column = value of update set
+type Assignment struct {
+	Pos    Pos
+	Column Literal
+	Value  Literal
+}
+
+// DeleteStmt deletes Key or, with Where, every matching row
+type DeleteStmt struct {
+	Pos   Pos
+	Key   Literal
+	Table Literal
+	Where Expr
+}
+
+// ScanStmt is an inclusive key range, Limit 0 returns every row in it
+type ScanStmt struct {
+	Pos   Pos
+	From  Literal
+	To    Literal
+	Limit int
+	Desc  bool
+	Table Literal
+}
+
+// CreateStmt creates a database of Type tree or list
+type CreateStmt struct {
+	Pos     Pos
+	Name    Literal
+	Type    Literal
+	Options []Option
+}
+
+// CreateTableStmt creates a table whose rows have Columns, or a key value table when
+// Columns is nil. Type is tree or list, empty when not given.
+type CreateTableStmt struct {
+	Pos     Pos
+	Name    Literal
+	Columns []ColumnDef
+	Type    Literal
+	Options []Option
+}
+
+type ColumnDef struct {
+	Pos     Pos
+	Name    Literal
+	Type    Literal
+	PrimKey bool
+}
+
+// CreateIndexStmt indexes Column of Table in the database in use
+type CreateIndexStmt struct {
+	Pos    Pos
+	Table  Literal
+	Column Literal
+}
+
+type DropStmt struct {
+	Pos  Pos
+	Name Literal
+}
+
+// SwitchStmt opens a database, Salvage opens a damaged one read only and reads pages
+// failing their checksum anyway
+type SwitchStmt struct {
+	Pos      Pos
+	Name     Literal
+	ReadOnly bool
+	Salvage  bool
+}
+
+type VacuumStmt struct {
+	Pos Pos
+}
+
+// UpgradeStmt migrates a database file of an older format version in place
+type UpgradeStmt struct {
+	Pos  Pos
+	Name Literal
+}
+
+// AlterStmt converts the table a database was created with to another type
+type AlterStmt struct {
+	Pos  Pos
+	Name Literal
+	Type Literal
+}
+
+// LoadStmt fills the empty table a database was created with from a csv file sorted
+// by key
+type LoadStmt struct {
+	Pos  Pos
+	Name Literal
+	File Literal
+}
+
+// Expr is a condition of a where clause
+type Expr interface {
+	Start() Pos
+}
+
+// LogicExpr joins two conditions, Op is and or or
+type LogicExpr struct {
+	Pos   Pos
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+type NotExpr struct {
+	Pos Pos
+	X   Expr
+}
+
+// CompareExpr compares a column to a value, Op is one of = <> != < <= > >=
+type CompareExpr struct {
+	Pos    Pos
+	Column Literal
+	Op     string
+	Value  Literal
+}
+
+// BetweenExpr is an inclusive range, Not inverts it as in not between
+type BetweenExpr struct {
+	Pos    Pos
+	Column Literal
+	Not    bool
+	Low    Literal
+	High   Literal
+}
+
+type InExpr struct {
+	Pos    Pos
+	Column Literal
+	Not    bool
+	Values []Literal
+}
+
+// LikeExpr matches a text column against Pattern, % stands for any run of characters
+// and _ for a single one
+type LikeExpr struct {
+	Pos     Pos
+	Column  Literal
+	Not     bool
+	Pattern Literal
+}
+
+func (s *BeginStmt) Start() Pos       { return s.Pos }
+func (s *CommitStmt) Start() Pos      { return s.Pos }
+func (s *RollbackStmt) Start() Pos    { return s.Pos }
+func (s *InsertStmt) Start() Pos      { return s.Pos }
+func (s *SelectStmt) Start() Pos      { return s.Pos }
+func (s *UpdateStmt) Start() Pos      { return s.Pos }
+func (s *DeleteStmt) Start() Pos      { return s.Pos }
+func (s *ScanStmt) Start() Pos        { return s.Pos }
+func (s *CreateStmt) Start() Pos      { return s.Pos }
+func (s *CreateTableStmt) Start() Pos { return s.Pos }
+func (s *CreateIndexStmt) Start() Pos { return s.Pos }
+func (s *DropStmt) Start() Pos        { return s.Pos }
+func (s *SwitchStmt) Start() Pos      { return s.Pos }
+func (s *VacuumStmt) Start() Pos      { return s.Pos }
+func (s *UpgradeStmt) Start() Pos     { return s.Pos }
+func (s *AlterStmt) Start() Pos       { return s.Pos }
+func (s *LoadStmt) Start() Pos        { return s.Pos }
+
+func (e *LogicExpr) Start() Pos   { return e.Pos }
+func (e *NotExpr) Start() Pos     { return e.Pos }
+func (e *CompareExpr) Start() Pos { return e.Pos }
+func (e *BetweenExpr) Start() Pos { return e.Pos }
+func (e *InExpr) Start() Pos      { return e.Pos }
+func (e *LikeExpr) Start() Pos    { return e.Pos }
@@ -0,0 +1,118 @@
+package parser
+
+import "strings"
+
+// condition reads a where clause, or binds looser than and which binds looser than not
+//
+//	condition = and-term {or and-term}
+//	and-term  = not-term {and not-term}
+//	not-term  = not not-term | '(' condition ')' | predicate
+//	predicate = column (op value | [not] between value and value
+//	            | [not] in '(' value, ... ')' | [not] like pattern)
+func (p *parser) condition() (Expr, error) {
+
+	left, err := p.andTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.andTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicExpr{Pos: left.Start(), Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) andTerm() (Expr, error) {
+
+	left, err := p.notTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.notTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicExpr{Pos: left.Start(), Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) notTerm() (Expr, error) {
+
+	tok := p.peek()
+	if p.keyword("not") {
+		x, err := p.notTerm()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Pos: tok.Pos, X: x}, nil
+	}
+	if tok.Kind == TK_LPAREN {
+		p.next()
+		x, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(TK_RPAREN); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return p.predicate()
+}
+
+func (p *parser) predicate() (Expr, error) {
+
+	tok := p.peek()
+	if tok.Kind != TK_WORD && tok.Kind != TK_STRING {
+		return nil, p.errorf(tok, "expected column name, found %s", tok)
+	}
+	p.next()
+	col := Literal{Pos: tok.Pos, Kind: tok.Kind, Text: tok.Text}
+
+	if op := p.peek(); op.Kind == TK_OP {
+		p.next()
+		val, err := p.literal("value")
+		if err != nil {
+			return nil, err
+		}
+		return &CompareExpr{Pos: col.Pos, Column: col, Op: op.Text, Value: val}, nil
+	}
+	not := p.keyword("not")
+	kw := p.peek()
+	switch {
+	case p.keyword("between"):
+		low, err := p.literal("value")
+		if err != nil {
+			return nil, err
+		}
+		if and := p.peek(); !p.keyword("and") {
+			return nil, p.errorf(and, "expected and after the low end of between, found %s", and)
+		}
+		high, err := p.literal("value")
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Pos: col.Pos, Column: col, Not: not, Low: low, High: high}, nil
+	case p.keyword("in"):
+		vals, err := p.values()
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{Pos: col.Pos, Column: col, Not: not, Values: vals}, nil
+	case p.keyword("like"):
+		pattern, err := p.literal("pattern")
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Pos: col.Pos, Column: col, Not: not, Pattern: pattern}, nil
+	}
+	if not {
+		return nil, p.errorf(kw, "expected between, in or like after not, found %s", kw)
+	}
+	return nil, p.errorf(kw, "expected a comparison, between, in or like after %s, found %s", strings.ToLower(col.Text), kw)
+}
@@ -0,0 +1,308 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenKind int
+
+const (
+	TK_EOF    TokenKind = iota
+	TK_WORD             // keywords and bare names, keywords are matched case insensitively
+	TK_NUMBER           // 12, -3, 1.5 and hex 0xff
+	TK_STRING           // 'quoted' or "quoted", Text holds the unescaped value
+	TK_SEMI
+	TK_COMMA
+	TK_LPAREN
+	TK_RPAREN
+	TK_STAR
+	TK_OP // = <> != < <= > >=
+)
+
+var punctuation = map[rune]TokenKind{';': TK_SEMI, ',': TK_COMMA, '(': TK_LPAREN, ')': TK_RPAREN, '*': TK_STAR}
+
+var tokenNames = []string{"end of input", "word", "number", "string", "';'", "','", "'('", "')'", "'*'", "operator"}
+
+func (k TokenKind) String() string {
+	if k < 0 || int(k) >= len(tokenNames) {
+		return fmt.Sprintf("token(%d)", int(k))
+	}
+	return tokenNames[k]
+}
+
+// Pos is where a token starts, lines and columns count from 1 and columns in runes
+type Pos struct {
+	Line int
+	Col  int
+}
+
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  Pos
+}
+
+func (t Token) String() string {
+	switch t.Kind {
+	case TK_EOF:
+		return t.Kind.String()
+	case TK_STRING:
+		return fmt.Sprintf("string %q", t.Text)
+	}
+	return fmt.Sprintf("%s %q", t.Kind, t.Text)
+}
+
+// SyntaxError points at the offending token. Incomplete is set when the input ended
+// inside a string or a comment, more input may still make it valid.
+type SyntaxError struct {
+	Pos        Pos
+	Msg        string
+	Incomplete bool
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+type lexer struct {
+	src  string
+	off  int // byte offset of the next rune
+	line int
+	col  int
+}
+
+// Tokenize splits src into tokens, comments and white space are dropped. The last
+// token is always TK_EOF.
+func Tokenize(src string) ([]Token, error) {
+
+	lx := &lexer{src: src, line: 1, col: 1}
+	var tokens []Token
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == TK_EOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (lx *lexer) peek(ahead int) rune {
+
+	off := lx.off
+	for ; ahead > 0 && off < len(lx.src); ahead-- {
+		_, size := utf8.DecodeRuneInString(lx.src[off:])
+		off += size
+	}
+	if off >= len(lx.src) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(lx.src[off:])
+	return r
+}
+
+func (lx *lexer) advance() rune {
+
+	r, size := utf8.DecodeRuneInString(lx.src[lx.off:])
+	lx.off += size
+	if r == '\n' {
+		lx.line++
+		lx.col = 1
+	} else {
+		lx.col++
+	}
+	return r
+}
+
+func (lx *lexer) pos() Pos {
+	return Pos{Line: lx.line, Col: lx.col}
+}
+
+// skip drops white space, -- line comments and /* block */ comments
+func (lx *lexer) skip() error {
+
+	for {
+		switch r := lx.peek(0); {
+		case r == -1:
+			return nil
+		case unicode.IsSpace(r):
+			lx.advance()
+		case r == '-' && lx.peek(1) == '-':
+			for lx.peek(0) != -1 && lx.peek(0) != '\n' {
+				lx.advance()
+			}
+		case r == '/' && lx.peek(1) == '*':
+			start := lx.pos()
+			lx.advance()
+			lx.advance()
+			for !(lx.peek(0) == '*' && lx.peek(1) == '/') {
+				if lx.peek(0) == -1 {
+					return &SyntaxError{Pos: start, Msg: "unterminated comment", Incomplete: true}
+				}
+				lx.advance()
+			}
+			lx.advance()
+			lx.advance()
+		default:
+			return nil
+		}
+	}
+}
+
+func (lx *lexer) next() (Token, error) {
+
+	if err := lx.skip(); err != nil {
+		return Token{}, err
+	}
+	start := lx.pos()
+	r := lx.peek(0)
+	switch {
+	case r == -1:
+		return Token{Kind: TK_EOF, Pos: start}, nil
+	case r == '\'' || r == '"':
+		return lx.str(start)
+	case isDigit(r) || r == '-' && isDigit(lx.peek(1)):
+		return lx.number(start)
+	case isWordStart(r):
+		// a dot between word characters keeps file names like data.csv in one word
+		from := lx.off
+		for isWordPart(lx.peek(0)) || lx.peek(0) == '.' && isWordPart(lx.peek(1)) {
+			lx.advance()
+		}
+		return Token{Kind: TK_WORD, Text: lx.src[from:lx.off], Pos: start}, nil
+	case punctuation[r] != TK_EOF:
+		lx.advance()
+		return Token{Kind: punctuation[r], Text: string(r), Pos: start}, nil
+	case strings.ContainsRune("=<>!", r):
+		lx.advance()
+		op := string(r)
+		if next := lx.peek(0); next == '=' && r != '=' || r == '<' && next == '>' {
+			op += string(lx.advance())
+		}
+		if op == "!" {
+			return Token{}, &SyntaxError{Pos: start, Msg: "unexpected '!', did you mean '!='"}
+		}
+		return Token{Kind: TK_OP, Text: op, Pos: start}, nil
+	}
+	return Token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+// number reads an integer, a decimal or a 0x prefixed hex number
+func (lx *lexer) number(start Pos) (Token, error) {
+
+	from := lx.off
+	if lx.peek(0) == '-' {
+		lx.advance()
+	}
+	if lx.peek(0) == '0' && (lx.peek(1) == 'x' || lx.peek(1) == 'X') {
+		lx.advance()
+		lx.advance()
+		if !isHexDigit(lx.peek(0)) {
+			return Token{}, &SyntaxError{Pos: start, Msg: "hex number needs at least one digit after 0x"}
+		}
+		for isHexDigit(lx.peek(0)) {
+			lx.advance()
+		}
+	} else {
+		for isDigit(lx.peek(0)) {
+			lx.advance()
+		}
+		if lx.peek(0) == '.' && isDigit(lx.peek(1)) {
+			lx.advance()
+			for isDigit(lx.peek(0)) {
+				lx.advance()
+			}
+		}
+	}
+	// 12abc is neither a number nor a word
+	if isWordPart(lx.peek(0)) {
+		for isWordPart(lx.peek(0)) {
+			lx.advance()
+		}
+		return Token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("invalid number %q, quote it to use it as text", lx.src[from:lx.off])}
+	}
+	return Token{Kind: TK_NUMBER, Text: lx.src[from:lx.off], Pos: start}, nil
+}
+
+// str reads a quoted string. The quote is escaped by doubling it or with a backslash,
+// which also gives \n, \t, \r, \0, \\ and \xHH.
+func (lx *lexer) str(start Pos) (Token, error) {
+
+	quote := lx.advance()
+	var buf strings.Builder
+	for {
+		escPos := lx.pos()
+		r := lx.peek(0)
+		switch {
+		case r == -1:
+			return Token{}, &SyntaxError{Pos: start, Msg: "unterminated string", Incomplete: true}
+		case r == quote && lx.peek(1) == quote:
+			lx.advance()
+			lx.advance()
+			buf.WriteRune(quote)
+		case r == quote:
+			lx.advance()
+			return Token{Kind: TK_STRING, Text: buf.String(), Pos: start}, nil
+		case r == '\\':
+			lx.advance()
+			esc := lx.peek(0)
+			if esc == -1 {
+				return Token{}, &SyntaxError{Pos: start, Msg: "unterminated string", Incomplete: true}
+			}
+			lx.advance()
+			switch esc {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case '0':
+				buf.WriteByte(0)
+			case '\\', '\'', '"':
+				buf.WriteRune(esc)
+			case 'x':
+				if !isHexDigit(lx.peek(0)) || !isHexDigit(lx.peek(1)) {
+					return Token{}, &SyntaxError{Pos: escPos, Msg: "\\x escape needs two hex digits"}
+				}
+				hi, lo := hexVal(lx.advance()), hexVal(lx.advance())
+				buf.WriteByte(hi<<4 | lo)
+			default:
+				return Token{}, &SyntaxError{Pos: escPos, Msg: fmt.Sprintf("unknown escape \\%c", esc)}
+			}
+		default:
+			buf.WriteRune(lx.advance())
+		}
+	}
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+func hexVal(r rune) byte {
+	switch {
+	case isDigit(r):
+		return byte(r - '0')
+	case r >= 'a' && r <= 'f':
+		return byte(r-'a') + 10
+	}
+	return byte(r-'A') + 10
+}
+
+func isWordStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isWordPart(r rune) bool {
+	return isWordStart(r) || isDigit(r)
+}
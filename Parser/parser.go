@@ -0,0 +1,589 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var usages = map[string]string{
+	"begin":    "begin",
+	"commit":   "commit",
+	"rollback": "rollback",
+	"insert":   "insert [into table] key value | insert [into table] (value, ...)",
+	"upsert":   "upsert [into table] key value | upsert [into table] (value, ...)",
+	"select":   "select key [from table] | select all|* [from table] [where condition]",
+	"update":   "update key value [in table] | update key set column = value, ... [in table]\n        update set column = value, ... [in table] where condition",
+	"delete":   "delete key [from table] | delete [from table] where condition",
+	"scan":     "scan from to [limit n] [desc] [from table]",
+	"create":   "create dbname tree|list [order n | pagesize n] [key int32|int64|string|bytes]\n        create table name (column integer|text|real|blob|boolean [primary key], ...) [tree|list] [order n | pagesize n]\n        create table name tree|list [key int32|int64|string|bytes]\n        create index on table(column)",
+	"dropdb":   "dropdb dbname",
+	"switch":   "switch dbname [readonly | salvage]",
+	"use":      "use dbname [readonly | salvage]",
+	"vacuum":   "vacuum",
+	"upgrade":  "upgrade dbname",
+	"alter":    "alter dbname set type tree|list",
+	"load":     "load dbname from file.csv\n        a crash during the load leaves the rows written so far in the file, unreachable until a vacuum",
+}
+
+type parser struct {
+	toks  []Token
+	at    int
+	usage string // of the statement being parsed, added to its errors
+}
+
+// Parse reads every statement of src. Statements are separated by semicolons, the
+// last one may leave its semicolon out.
+func Parse(src string) ([]Stmt, error) {
+
+	toks, err := Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	var stmts []Stmt
+	for {
+		for p.peek().Kind == TK_SEMI {
+			p.next()
+		}
+		if p.peek().Kind == TK_EOF {
+			return stmts, nil
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+		if tok := p.peek(); tok.Kind != TK_SEMI && tok.Kind != TK_EOF {
+			return nil, p.errorf(tok, "unexpected %s after the end of the statement", tok)
+		}
+	}
+}
+
+func (p *parser) peek() Token {
+	return p.toks[p.at]
+}
+
+// next consumes a token, TK_EOF is never consumed
+func (p *parser) next() Token {
+
+	tok := p.toks[p.at]
+	if tok.Kind != TK_EOF {
+		p.at++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok Token, format string, args ...any) error {
+
+	msg := fmt.Sprintf(format, args...)
+	if p.usage != "" {
+		msg += "\n usage: " + p.usage
+	}
+	return &SyntaxError{Pos: tok.Pos, Msg: msg}
+}
+
+// keyword consumes the next token when it is the word kw
+func (p *parser) keyword(kw string) bool {
+
+	if tok := p.peek(); tok.Kind == TK_WORD && strings.EqualFold(tok.Text, kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// literal reads a word, a number or a string, what names it in the error
+func (p *parser) literal(what string) (Literal, error) {
+
+	tok := p.peek()
+	switch tok.Kind {
+	case TK_WORD, TK_NUMBER, TK_STRING:
+		p.next()
+		return Literal{Pos: tok.Pos, Kind: tok.Kind, Text: tok.Text}, nil
+	}
+	return Literal{}, p.errorf(tok, "expected %s, found %s", what, tok)
+}
+
+// name reads a database name, a word or a string
+func (p *parser) name() (Literal, error) {
+
+	tok := p.peek()
+	if tok.Kind != TK_WORD && tok.Kind != TK_STRING {
+		return Literal{}, p.errorf(tok, "expected database name, found %s", tok)
+	}
+	p.next()
+	return Literal{Pos: tok.Pos, Kind: tok.Kind, Text: tok.Text}, nil
+}
+
+// table reads the table name following the word kw, when the statement names one
+func (p *parser) table(kw string) (Literal, error) {
+
+	if !p.keyword(kw) {
+		return Literal{}, nil
+	}
+	return p.tableName()
+}
+
+func (p *parser) tableName() (Literal, error) {
+
+	tok := p.peek()
+	if tok.Kind != TK_WORD && tok.Kind != TK_STRING {
+		return Literal{}, p.errorf(tok, "expected table name, found %s", tok)
+	}
+	p.next()
+	return Literal{Pos: tok.Pos, Kind: tok.Kind, Text: tok.Text}, nil
+}
+
+// integer reads a non negative whole number
+func (p *parser) integer(what string) (Literal, error) {
+
+	tok := p.peek()
+	if tok.Kind != TK_NUMBER {
+		return Literal{}, p.errorf(tok, "expected %s, found %s", what, tok)
+	}
+	if n, err := strconv.Atoi(tok.Text); err != nil || n < 0 {
+		return Literal{}, p.errorf(tok, "%s must be a whole number of at least 0, found %s", what, tok.Text)
+	}
+	p.next()
+	return Literal{Pos: tok.Pos, Kind: tok.Kind, Text: tok.Text}, nil
+}
+
+func (p *parser) statement() (Stmt, error) {
+
+	tok := p.next()
+	if tok.Kind != TK_WORD {
+		return nil, p.errorf(tok, "expected a statement, found %s", tok)
+	}
+	cmd := strings.ToLower(tok.Text)
+	usage, ok := usages[cmd]
+	if !ok {
+		return nil, p.errorf(tok, "unknown statement %q", tok.Text)
+	}
+	p.usage = usage
+	defer func() { p.usage = "" }()
+
+	switch cmd {
+	case "begin":
+		return &BeginStmt{Pos: tok.Pos}, nil
+	case "commit":
+		return &CommitStmt{Pos: tok.Pos}, nil
+	case "rollback":
+		return &RollbackStmt{Pos: tok.Pos}, nil
+	case "vacuum":
+		return &VacuumStmt{Pos: tok.Pos}, nil
+	case "insert", "upsert":
+		stmt := &InsertStmt{Pos: tok.Pos, Upsert: cmd == "upsert"}
+		var err error
+		// a key spelled into has to be quoted
+		if stmt.Table, err = p.table("into"); err != nil {
+			return nil, err
+		}
+		if p.peek().Kind == TK_LPAREN {
+			stmt.Values, err = p.values()
+		} else {
+			stmt.Key, stmt.Value, err = p.keyValue()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	case "update":
+		return p.update(tok)
+	case "select":
+		// a key spelled all has to be quoted
+		stmt := &SelectStmt{Pos: tok.Pos, All: p.keyword("all")}
+		if !stmt.All && p.peek().Kind == TK_STAR {
+			p.next()
+			stmt.All = true
+		}
+		var err error
+		if !stmt.All {
+			if stmt.Key, err = p.literal("key"); err != nil {
+				return nil, err
+			}
+		}
+		if stmt.Table, err = p.table("from"); err != nil {
+			return nil, err
+		}
+		if stmt.All && p.keyword("where") {
+			if stmt.Where, err = p.condition(); err != nil {
+				return nil, err
+			}
+		}
+		return stmt, nil
+	case "delete":
+		return p.delete(tok)
+	case "scan":
+		return p.scan(tok)
+	case "create":
+		return p.create(tok)
+	case "dropdb":
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &DropStmt{Pos: tok.Pos, Name: name}, nil
+	case "upgrade":
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &UpgradeStmt{Pos: tok.Pos, Name: name}, nil
+	case "alter":
+		return p.alter(tok)
+	case "load":
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if kw := p.peek(); !p.keyword("from") {
+			return nil, p.errorf(kw, "expected from after the database name, found %s", kw)
+		}
+		file, err := p.literal("file name")
+		if err != nil {
+			return nil, err
+		}
+		return &LoadStmt{Pos: tok.Pos, Name: name, File: file}, nil
+	case "switch", "use":
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		stmt := &SwitchStmt{Pos: tok.Pos, Name: name, ReadOnly: p.keyword("readonly")}
+		if !stmt.ReadOnly && p.keyword("salvage") {
+			stmt.ReadOnly, stmt.Salvage = true, true
+		}
+		return stmt, nil
+	}
+	return nil, p.errorf(tok, "unknown statement %q", tok.Text)
+}
+
+func (p *parser) keyValue() (Literal, Literal, error) {
+
+	key, err := p.literal("key")
+	if err != nil {
+		return Literal{}, Literal{}, err
+	}
+	val, err := p.literal("value")
+	if err != nil {
+		return Literal{}, Literal{}, err
+	}
+	return key, val, nil
+}
+
+func (p *parser) scan(tok Token) (Stmt, error) {
+
+	stmt := &ScanStmt{Pos: tok.Pos}
+	var err error
+	if stmt.From, err = p.literal("from key"); err != nil {
+		return nil, err
+	}
+	if stmt.To, err = p.literal("to key"); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.keyword("desc"):
+			stmt.Desc = true
+		case p.keyword("limit"):
+			limit, err := p.integer("limit")
+			if err != nil {
+				return nil, err
+			}
+			stmt.Limit, _ = strconv.Atoi(limit.Text)
+		case p.keyword("from"):
+			if stmt.Table, err = p.tableName(); err != nil {
+				return nil, err
+			}
+		default:
+			return stmt, nil
+		}
+	}
+}
+
+func (p *parser) create(tok Token) (Stmt, error) {
+
+	// a database called table or index has to be quoted
+	if p.keyword("table") {
+		return p.createTable(tok)
+	}
+	if p.keyword("index") {
+		return p.createIndex(tok)
+	}
+	stmt := &CreateStmt{Pos: tok.Pos}
+	var err error
+	if stmt.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	typ := p.peek()
+	if !p.keyword("tree") && !p.keyword("list") {
+		return nil, p.errorf(typ, "expected table type tree or list, found %s", typ)
+	}
+	stmt.Type = Literal{Pos: typ.Pos, Kind: typ.Kind, Text: strings.ToLower(typ.Text)}
+	stmt.Options, err = p.options()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) createTable(tok Token) (Stmt, error) {
+
+	stmt := &CreateTableStmt{Pos: tok.Pos}
+	var err error
+	if stmt.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	// a key value table gives its type in place of the columns
+	if p.peek().Kind != TK_LPAREN {
+		typ := p.peek()
+		if !p.keyword("tree") && !p.keyword("list") {
+			return nil, p.errorf(typ, "expected '(' or table type tree or list, found %s", typ)
+		}
+		stmt.Type = Literal{Pos: typ.Pos, Kind: typ.Kind, Text: strings.ToLower(typ.Text)}
+		if stmt.Options, err = p.options(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	if err := p.expect(TK_LPAREN); err != nil {
+		return nil, err
+	}
+	for {
+		col := ColumnDef{Pos: p.peek().Pos}
+		if col.Name, err = p.literal("column name"); err != nil {
+			return nil, err
+		}
+		typ := p.peek()
+		if typ.Kind != TK_WORD {
+			return nil, p.errorf(typ, "expected column type, found %s", typ)
+		}
+		p.next()
+		col.Type = Literal{Pos: typ.Pos, Kind: typ.Kind, Text: strings.ToLower(typ.Text)}
+		if p.keyword("primary") {
+			if kw := p.peek(); !p.keyword("key") {
+				return nil, p.errorf(kw, "expected key after primary, found %s", kw)
+			}
+			col.PrimKey = true
+		}
+		stmt.Columns = append(stmt.Columns, col)
+		if p.peek().Kind != TK_COMMA {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(TK_RPAREN); err != nil {
+		return nil, err
+	}
+	if typ := p.peek(); p.keyword("tree") || p.keyword("list") {
+		stmt.Type = Literal{Pos: typ.Pos, Kind: typ.Kind, Text: strings.ToLower(typ.Text)}
+	}
+	stmt.Options, err = p.options()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) createIndex(tok Token) (Stmt, error) {
+
+	stmt := &CreateIndexStmt{Pos: tok.Pos}
+	var err error
+	if kw := p.peek(); !p.keyword("on") {
+		return nil, p.errorf(kw, "expected on after index, found %s", kw)
+	}
+	if stmt.Table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(TK_LPAREN); err != nil {
+		return nil, err
+	}
+	if stmt.Column, err = p.literal("column name"); err != nil {
+		return nil, err
+	}
+	if err := p.expect(TK_RPAREN); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) alter(tok Token) (Stmt, error) {
+
+	stmt := &AlterStmt{Pos: tok.Pos}
+	var err error
+	if stmt.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if kw := p.peek(); !p.keyword("set") {
+		return nil, p.errorf(kw, "expected set after the database name, found %s", kw)
+	}
+	if kw := p.peek(); !p.keyword("type") {
+		return nil, p.errorf(kw, "expected type after set, found %s", kw)
+	}
+	typ := p.peek()
+	if !p.keyword("tree") && !p.keyword("list") {
+		return nil, p.errorf(typ, "expected table type tree or list, found %s", typ)
+	}
+	stmt.Type = Literal{Pos: typ.Pos, Kind: typ.Kind, Text: strings.ToLower(typ.Text)}
+	return stmt, nil
+}
+
+// options reads the order, pagesize and key options trailing create
+func (p *parser) options() ([]Option, error) {
+
+	var opts []Option
+	for {
+		opt := p.peek()
+		var val Literal
+		var err error
+		switch {
+		case p.keyword("order"), p.keyword("pagesize"):
+			val, err = p.integer(strings.ToLower(opt.Text))
+		case p.keyword("key"):
+			val, err = p.literal("key type")
+		default:
+			return opts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, Option{Pos: opt.Pos, Name: strings.ToLower(opt.Text), Value: val})
+	}
+}
+
+// values reads a parenthesised list of literals
+func (p *parser) values() ([]Literal, error) {
+
+	if err := p.expect(TK_LPAREN); err != nil {
+		return nil, err
+	}
+	var vals []Literal
+	for {
+		val, err := p.literal("value")
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+		if p.peek().Kind != TK_COMMA {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(TK_RPAREN); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+func (p *parser) delete(tok Token) (Stmt, error) {
+
+	stmt := &DeleteStmt{Pos: tok.Pos}
+	var err error
+	// a key spelled from or where has to be quoted
+	if stmt.Table, err = p.table("from"); err != nil {
+		return nil, err
+	}
+	if stmt.Table.Text == "" && !p.isKeyword("where") {
+		if stmt.Key, err = p.literal("key"); err != nil {
+			return nil, err
+		}
+		if stmt.Table, err = p.table("from"); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	if stmt.Where, err = p.where(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// where reads the where clause a statement cannot do without
+func (p *parser) where() (Expr, error) {
+
+	if tok := p.peek(); !p.keyword("where") {
+		return nil, p.errorf(tok, "expected where, found %s", tok)
+	}
+	return p.condition()
+}
+
+// isKeyword tells whether the next token is the word kw, without consuming it
+func (p *parser) isKeyword(kw string) bool {
+	tok := p.peek()
+	return tok.Kind == TK_WORD && strings.EqualFold(tok.Text, kw)
+}
+
+func (p *parser) update(tok Token) (Stmt, error) {
+
+	stmt := &UpdateStmt{Pos: tok.Pos}
+	var err error
+	// a key spelled set has to be quoted
+	if p.keyword("set") {
+		if stmt.Set, err = p.assignments(); err != nil {
+			return nil, err
+		}
+		if stmt.Table, err = p.table("in"); err != nil {
+			return nil, err
+		}
+		if stmt.Where, err = p.where(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	if stmt.Key, err = p.literal("key"); err != nil {
+		return nil, err
+	}
+	// a value spelled set has to be quoted
+	if !p.keyword("set") {
+		if stmt.Value, err = p.literal("value"); err != nil {
+			return nil, err
+		}
+		if stmt.Table, err = p.table("in"); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	if stmt.Set, err = p.assignments(); err != nil {
+		return nil, err
+	}
+	if stmt.Table, err = p.table("in"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// assignments reads the column = value list of update set
+func (p *parser) assignments() ([]Assignment, error) {
+
+	var sets []Assignment
+	for {
+		set := Assignment{Pos: p.peek().Pos}
+		var err error
+		if set.Column, err = p.literal("column name"); err != nil {
+			return nil, err
+		}
+		if op := p.peek(); op.Kind != TK_OP || op.Text != "=" {
+			return nil, p.errorf(op, "expected '=', found %s", op)
+		}
+		p.next()
+		if set.Value, err = p.literal("value"); err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+		if p.peek().Kind != TK_COMMA {
+			return sets, nil
+		}
+		p.next()
+	}
+}
+
+// expect consumes the next token, which has to be of the given kind
+func (p *parser) expect(kind TokenKind) error {
+
+	if tok := p.peek(); tok.Kind != kind {
+		return p.errorf(tok, "expected %s, found %s", kind, tok)
+	}
+	p.next()
+	return nil
+}
@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lit(line, col int, kind TokenKind, text string) Literal {
+	return Literal{Pos: Pos{Line: line, Col: col}, Kind: kind, Text: text}
+}
+
+func TestParse(t *testing.T) {
+
+	cases := []struct {
+		src  string
+		want []Stmt
+	}{
+		{"", nil},
+		{" ;; -- nothing but a comment", nil},
+		{"BEGIN; commit ;rollback", []Stmt{
+			&BeginStmt{Pos: Pos{1, 1}},
+			&CommitStmt{Pos: Pos{1, 8}},
+			&RollbackStmt{Pos: Pos{1, 16}},
+		}},
+		{"insert  1   'hello world'", []Stmt{
+			&InsertStmt{Pos: Pos{1, 1}, Key: lit(1, 9, TK_NUMBER, "1"), Value: lit(1, 13, TK_STRING, "hello world")},
+		}},
+		{`upsert "a b" 'it''s \x41\n\\'`, []Stmt{
+			&InsertStmt{Pos: Pos{1, 1}, Upsert: true, Key: lit(1, 8, TK_STRING, "a b"), Value: lit(1, 14, TK_STRING, "it's A\n\\")},
+		}},
+		{"select all; select 'all'; select -7", []Stmt{
+			&SelectStmt{Pos: Pos{1, 1}, All: true},
+			&SelectStmt{Pos: Pos{1, 13}, Key: lit(1, 20, TK_STRING, "all")},
+			&SelectStmt{Pos: Pos{1, 27}, Key: lit(1, 34, TK_NUMBER, "-7")},
+		}},
+		{"update k /* inline */ v\n;delete 0xff", []Stmt{
+			&UpdateStmt{Pos: Pos{1, 1}, Key: lit(1, 8, TK_WORD, "k"), Value: lit(1, 23, TK_WORD, "v")},
+			&DeleteStmt{Pos: Pos{2, 2}, Key: lit(2, 9, TK_NUMBER, "0xff")},
+		}},
+		{"scan a z desc limit 3", []Stmt{
+			&ScanStmt{Pos: Pos{1, 1}, From: lit(1, 6, TK_WORD, "a"), To: lit(1, 8, TK_WORD, "z"), Limit: 3, Desc: true},
+		}},
+		{"create users LIST pagesize 4096 key string", []Stmt{
+			&CreateStmt{Pos: Pos{1, 1}, Name: lit(1, 8, TK_WORD, "users"), Type: lit(1, 14, TK_WORD, "list"), Options: []Option{
+				{Pos: Pos{1, 19}, Name: "pagesize", Value: lit(1, 28, TK_NUMBER, "4096")},
+				{Pos: Pos{1, 33}, Name: "key", Value: lit(1, 37, TK_WORD, "string")},
+			}},
+		}},
+		{"create table 'table' (id INTEGER primary key, name text) order 4", []Stmt{
+			&CreateTableStmt{Pos: Pos{1, 1}, Name: lit(1, 14, TK_STRING, "table"), Columns: []ColumnDef{
+				{Pos: Pos{1, 23}, Name: lit(1, 23, TK_WORD, "id"), Type: lit(1, 26, TK_WORD, "integer"), PrimKey: true},
+				{Pos: Pos{1, 47}, Name: lit(1, 47, TK_WORD, "name"), Type: lit(1, 52, TK_WORD, "text")},
+			}, Options: []Option{
+				{Pos: Pos{1, 58}, Name: "order", Value: lit(1, 64, TK_NUMBER, "4")},
+			}},
+		}},
+		{"insert (1, 'bob', null); update 1 set name = 'al', age=3", []Stmt{
+			&InsertStmt{Pos: Pos{1, 1}, Values: []Literal{lit(1, 9, TK_NUMBER, "1"), lit(1, 12, TK_STRING, "bob"), lit(1, 19, TK_WORD, "null")}},
+			&UpdateStmt{Pos: Pos{1, 26}, Key: lit(1, 33, TK_NUMBER, "1"), Set: []Assignment{
+				{Pos: Pos{1, 39}, Column: lit(1, 39, TK_WORD, "name"), Value: lit(1, 46, TK_STRING, "al")},
+				{Pos: Pos{1, 52}, Column: lit(1, 52, TK_WORD, "age"), Value: lit(1, 56, TK_NUMBER, "3")},
+			}},
+		}},
+		{"use app; insert into users (1, 'bob'); upsert INTO kv k v; select all from kv", []Stmt{
+			&SwitchStmt{Pos: Pos{1, 1}, Name: lit(1, 5, TK_WORD, "app")},
+			&InsertStmt{Pos: Pos{1, 10}, Table: lit(1, 22, TK_WORD, "users"), Values: []Literal{lit(1, 29, TK_NUMBER, "1"), lit(1, 32, TK_STRING, "bob")}},
+			&InsertStmt{Pos: Pos{1, 40}, Upsert: true, Table: lit(1, 52, TK_WORD, "kv"), Key: lit(1, 55, TK_WORD, "k"), Value: lit(1, 57, TK_WORD, "v")},
+			&SelectStmt{Pos: Pos{1, 60}, All: true, Table: lit(1, 76, TK_WORD, "kv")},
+		}},
+		{"scan 1 9 from t limit 2; delete 3 from t; update 3 x in t", []Stmt{
+			&ScanStmt{Pos: Pos{1, 1}, From: lit(1, 6, TK_NUMBER, "1"), To: lit(1, 8, TK_NUMBER, "9"), Limit: 2, Table: lit(1, 15, TK_WORD, "t")},
+			&DeleteStmt{Pos: Pos{1, 26}, Key: lit(1, 33, TK_NUMBER, "3"), Table: lit(1, 40, TK_WORD, "t")},
+			&UpdateStmt{Pos: Pos{1, 43}, Key: lit(1, 50, TK_NUMBER, "3"), Value: lit(1, 52, TK_WORD, "x"), Table: lit(1, 57, TK_WORD, "t")},
+		}},
+		{"create table kv list key string; create table t (id integer primary key) tree", []Stmt{
+			&CreateTableStmt{Pos: Pos{1, 1}, Name: lit(1, 14, TK_WORD, "kv"), Type: lit(1, 17, TK_WORD, "list"), Options: []Option{
+				{Pos: Pos{1, 22}, Name: "key", Value: lit(1, 26, TK_WORD, "string")},
+			}},
+			&CreateTableStmt{Pos: Pos{1, 34}, Name: lit(1, 47, TK_WORD, "t"), Columns: []ColumnDef{
+				{Pos: Pos{1, 50}, Name: lit(1, 50, TK_WORD, "id"), Type: lit(1, 53, TK_WORD, "integer"), PrimKey: true},
+			}, Type: lit(1, 74, TK_WORD, "tree")},
+		}},
+		{"create index on db(value); create 'index' tree", []Stmt{
+			&CreateIndexStmt{Pos: Pos{1, 1}, Table: lit(1, 17, TK_WORD, "db"), Column: lit(1, 20, TK_WORD, "value")},
+			&CreateStmt{Pos: Pos{1, 28}, Name: lit(1, 35, TK_STRING, "index"), Type: lit(1, 43, TK_WORD, "tree")},
+		}},
+		{"select * from t where a >= 1 and not b like 'x%' or (c in (1, 2) and d not between 3 and 4)", []Stmt{
+			&SelectStmt{Pos: Pos{1, 1}, All: true, Table: lit(1, 15, TK_WORD, "t"), Where: &LogicExpr{Pos: Pos{1, 23}, Op: "or",
+				Left: &LogicExpr{Pos: Pos{1, 23}, Op: "and",
+					Left:  &CompareExpr{Pos: Pos{1, 23}, Column: lit(1, 23, TK_WORD, "a"), Op: ">=", Value: lit(1, 28, TK_NUMBER, "1")},
+					Right: &NotExpr{Pos: Pos{1, 34}, X: &LikeExpr{Pos: Pos{1, 38}, Column: lit(1, 38, TK_WORD, "b"), Pattern: lit(1, 45, TK_STRING, "x%")}},
+				},
+				Right: &LogicExpr{Pos: Pos{1, 54}, Op: "and",
+					Left:  &InExpr{Pos: Pos{1, 54}, Column: lit(1, 54, TK_WORD, "c"), Values: []Literal{lit(1, 60, TK_NUMBER, "1"), lit(1, 63, TK_NUMBER, "2")}},
+					Right: &BetweenExpr{Pos: Pos{1, 70}, Column: lit(1, 70, TK_WORD, "d"), Not: true, Low: lit(1, 84, TK_NUMBER, "3"), High: lit(1, 90, TK_NUMBER, "4")},
+				},
+			}},
+		}},
+		{"delete where key <> 1; update set value = 'v' in kv where key != 2", []Stmt{
+			&DeleteStmt{Pos: Pos{1, 1}, Where: &CompareExpr{Pos: Pos{1, 14}, Column: lit(1, 14, TK_WORD, "key"), Op: "<>", Value: lit(1, 21, TK_NUMBER, "1")}},
+			&UpdateStmt{Pos: Pos{1, 24}, Set: []Assignment{
+				{Pos: Pos{1, 35}, Column: lit(1, 35, TK_WORD, "value"), Value: lit(1, 43, TK_STRING, "v")},
+			}, Table: lit(1, 50, TK_WORD, "kv"), Where: &CompareExpr{Pos: Pos{1, 59}, Column: lit(1, 59, TK_WORD, "key"), Op: "!=", Value: lit(1, 66, TK_NUMBER, "2")}},
+		}},
+		{"switch users readonly; dropdb 'old'; vacuum; use x salvage", []Stmt{
+			&SwitchStmt{Pos: Pos{1, 1}, Name: lit(1, 8, TK_WORD, "users"), ReadOnly: true},
+			&DropStmt{Pos: Pos{1, 24}, Name: lit(1, 31, TK_STRING, "old")},
+			&VacuumStmt{Pos: Pos{1, 38}},
+			&SwitchStmt{Pos: Pos{1, 46}, Name: lit(1, 50, TK_WORD, "x"), ReadOnly: true, Salvage: true},
+		}},
+		{"upgrade 'old'", []Stmt{&UpgradeStmt{Pos: Pos{1, 1}, Name: lit(1, 9, TK_STRING, "old")}}},
+		{"load db from data.csv; load db from '/tmp/rows.csv'", []Stmt{
+			&LoadStmt{Pos: Pos{1, 1}, Name: lit(1, 6, TK_WORD, "db"), File: lit(1, 14, TK_WORD, "data.csv")},
+			&LoadStmt{Pos: Pos{1, 24}, Name: lit(1, 29, TK_WORD, "db"), File: lit(1, 37, TK_STRING, "/tmp/rows.csv")},
+		}},
+		{"alter db set type LIST", []Stmt{&AlterStmt{Pos: Pos{1, 1}, Name: lit(1, 7, TK_WORD, "db"), Type: lit(1, 19, TK_WORD, "list")}}},
+	}
+	for _, c := range cases {
+		got, err := Parse(c.src)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Parse(%q):\n got  %#v\n want %#v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	cases := []struct {
+		src        string
+		pos        Pos
+		msg        string
+		incomplete bool
+	}{
+		{"insertXYZ 1 2", Pos{1, 1}, `unknown statement "insertXYZ"`, false},
+		{"insert 1", Pos{1, 9}, "expected value, found end of input", false},
+		{"insert 1 2 3", Pos{1, 12}, `unexpected number "3"`, false},
+		{"select\n  ;", Pos{2, 3}, "expected key, found ';'", false},
+		{"scan a z limit x", Pos{1, 16}, `expected limit, found word "x"`, false},
+		{"create t graph", Pos{1, 10}, "expected table type tree or list", false},
+		{"create table t (id integer primary)", Pos{1, 35}, "expected key after primary, found ')'", false},
+		{"create table t (id integer", Pos{1, 27}, "expected ')', found end of input", false},
+		{"create table t key string", Pos{1, 16}, "expected '(' or table type tree or list", false},
+		{"create index db(value)", Pos{1, 14}, `expected on after index, found word "db"`, false},
+		{"create index on db value", Pos{1, 20}, `expected '(', found word "value"`, false},
+		{"load db data.csv", Pos{1, 9}, `expected from after the database name, found word "data.csv"`, false},
+		{"alter db type tree", Pos{1, 10}, `expected set after the database name, found word "type"`, false},
+		{"alter db set type graph", Pos{1, 19}, "expected table type tree or list", false},
+		{"insert into 1 2", Pos{1, 13}, `expected table name, found number "1"`, false},
+		{"delete from t", Pos{1, 14}, "expected where, found end of input", false},
+		{"update set a = 1", Pos{1, 17}, "expected where, found end of input", false},
+		{"select * where a not = 1", Pos{1, 22}, "expected between, in or like after not", false},
+		{"select * where a between 1 or 2", Pos{1, 28}, "expected and after the low end of between", false},
+		{"select * where (a = 1", Pos{1, 22}, "expected ')', found end of input", false},
+		{"insert (1, 2", Pos{1, 13}, "expected ')', found end of input", false},
+		{"update 1 set a 2", Pos{1, 16}, `expected '=', found number "2"`, false},
+		{"insert 12ab v", Pos{1, 8}, `invalid number "12ab"`, false},
+		{"insert 1 'a\\q'", Pos{1, 12}, `unknown escape \q`, false},
+		{"delete 1 # 2", Pos{1, 10}, "unexpected character '#'", false},
+		{"insert 1 'open\nstill open", Pos{1, 10}, "unterminated string", true},
+		{"select 1 /* open", Pos{1, 10}, "unterminated comment", true},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.src)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q): expected a syntax error, got %v", c.src, err)
+			continue
+		}
+		if syntaxErr.Pos != c.pos || !strings.Contains(syntaxErr.Msg, c.msg) || syntaxErr.Incomplete != c.incomplete {
+			t.Errorf("Parse(%q): got %v (incomplete %t), want %q at %v (incomplete %t)",
+				c.src, err, syntaxErr.Incomplete, c.msg, c.pos, c.incomplete)
+		}
+	}
+}
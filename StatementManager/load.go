@@ -0,0 +1,114 @@
+package statement
+
+import (
+	diskmanager "db/DiskManager"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// csvRows reads the rows of a csv file for a bulk load. A key value table takes a key
+// and a value per line, a table with columns a value for every column where an empty
+// field is NULL. A first line naming the columns is skipped.
+type csvRows struct {
+	info *diskmanager.TblInfo
+	read *csv.Reader
+	line int
+	key  diskmanager.Key
+	val  string
+	err  error
+}
+
+func (r *csvRows) Next() bool {
+
+	if r.err != nil {
+		return false
+	}
+	for {
+		rec, err := r.read.Read()
+		if errors.Is(err, io.EOF) {
+			return false
+		}
+		r.line++
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if r.line == 1 && r.header(rec) {
+			continue
+		}
+		r.key, r.val, r.err = r.parse(rec)
+		if r.err != nil {
+			r.err = fmt.Errorf("line %d: %w", r.line, r.err)
+			return false
+		}
+		return true
+	}
+}
+
+func (r *csvRows) Key() diskmanager.Key { return r.key }
+func (r *csvRows) Value() string        { return r.val }
+func (r *csvRows) Err() error           { return r.err }
+
+// header tells whether rec names the columns of the table
+func (r *csvRows) header(rec []string) bool {
+
+	columns := r.info.Columns()
+	if len(rec) != len(columns) {
+		return false
+	}
+	for i := range rec {
+		if !strings.EqualFold(strings.TrimSpace(rec[i]), columns[i].Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *csvRows) parse(rec []string) (diskmanager.Key, string, error) {
+
+	info := r.info
+	if info.TblSch == nil {
+		if len(rec) != 2 {
+			return nil, "", fmt.Errorf("expected a key and a value, got %d fields", len(rec))
+		}
+		key, err := info.ParseKey(rec[0])
+		return key, rec[1], err
+	}
+	columns := info.TblSch.Columns
+	if len(rec) != len(columns) {
+		return nil, "", fmt.Errorf("table %s has %d columns, got %d fields", info.TblNam, len(columns), len(rec))
+	}
+	row := make([]any, len(rec))
+	for i, text := range rec {
+		if text == "" {
+			continue
+		}
+		val, err := diskmanager.ParseValue(columns[i].Type, text)
+		if err != nil {
+			return nil, "", fmt.Errorf("column %s: %w", columns[i].Name, err)
+		}
+		row[i] = val
+	}
+	return info.EncodeRow(row)
+}
+
+// loadCSV bulk loads the csv file at path into the table the database of d was
+// created with
+func loadCSV(d *diskmanager.DiskManager, path string) (int, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info := d.Tables()[0]
+	read := csv.NewReader(file)
+	read.ReuseRecord = true
+	read.FieldsPerRecord = -1 // counted by parse, with a message naming the table
+	src := &csvRows{info: info, read: read}
+	return d.BulkLoad(info.TblNam, src)
+}
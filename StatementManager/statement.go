@@ -2,10 +2,13 @@ package statement
 
 import (
 	diskmanager "db/DiskManager"
+	parser "db/Parser"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -16,19 +19,70 @@ const (
 	STATEMENT_DB_CREATE
 	STATEMENT_DB_DROPDB
 	STATEMENT_DB_SWITCH
+	STATEMENT_DB_UPSERT
+	STATEMENT_DB_VACUUM
+	STATEMENT_DB_BEGIN
+	STATEMENT_DB_COMMIT
+	STATEMENT_DB_ROLLBACK
+	STATEMENT_DB_SCAN
+	STATEMENT_DB_CREATE_TABLE
+	STATEMENT_DB_CREATE_INDEX
+	STATEMENT_DB_UPGRADE
+	STATEMENT_DB_ALTER
+	STATEMENT_DB_LOAD
 )
 
 type StatementType int
 type Table diskmanager.Table
 
+// Key is kept as typed, it is parsed once the key type of the table is known. Row
+// holds the values of a table made by create table instead of Val. Table is empty
+// unless the statement names one, the table the database was created with is used then.
 type KV struct {
-	Key int32
-	Val string
+	Key   string
+	Val   string
+	Row   []Field
+	All   bool // select all
+	Table string
+	Where parser.Expr // of select all, update set and delete, in place of Key
+}
+
+// Field is a column value as typed, Column is only named by update set
+type Field struct {
+	Column string
+	Text   string
+	Null   bool // an unquoted null
 }
 
 type DBInfo struct {
+	Name     string
+	Type     string
+	Order    int
+	KeyType  int8
+	ReadOnly bool                 // switch under a lock shared with other readers
+	Salvage  bool                 // switch to a damaged database to read what is left
+	Columns  []diskmanager.Column // set by create table, nil for a key value table
+}
+
+// IndexInfo names the column of a table to index
+type IndexInfo struct {
+	Table  string
+	Column string
+}
+
+// LoadInfo names the database to bulk load and the csv file holding its rows
+type LoadInfo struct {
 	Name string
-	Type string
+	File string
+}
+
+// ScanInfo is an inclusive key range, Limit 0 returns every row in it
+type ScanInfo struct {
+	From  string
+	To    string
+	Limit int
+	Desc  bool
+	Table string
 }
 
 type Statement struct {
@@ -39,224 +93,925 @@ type Statement struct {
 type ExecutionInfo struct {
 	StatementDetails Statement
 	TableDetails     diskmanager.Table
+	DiskDetails      *diskmanager.DiskManager
 }
 
-func DoMetaCommand(cmd string) error {
-	if cmd == ".exit" {
+func (e *ExecutionInfo) DoMetaCommand(cmd string) error {
+	args := strings.Fields(cmd)
+	switch args[0] {
+	case ".exit":
+		if err := e.closeDatabase(); err != nil {
+			fmt.Println(err.Error())
+		}
 		os.Exit(0)
+	case ".freespace":
+		if e.DiskDetails == nil {
+			return fmt.Errorf("meta command error: nil table, select table")
+		}
+		count, size, err := e.DiskDetails.FreeSpace()
+		if err != nil {
+			return fmt.Errorf("meta command error: %w", err)
+		}
+		fmt.Printf("free pages: %d, free bytes: %d\n", count, size)
+		return nil
+	case ".stats":
+		if e.DiskDetails == nil {
+			return fmt.Errorf("meta command error: nil table, select table")
+		}
+		stats := e.DiskDetails.CacheStats()
+		fmt.Printf("cache hits: %d, misses: %d, evictions: %d, pages: %d/%d\n",
+			stats.Hits, stats.Misses, stats.Evictions, stats.Pages, stats.Capacity)
+		return nil
+	case ".integrity_check":
+		if e.DiskDetails == nil {
+			return fmt.Errorf("meta command error: nil table, select table")
+		}
+		report, err := e.DiskDetails.IntegrityCheck()
+		if err != nil {
+			return fmt.Errorf("meta command error: %w", err)
+		}
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+		if report.OK() {
+			fmt.Print("ok: ")
+		} else {
+			fmt.Printf("%d problems: ", len(report.Problems))
+		}
+		fmt.Printf("tables: %d, pages: %d, rows: %d, free pages: %d, orphaned pages: %d\n",
+			report.Tables, report.Pages, report.Rows, report.Free, report.Orphans)
+		return nil
+	case ".timeout":
+		if len(args) == 1 {
+			fmt.Printf("busy timeout: %d ms\n", diskmanager.BUSY_TIMEOUT.Milliseconds())
+			return nil
+		}
+		ms, err := strconv.Atoi(args[1])
+		if len(args) != 2 || err != nil || ms < 0 {
+			return fmt.Errorf("meta command error: syntax error\n ussage: .timeout [milliseconds]")
+		}
+		diskmanager.BUSY_TIMEOUT = time.Duration(ms) * time.Millisecond
+		return nil
+	case ".schema":
+		if e.DiskDetails == nil {
+			return fmt.Errorf("meta command error: nil table, select table")
+		}
+		for i, ti := range e.DiskDetails.Tables() {
+			typ := "list"
+			if ti.IsTree {
+				typ = "tree"
+			}
+			switch {
+			case ti.TblSch != nil && ti.IsTree:
+				fmt.Printf("%s;\n", ti.TblSch)
+			case ti.TblSch != nil:
+				fmt.Printf("%s list;\n", ti.TblSch)
+			case i == 0:
+				// the table the file was created with carries the options of the file
+				fmt.Printf("create %s %s order %d key %s;\n", ti.TblNam, typ, e.DiskDetails.Fanout, diskmanager.KeyTypeName(ti.KeyTyp))
+			default:
+				fmt.Printf("create table %s %s key %s;\n", ti.TblNam, typ, diskmanager.KeyTypeName(ti.KeyTyp))
+			}
+			for _, idx := range ti.TblIdx {
+				fmt.Printf("create index on %s(%s);\n", ti.TblNam, ti.Columns()[idx.IdxCol-1].Name)
+			}
+		}
+		return nil
+	case ".tables":
+		if e.DiskDetails != nil {
+			for _, ti := range e.DiskDetails.Tables() {
+				fmt.Println(ti.TblNam)
+			}
+			return nil
+		}
+		fallthrough
+	case ".databases":
+		entries, err := os.ReadDir(diskmanager.DB_FOLDER)
+		if err != nil {
+			return fmt.Errorf("meta command error: %w", err)
+		}
+		for _, entry := range entries {
+			// skip the logs and whatever an interrupted vacuum left behind
+			name := entry.Name()
+			if entry.IsDir() || strings.HasSuffix(name, diskmanager.WAL_SUFFIX) || strings.HasSuffix(name, ".vacuum") {
+				continue
+			}
+			fmt.Println(name)
+		}
+		return nil
 	}
 	return fmt.Errorf("unrecognised meta command: %s", cmd)
 }
 
+// PrepareStatements parses every statement of the input, nothing is returned when
+// one of them is invalid
+func PrepareStatements(input string) ([]Statement, error) {
+
+	nodes, err := parser.Parse(input)
+	if err != nil {
+		return nil, fmt.Errorf("statement error: %w", err)
+	}
+	stmts := make([]Statement, len(nodes))
+	for i, node := range nodes {
+		if err := stmts[i].fromAST(node); err != nil {
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
+
+// PrepareStatement parses input holding exactly one statement
 func (s *Statement) PrepareStatement(inpBuf string) error {
 
-	if len(inpBuf) < 6 {
-		return fmt.Errorf("statement error: invalid statement %s", inpBuf)
+	stmts, err := PrepareStatements(inpBuf)
+	if err != nil {
+		return err
+	}
+	if len(stmts) != 1 {
+		return fmt.Errorf("statement error: expected one statement, got %d", len(stmts))
 	}
+	*s = stmts[0]
+	return nil
+}
 
-	switch cmd := inpBuf[:6]; strings.ToLower(cmd) {
-	case "insert":
+func posErrorf(pos parser.Pos, format string, args ...any) error {
+	return fmt.Errorf("statement error at line %d, column %d: %s", pos.Line, pos.Col, fmt.Sprintf(format, args...))
+}
+
+// fromAST checks what the grammar cannot, such as name lengths and key types, and
+// turns the node into the input of its command
+func (s *Statement) fromAST(node parser.Stmt) error {
+
+	switch n := node.(type) {
+	case *parser.BeginStmt:
+		s.Cmd = STATEMENT_DB_BEGIN
+	case *parser.CommitStmt:
+		s.Cmd = STATEMENT_DB_COMMIT
+	case *parser.RollbackStmt:
+		s.Cmd = STATEMENT_DB_ROLLBACK
+	case *parser.VacuumStmt:
+		s.Cmd = STATEMENT_DB_VACUUM
+	case *parser.InsertStmt:
 		s.Cmd = STATEMENT_DB_INSERT
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 3 {
-			return fmt.Errorf("statement error: syntax error\n ussage: insert key value")
+		if n.Upsert {
+			s.Cmd = STATEMENT_DB_UPSERT
+		}
+		kv := KV{Key: n.Key.Text, Val: n.Value.Text, Table: n.Table.Text}
+		if n.Values != nil {
+			kv = KV{Row: make([]Field, len(n.Values)), Table: n.Table.Text}
+			for i, val := range n.Values {
+				kv.Row[i] = fieldOf(val)
+			}
 		}
-		key, err := strconv.Atoi(args[1])
-		if err != nil {
-			return fmt.Errorf("statement error: invalid key provided %w", err)
+		s.Inp = kv
+	case *parser.UpdateStmt:
+		s.Cmd = STATEMENT_DB_UPDATE
+		kv := KV{Key: n.Key.Text, Val: n.Value.Text, Table: n.Table.Text, Where: n.Where}
+		for _, set := range n.Set {
+			field := fieldOf(set.Value)
+			field.Column = set.Column.Text
+			kv.Row = append(kv.Row, field)
+		}
+		s.Inp = kv
+	case *parser.SelectStmt:
+		s.Cmd = STATEMENT_DB_SELECT
+		s.Inp = KV{Key: n.Key.Text, All: n.All, Table: n.Table.Text, Where: n.Where}
+	case *parser.DeleteStmt:
+		s.Cmd = STATEMENT_DB_DELETE
+		s.Inp = KV{Key: n.Key.Text, Table: n.Table.Text, Where: n.Where}
+	case *parser.ScanStmt:
+		s.Cmd = STATEMENT_DB_SCAN
+		s.Inp = ScanInfo{From: n.From.Text, To: n.To.Text, Limit: n.Limit, Desc: n.Desc, Table: n.Table.Text}
+	case *parser.CreateStmt:
+		s.Cmd = STATEMENT_DB_CREATE
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-		if len(args[2]) > 32 {
-			return fmt.Errorf("statement error: string length cannot exceed 32 got %d", len(args[2]))
+		info := DBInfo{Name: n.Name.Text, Type: n.Type.Text}
+		if err := info.setOptions(n.Options); err != nil {
+			return err
 		}
-		s.Inp = KV{
-			Key: int32(key),
-			Val: args[2],
+		s.Inp = info
+	case *parser.CreateTableStmt:
+		s.Cmd = STATEMENT_DB_CREATE_TABLE
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-	case "select":
-		s.Cmd = STATEMENT_DB_SELECT
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 2 {
-			return fmt.Errorf("statement error: syntax error\n ussage: select key or select all")
+		info := DBInfo{Name: n.Name.Text, Type: n.Type.Text}
+		if info.Type == "" {
+			info.Type = "tree"
 		}
-		if args[1] == "all" {
-			s.Inp = "all"
-		} else {
-			key, err := strconv.Atoi(args[1])
+		for _, def := range n.Columns {
+			colType, err := diskmanager.ColumnTypeByName(def.Type.Text)
 			if err != nil {
-				return fmt.Errorf("statement error: invalid key provided %w", err)
+				return posErrorf(def.Type.Pos, "%s", err.Error())
 			}
-			s.Inp = KV{
-				Key: int32(key),
-				Val: "",
+			info.Columns = append(info.Columns, diskmanager.Column{Name: def.Name.Text, Type: colType, PrimKey: def.PrimKey})
+		}
+		for _, opt := range n.Options {
+			// the primary key column decides the key type
+			if opt.Name == "key" && info.Columns != nil {
+				return posErrorf(opt.Pos, "a table is keyed by its primary key column, the key option is not allowed")
 			}
 		}
-	case "update":
-		s.Cmd = STATEMENT_DB_UPDATE
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 3 {
-			return fmt.Errorf("statement error: syntax error\n ussage: update key value")
+		if err := info.setOptions(n.Options); err != nil {
+			return err
 		}
-		key, err := strconv.Atoi(args[1])
-		if err != nil {
-			return fmt.Errorf("statement error: invalid key provided %w", err)
+		s.Inp = info
+	case *parser.CreateIndexStmt:
+		s.Cmd = STATEMENT_DB_CREATE_INDEX
+		s.Inp = IndexInfo{Table: n.Table.Text, Column: n.Column.Text}
+	case *parser.DropStmt:
+		s.Cmd = STATEMENT_DB_DROPDB
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-		if len(args[2]) >= 32 {
-			return fmt.Errorf("statement error: string length cannot exceed 32 got %d", len(args[2]))
+		s.Inp = DBInfo{Name: n.Name.Text}
+	case *parser.UpgradeStmt:
+		s.Cmd = STATEMENT_DB_UPGRADE
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-		s.Inp = KV{
-			Key: int32(key),
-			Val: args[2],
+		s.Inp = DBInfo{Name: n.Name.Text}
+	case *parser.AlterStmt:
+		s.Cmd = STATEMENT_DB_ALTER
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-	case "delete":
-		s.Cmd = STATEMENT_DB_DELETE
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 2 {
-			return fmt.Errorf("statement error: syntax error\n ussage: delete key")
+		s.Inp = DBInfo{Name: n.Name.Text, Type: n.Type.Text}
+	case *parser.LoadStmt:
+		s.Cmd = STATEMENT_DB_LOAD
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-		key, err := strconv.Atoi(args[1])
-		if err != nil {
-			return fmt.Errorf("statement error: invalid key provided %w", err)
+		s.Inp = LoadInfo{Name: n.Name.Text, File: n.File.Text}
+	case *parser.SwitchStmt:
+		s.Cmd = STATEMENT_DB_SWITCH
+		if err := checkDBName(n.Name); err != nil {
+			return err
 		}
-		s.Inp = KV{
-			Key: int32(key),
-			Val: "",
+		s.Inp = DBInfo{Name: n.Name.Text, ReadOnly: n.ReadOnly, Salvage: n.Salvage}
+	default:
+		return posErrorf(node.Start(), "unsupported statement %T", node)
+	}
+	return nil
+}
+
+func (info *DBInfo) setOptions(opts []parser.Option) error {
+
+	for _, opt := range opts {
+		switch opt.Name {
+		case "order", "pagesize":
+			size, err := strconv.Atoi(opt.Value.Text)
+			if err != nil {
+				return posErrorf(opt.Value.Pos, "invalid %s provided %s", opt.Name, opt.Value.Text)
+			}
+			info.Order = size
+			if opt.Name == "pagesize" {
+				info.Order = diskmanager.OrderForPageSize(size)
+			}
+		case "key":
+			keyType, err := diskmanager.KeyTypeByName(opt.Value.Text)
+			if err != nil {
+				return posErrorf(opt.Value.Pos, "%s", err.Error())
+			}
+			info.KeyType = keyType
 		}
-	case "create":
-		s.Cmd = STATEMENT_DB_CREATE
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 3 {
-			return fmt.Errorf("statement error: syntax error\n ussage: create dbname tabletype")
-		}
-		if len(args[1]) >= 32 {
-			return fmt.Errorf("statement error: database name length should not exceed 32")
-		}
-		allowedDBType := []string{"tree", "list"}
-		isValid := false
-		for _, v := range allowedDBType {
-			if strings.ToLower(args[2]) == v {
-				s.Inp = DBInfo{
-					Name: args[1],
-					Type: v,
+	}
+	return nil
+}
+
+func fieldOf(val parser.Literal) Field {
+	return Field{Text: val.Text, Null: val.Kind == parser.TK_WORD && strings.EqualFold(val.Text, "null")}
+}
+
+// checkDBName keeps names to a single file inside DB_FOLDER
+func checkDBName(name parser.Literal) error {
+
+	switch {
+	case name.Text == "":
+		return posErrorf(name.Pos, "database name cannot be empty")
+	case len(name.Text) >= 32:
+		return posErrorf(name.Pos, "database name length should not exceed 32")
+	case strings.ContainsAny(name.Text, "/\\") || name.Text == "." || name.Text == "..":
+		return posErrorf(name.Pos, "database name %q is not a valid file name", name.Text)
+	}
+	return nil
+}
+
+// closeDatabase releases the database in use, if any
+func (e *ExecutionInfo) closeDatabase() error {
+
+	if e.DiskDetails == nil {
+		return nil
+	}
+	err := e.DiskDetails.Close()
+	e.TableDetails = nil
+	e.DiskDetails = nil
+	if err != nil {
+		return fmt.Errorf("execute error: %w", err)
+	}
+	return nil
+}
+
+// tableRef is the table a statement works on
+type tableRef struct {
+	Table diskmanager.Table
+	Info  *diskmanager.TblInfo
+	Disk  *diskmanager.DiskManager
+}
+
+// table finds the table called name in the database in use, the one the database was
+// created with when name is empty
+func (e *ExecutionInfo) table(name string) (tableRef, error) {
+
+	if e.TableDetails == nil {
+		return tableRef{}, fmt.Errorf("execute error: nil table, select table")
+	}
+	if name == "" {
+		return tableRef{Table: e.TableDetails, Info: e.DiskDetails.Tables()[0], Disk: e.DiskDetails}, nil
+	}
+	info, err := e.DiskDetails.TableInfo(name)
+	if err != nil {
+		return tableRef{}, fmt.Errorf("execute error: %w", err)
+	}
+	table, err := diskmanager.InitTable(e.DiskDetails, name)
+	if err != nil {
+		return tableRef{}, fmt.Errorf("execute error: %w", err)
+	}
+	return tableRef{Table: table, Info: info, Disk: e.DiskDetails}, nil
+}
+
+// useDatabase makes dsk the database in use, starting on the table it was created with
+func (e *ExecutionInfo) useDatabase(dsk *diskmanager.DiskManager) error {
+
+	table, err := diskmanager.InitTable(dsk, dsk.Tables()[0].TblNam)
+	if err != nil {
+		return fmt.Errorf("execute error: %w", err)
+	}
+	e.TableDetails = table
+	e.DiskDetails = dsk
+	return nil
+}
+
+// parseKey reads a typed key in the key type of the table
+func (t tableRef) parseKey(text string) (diskmanager.Key, error) {
+
+	key, err := t.Info.ParseKey(text)
+	if err != nil {
+		return nil, fmt.Errorf("execute error: invalid key provided %w", err)
+	}
+	return key, nil
+}
+
+// checkRow makes sure the statement gives a row exactly when the table has columns
+func (t tableRef) checkRow(kv KV, usage string) error {
+
+	switch {
+	case t.Info.TblSch != nil && kv.Row == nil:
+		return fmt.Errorf("execute error: table %s has columns, use %s", t.Info.TblSch.Name, usage)
+	case t.Info.TblSch == nil && kv.Row != nil:
+		return fmt.Errorf("execute error: table %s has no columns, values are given as key value", t.Info.TblNam)
+	}
+	return nil
+}
+
+// parseKV reads the key and value of an insert, given as a row when the table has
+// columns
+func (t tableRef) parseKV(kv KV, usage string) (diskmanager.Key, string, error) {
+
+	if err := t.checkRow(kv, usage); err != nil {
+		return nil, "", err
+	}
+	if kv.Row != nil {
+		return t.parseRow(kv.Row)
+	}
+	key, err := t.parseKey(kv.Key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, kv.Val, nil
+}
+
+// setFields parses fields into row, each into the column it names or else the one at
+// its position
+func (t tableRef) setFields(row []any, fields []Field) error {
+
+	columns := t.Info.Columns()
+	for i, field := range fields {
+		col := i
+		if field.Column != "" {
+			col = -1
+			for j := range columns {
+				if strings.EqualFold(columns[j].Name, field.Column) {
+					col = j
 				}
-				isValid = true
+			}
+			if col == -1 {
+				return fmt.Errorf("execute error: table %s has no column %s", t.Info.TblNam, field.Column)
+			}
+			if columns[col].PrimKey {
+				return fmt.Errorf("execute error: primary key %s cannot be updated", field.Column)
 			}
 		}
-		if !isValid {
-			return fmt.Errorf("statement error: invalid tree type allowed db table types are %v", allowedDBType)
+		if field.Null {
+			row[col] = nil
+			continue
 		}
-	case "dropdb":
-		s.Cmd = STATEMENT_DB_DROPDB
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 2 {
-			return fmt.Errorf("statement error: syntax error\n ussage: dropdb dbname")
+		val, err := diskmanager.ParseValue(columns[col].Type, field.Text)
+		if err != nil {
+			return fmt.Errorf("execute error: column %s: %w", columns[col].Name, err)
 		}
-		if len(args[1]) >= 32 {
-			return fmt.Errorf("statement error: database name length should not exceed 32")
+		row[col] = val
+	}
+	return nil
+}
+
+// parseRow turns the values of an insert into the key and record of the row
+func (t tableRef) parseRow(fields []Field) (diskmanager.Key, string, error) {
+
+	schema := t.Info.TblSch
+	if len(fields) != len(schema.Columns) {
+		return nil, "", fmt.Errorf("execute error: table %s has %d columns, got %d values", schema.Name, len(schema.Columns), len(fields))
+	}
+	row := make([]any, len(fields))
+	if err := t.setFields(row, fields); err != nil {
+		return nil, "", err
+	}
+	key, val, err := t.Info.EncodeRow(row)
+	if err != nil {
+		return nil, "", fmt.Errorf("execute error: %w", err)
+	}
+	return key, val, nil
+}
+
+// updateRow reads the row at key and returns its record with the fields set
+func (t tableRef) updateRow(key diskmanager.Key, fields []Field) (string, error) {
+
+	val, err := t.Table.Select(key)
+	if err != nil {
+		return "", fmt.Errorf("execute error: %w", err)
+	}
+	row, err := t.Info.DecodeRow(key, val)
+	if err != nil {
+		return "", fmt.Errorf("execute error: %w", err)
+	}
+	if err := t.setFields(row, fields); err != nil {
+		return "", err
+	}
+	_, val, err = t.Info.EncodeRow(row)
+	if err != nil {
+		return "", fmt.Errorf("execute error: %w", err)
+	}
+	return val, nil
+}
+
+// formatRow prints a key and its value, as columns when the table has them
+func (t tableRef) formatRow(key diskmanager.Key, val string) (string, error) {
+
+	schema := t.Info.TblSch
+	if schema == nil {
+		return fmt.Sprintf("Key: %s, Value: %s", t.Info.FormatKey(key), val), nil
+	}
+	row, err := t.Info.DecodeRow(key, val)
+	if err != nil {
+		return "", err
+	}
+	cols := make([]string, len(row))
+	for i, v := range row {
+		cols[i] = schema.Columns[i].Name + ": " + diskmanager.FormatValue(v)
+	}
+	return strings.Join(cols, ", "), nil
+}
+
+// printRows prints at most limit rows of the iterator, every row when limit is 0
+func (t tableRef) printRows(it *diskmanager.Iterator, limit int) (int, error) {
+
+	rows := 0
+	for (limit == 0 || rows < limit) && it.Next() {
+		line, err := t.formatRow(it.Key(), it.Value())
+		if err != nil {
+			return rows, err
 		}
-		s.Inp = DBInfo{
-			Name: args[1],
+		fmt.Println(line)
+		rows++
+	}
+	return rows, it.Err()
+}
+
+// atomically runs op as one transaction, so that a statement writing many rows either
+// writes all of them or none. Inside an open transaction op simply becomes part of it.
+func (e *ExecutionInfo) atomically(op func() error) error {
+
+	if e.DiskDetails.InTransaction() {
+		return op()
+	}
+	if err := e.DiskDetails.Begin(); err != nil {
+		return err
+	}
+	if err := op(); err != nil {
+		if rbErr := e.DiskDetails.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w, rollback failed: %w", err, rbErr)
 		}
-	case "switch":
-		s.Cmd = STATEMENT_DB_SWITCH
-		args := strings.Split(inpBuf, " ")
-		if len(args) != 2 {
-			return fmt.Errorf("statement error: syntax error\n ussage: drop dbname")
+		return err
+	}
+	return e.DiskDetails.Commit()
+}
+
+// updateWhere sets the fields of kv on every row matching its where clause
+func (e *ExecutionInfo) updateWhere(t tableRef, kv KV) (int, error) {
+
+	keys, rows, err := t.matching(kv.Where)
+	if err != nil {
+		return 0, err
+	}
+	vals := make([]string, len(rows))
+	for i, row := range rows {
+		if err := t.setFields(row, kv.Row); err != nil {
+			return 0, err
 		}
-		if len(args[1]) >= 32 {
-			return fmt.Errorf("statement error: database name length should not exceed 32")
+		if vals[i], err = t.record(row); err != nil {
+			return 0, fmt.Errorf("execute error: key %s: %w", t.Info.FormatKey(keys[i]), err)
 		}
-		s.Inp = DBInfo{
-			Name: args[1],
+	}
+	err = e.atomically(func() error {
+		for i, key := range keys {
+			if err := t.Table.Update(key, vals[i]); err != nil {
+				return err
+			}
 		}
-	default:
-		return fmt.Errorf("statemnet error: invalid command %s", cmd)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("execute error: %w", err)
 	}
-	return nil
+	return len(keys), nil
+}
+
+// deleteWhere deletes every row matching the where clause of kv
+func (e *ExecutionInfo) deleteWhere(t tableRef, kv KV) (int, error) {
+
+	keys, _, err := t.matching(kv.Where)
+	if err != nil {
+		return 0, err
+	}
+	err = e.atomically(func() error {
+		for _, key := range keys {
+			if err := t.Table.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("execute error: %w", err)
+	}
+	return len(keys), nil
 }
 
 func (e *ExecutionInfo) ExecuteStatement() error {
 	if e == nil {
 		return fmt.Errorf("execute error: nil execution info error")
 	}
-	defer func() error {
-		err := e.TableDetails.ResetCursor()
+	switch e.StatementDetails.Cmd {
+	case STATEMENT_DB_INSERT:
+		kv := e.StatementDetails.Inp.(KV)
+		t, err := e.table(kv.Table)
 		if err != nil {
 			return err
 		}
-		return nil
-	}()
-	switch e.StatementDetails.Cmd {
-	case STATEMENT_DB_INSERT:
-		if e.TableDetails == nil {
-			return fmt.Errorf("execute error: nil table, select table")
+		key, val, err := t.parseKV(kv, "insert (value, ...)")
+		if err != nil {
+			return err
 		}
-		kv := e.StatementDetails.Inp.(KV)
-		err := e.TableDetails.Insert(kv.Key, kv.Val)
+		err = t.Table.Insert(key, val)
 		if err != nil {
 			return fmt.Errorf("execute error: %w", err)
 		}
 		fmt.Println("execute success: insert")
+	case STATEMENT_DB_UPSERT:
+		kv := e.StatementDetails.Inp.(KV)
+		t, err := e.table(kv.Table)
+		if err != nil {
+			return err
+		}
+		key, val, err := t.parseKV(kv, "upsert (value, ...)")
+		if err != nil {
+			return err
+		}
+		err = t.Table.Upsert(key, val)
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: upsert")
 	case STATEMENT_DB_SELECT:
-		if e.TableDetails == nil {
-			return fmt.Errorf("execute error: nil table, select table")
+		inp := e.StatementDetails.Inp.(KV)
+		t, err := e.table(inp.Table)
+		if err != nil {
+			return err
 		}
-		inp, ok := e.StatementDetails.Inp.(KV)
-		if !ok {
-			if e.StatementDetails.Inp.(string) != "all" {
-				return fmt.Errorf("execute error: invalid select input %v", e.StatementDetails.Inp)
+		if inp.All {
+			q, err := t.where(inp.Where)
+			if err != nil {
+				return err
 			}
-			err := e.TableDetails.SelectAll()
+			err = t.each(q, func(key diskmanager.Key, val string, _ []any) error {
+				line, err := t.formatRow(key, val)
+				if err != nil {
+					return err
+				}
+				fmt.Println(line)
+				return nil
+			})
 			if err != nil {
 				return fmt.Errorf("execute error:%w", err)
 			}
 			return nil
 		}
-		val, err := e.TableDetails.Select(inp.Key)
+		key, err := t.parseKey(inp.Key)
+		if err != nil {
+			return err
+		}
+		val, err := t.Table.Select(key)
 		if err != nil {
 			return fmt.Errorf("execute error:%w", err)
 		}
-		fmt.Printf("output- Key:%d Value:%s\n", inp.Key, val)
-	case STATEMENT_DB_UPDATE:
-		if e.TableDetails == nil {
-			return fmt.Errorf("execute error: nil table, select table")
+		if t.Info.TblSch != nil {
+			line, err := t.formatRow(key, val)
+			if err != nil {
+				return fmt.Errorf("execute error:%w", err)
+			}
+			fmt.Printf("output- %s\n", line)
+			return nil
+		}
+		fmt.Printf("output- Key:%s Value:%s\n", t.Info.FormatKey(key), val)
+	case STATEMENT_DB_SCAN:
+		info := e.StatementDetails.Inp.(ScanInfo)
+		t, err := e.table(info.Table)
+		if err != nil {
+			return err
+		}
+		from, err := t.parseKey(info.From)
+		if err != nil {
+			return err
+		}
+		to, err := t.parseKey(info.To)
+		if err != nil {
+			return err
 		}
+		it, err := t.Table.Scan(from, to, info.Desc)
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		rows, err := t.printRows(it, info.Limit)
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Printf("execute success: scan %d rows\n", rows)
+	case STATEMENT_DB_UPDATE:
 		kv := e.StatementDetails.Inp.(KV)
-		err := e.TableDetails.Update(kv.Key, kv.Val)
+		t, err := e.table(kv.Table)
+		if err != nil {
+			return err
+		}
+		if kv.Where != nil {
+			rows, err := e.updateWhere(t, kv)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("execute success: update %d rows\n", rows)
+			return nil
+		}
+		if err := t.checkRow(kv, "update key set column = value, ..."); err != nil {
+			return err
+		}
+		key, err := t.parseKey(kv.Key)
+		if err != nil {
+			return err
+		}
+		val := kv.Val
+		if kv.Row != nil {
+			if val, err = t.updateRow(key, kv.Row); err != nil {
+				return err
+			}
+		}
+		err = t.Table.Update(key, val)
 		if err != nil {
 			return fmt.Errorf("execute error: %w", err)
 		}
 		fmt.Println("execute success: update")
 	case STATEMENT_DB_DELETE:
-		if e.TableDetails == nil {
-			return fmt.Errorf("execute error: nil table, select table")
-		}
 		kv := e.StatementDetails.Inp.(KV)
-		err := e.TableDetails.Delete(kv.Key)
+		t, err := e.table(kv.Table)
+		if err != nil {
+			return err
+		}
+		if kv.Where != nil {
+			rows, err := e.deleteWhere(t, kv)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("execute success: delete %d rows\n", rows)
+			return nil
+		}
+		key, err := t.parseKey(kv.Key)
+		if err != nil {
+			return err
+		}
+		err = t.Table.Delete(key)
 		if err != nil {
 			return fmt.Errorf("execute error: %w", err)
 		}
 		fmt.Println("execute success: delete")
 	case STATEMENT_DB_CREATE:
 		info := e.StatementDetails.Inp.(DBInfo)
-		err := diskmanager.CreateDatabase(info.Name, info.Type)
+		err := diskmanager.CreateDatabase(info.Name, info.Type, info.Order, info.KeyType)
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: create")
+	case STATEMENT_DB_CREATE_TABLE:
+		info := e.StatementDetails.Inp.(DBInfo)
+		if e.DiskDetails != nil {
+			if info.Order != 0 {
+				return fmt.Errorf("execute error: order and pagesize are chosen for the whole file when the database is created")
+			}
+			err := e.DiskDetails.AddTable(info.Name, info.Type, info.KeyType, info.Columns)
+			if err != nil {
+				return fmt.Errorf("execute error: %w", err)
+			}
+			fmt.Println("execute success: create table")
+			return nil
+		}
+		// with no database in use the table gets a database file of its own
+		var err error
+		switch {
+		case info.Columns == nil:
+			err = diskmanager.CreateDatabase(info.Name, info.Type, info.Order, info.KeyType)
+		case info.Type != "tree":
+			return fmt.Errorf("execute error: a table with a file of its own is a tree, use a database to add a list table to it")
+		default:
+			err = diskmanager.CreateTable(info.Name, info.Columns, info.Order)
+		}
 		if err != nil {
 			return fmt.Errorf("execute error: %w", err)
 		}
 		fmt.Println("execute success: create")
+	case STATEMENT_DB_CREATE_INDEX:
+		if e.DiskDetails == nil {
+			return fmt.Errorf("execute error: nil table, select table")
+		}
+		info := e.StatementDetails.Inp.(IndexInfo)
+		err := e.DiskDetails.AddIndex(info.Table, info.Column)
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: create index")
 	case STATEMENT_DB_SWITCH:
+		if e.DiskDetails != nil && e.DiskDetails.InTransaction() {
+			return fmt.Errorf("execute error: transaction open, commit or rollback first")
+		}
 		info := e.StatementDetails.Inp.(DBInfo)
-		dsk, err := diskmanager.InitDatabase(info.Name)
+		dbFile := diskmanager.DB_FOLDER + "/" + info.Name
+		// the lock held on the current database would keep it from opening again
+		reopen := e.DiskDetails != nil && e.DiskDetails.FilObj.Name() == dbFile
+		wasReadOnly := reopen && e.DiskDetails.RdOnly
+		if reopen {
+			if err := e.closeDatabase(); err != nil {
+				return err
+			}
+		}
+		var dsk *diskmanager.DiskManager
+		var err error
+		if info.Salvage {
+			dsk, err = diskmanager.SalvageDatabaseAt(dbFile, diskmanager.BUSY_TIMEOUT)
+		} else {
+			dsk, err = diskmanager.OpenDatabaseAt(dbFile, info.ReadOnly, diskmanager.BUSY_TIMEOUT)
+		}
 		if err != nil {
+			// stay on the database the way it was open before
+			if reopen {
+				if old, oldErr := diskmanager.OpenDatabaseAt(dbFile, wasReadOnly, diskmanager.BUSY_TIMEOUT); oldErr == nil {
+					if e.useDatabase(old) != nil {
+						old.Close()
+					}
+				}
+			}
 			return fmt.Errorf("execute error: %w", err)
 		}
-		e.TableDetails = diskmanager.InitTable(dsk)
+		if err := e.closeDatabase(); err != nil {
+			dsk.Close()
+			return err
+		}
+		if err := e.useDatabase(dsk); err != nil {
+			dsk.Close()
+			return err
+		}
 		fmt.Println("execute success: switched to database: ", info.Name)
 	case STATEMENT_DB_DROPDB:
+		if e.DiskDetails != nil && e.DiskDetails.InTransaction() {
+			return fmt.Errorf("execute error: transaction open, commit or rollback first")
+		}
 		info := e.StatementDetails.Inp.(DBInfo)
+		// never keep using the file of a dropped database
+		if e.DiskDetails != nil && e.DiskDetails.FilObj.Name() == diskmanager.DB_FOLDER+"/"+info.Name {
+			if err := e.closeDatabase(); err != nil {
+				return err
+			}
+		}
 		err := diskmanager.DropDatabase(info.Name)
 		if err != nil {
 			return fmt.Errorf("execution error: %w", err)
 		}
+	case STATEMENT_DB_UPGRADE:
+		info := e.StatementDetails.Inp.(DBInfo)
+		// the database in use is upgraded through its open file, any other is opened for it
+		var upgraded bool
+		var err error
+		if e.DiskDetails != nil && e.DiskDetails.FilObj.Name() == diskmanager.DB_FOLDER+"/"+info.Name {
+			upgraded, err = e.DiskDetails.Upgrade()
+		} else {
+			upgraded, err = diskmanager.UpgradeDatabase(info.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		if !upgraded {
+			fmt.Printf("execute success: %s already is format version %d\n", info.Name, diskmanager.FORMAT_VERSION)
+			return nil
+		}
+		fmt.Printf("execute success: upgraded %s to format version %d\n", info.Name, diskmanager.FORMAT_VERSION)
+	case STATEMENT_DB_ALTER:
+		info := e.StatementDetails.Inp.(DBInfo)
+		// tables of the database in use look up their type on every call and follow along
+		var changed bool
+		var err error
+		if e.DiskDetails != nil && e.DiskDetails.FilObj.Name() == diskmanager.DB_FOLDER+"/"+info.Name {
+			changed, err = e.DiskDetails.SetTableType(info.Name, info.Type)
+		} else {
+			changed, err = diskmanager.SetDatabaseType(info.Name, info.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		if !changed {
+			fmt.Printf("execute success: %s already is a %s\n", info.Name, info.Type)
+			return nil
+		}
+		fmt.Printf("execute success: converted %s to a %s\n", info.Name, info.Type)
+	case STATEMENT_DB_LOAD:
+		info := e.StatementDetails.Inp.(LoadInfo)
+		var rows int
+		var err error
+		if e.DiskDetails != nil && e.DiskDetails.FilObj.Name() == diskmanager.DB_FOLDER+"/"+info.Name {
+			rows, err = loadCSV(e.DiskDetails, info.File)
+		} else {
+			var dsk *diskmanager.DiskManager
+			if dsk, err = diskmanager.InitDatabase(info.Name); err == nil {
+				rows, err = loadCSV(dsk, info.File)
+				err = errors.Join(err, dsk.Close())
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Printf("execute success: loaded %d rows into %s\n", rows, info.Name)
+	case STATEMENT_DB_VACUUM:
+		if e.DiskDetails == nil {
+			return fmt.Errorf("execute error: nil table, select table")
+		}
+		reclaimed, err := e.DiskDetails.Vacuum()
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Printf("execute success: vacuum reclaimed %d bytes\n", reclaimed)
+	case STATEMENT_DB_BEGIN:
+		if e.DiskDetails == nil {
+			return fmt.Errorf("execute error: nil table, select table")
+		}
+		err := e.DiskDetails.Begin()
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: begin")
+	case STATEMENT_DB_COMMIT:
+		if e.DiskDetails == nil {
+			return fmt.Errorf("execute error: nil table, select table")
+		}
+		err := e.DiskDetails.Commit()
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: commit")
+	case STATEMENT_DB_ROLLBACK:
+		if e.DiskDetails == nil {
+			return fmt.Errorf("execute error: nil table, select table")
+		}
+		err := e.DiskDetails.Rollback()
+		if err != nil {
+			return fmt.Errorf("execute error: %w", err)
+		}
+		fmt.Println("execute success: rollback")
 	default:
 		return fmt.Errorf("unrecognised command")
 	}
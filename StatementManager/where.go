@@ -0,0 +1,502 @@
+package statement
+
+import (
+	"bytes"
+	"cmp"
+	diskmanager "db/DiskManager"
+	parser "db/Parser"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// truth is the outcome of a condition on one row. A comparison with NULL is unknown,
+// and takes the lower of its sides, or the higher and not turns it around.
+type truth int8
+
+const (
+	isFalse truth = iota
+	isUnknown
+	isTrue
+)
+
+type cond func(row []any) truth
+
+// query is a compiled where clause. Only the rows between From and To, both inclusive
+// and open when nil, are read and each of them still has to pass Match, the key range
+// just keeps the scan away from rows that cannot. With no key range an indexed column
+// can narrow the rows instead, then IdxCol is 1 + that column and the rows are the ones
+// its index holds between Low and High.
+type query struct {
+	From   diskmanager.Key
+	To     diskmanager.Key
+	IdxCol int
+	Low    any
+	High   any
+	Match  func(row []any) bool // nil passes every row
+}
+
+// record is the inverse of row, the value stored under the key of the row
+func (t tableRef) record(row []any) (string, error) {
+
+	if t.Info.TblSch != nil {
+		_, val, err := t.Info.EncodeRow(row)
+		return val, err
+	}
+	val, ok := row[1].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of a key value table cannot be NULL")
+	}
+	return val, nil
+}
+
+// column finds the column called name, the index is where row puts its value
+func (t tableRef) column(name parser.Literal) (int, diskmanager.Column, error) {
+
+	for i, col := range t.Info.Columns() {
+		if strings.EqualFold(col.Name, name.Text) {
+			return i, col, nil
+		}
+	}
+	return 0, diskmanager.Column{}, posErrorf(name.Pos, "table %s has no column %s", t.Info.TblNam, name.Text)
+}
+
+// where compiles a where clause against the columns of the table, a nil expr selects
+// every row
+func (t tableRef) where(expr parser.Expr) (query, error) {
+
+	if expr == nil {
+		return query{}, nil
+	}
+	match, err := t.compile(expr)
+	if err != nil {
+		return query{}, err
+	}
+	q := query{Match: func(row []any) bool { return match(row) == isTrue }}
+	t.keyRange(expr, &q)
+	if q.From == nil && q.To == nil {
+		for _, idx := range t.Info.TblIdx {
+			col := idx.IdxCol - 1
+			if t.valueRange(expr, col, t.Info.Columns()[col], &q.Low, &q.High) {
+				q.IdxCol = idx.IdxCol
+				break
+			}
+		}
+	}
+	return q, nil
+}
+
+// each calls fn, in key order, on every row of the query that passes its match
+func (t tableRef) each(q query, fn func(key diskmanager.Key, val string, row []any) error) error {
+
+	visit := func(key diskmanager.Key, val string) error {
+		row, err := t.Info.Row(key, val)
+		if err != nil {
+			return err
+		}
+		if q.Match != nil && !q.Match(row) {
+			return nil
+		}
+		return fn(key, val, row)
+	}
+	if q.IdxCol != 0 {
+		keys, err := t.Disk.IndexLookup(t.Info, q.IdxCol-1, q.Low, q.High)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			val, err := t.Table.Select(key)
+			if errors.Is(err, diskmanager.ErrKeyNotFound) {
+				// deleted since the lookup
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := visit(key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	it, err := t.Table.Scan(q.From, q.To, false)
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		if err := visit(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// matching returns the keys and rows that pass the where clause
+func (t tableRef) matching(expr parser.Expr) ([]diskmanager.Key, [][]any, error) {
+
+	q, err := t.where(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []diskmanager.Key
+	var rows [][]any
+	err = t.each(q, func(key diskmanager.Key, _ string, row []any) error {
+		keys = append(keys, key)
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("execute error: %w", err)
+	}
+	return keys, rows, nil
+}
+
+func (t tableRef) compile(expr parser.Expr) (cond, error) {
+
+	switch x := expr.(type) {
+	case *parser.LogicExpr:
+		left, err := t.compile(x.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := t.compile(x.Right)
+		if err != nil {
+			return nil, err
+		}
+		if x.Op == "and" {
+			return func(row []any) truth { return min(left(row), right(row)) }, nil
+		}
+		return func(row []any) truth { return max(left(row), right(row)) }, nil
+	case *parser.NotExpr:
+		inner, err := t.compile(x.X)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []any) truth { return isTrue - inner(row) }, nil
+	case *parser.CompareExpr:
+		i, col, err := t.column(x.Column)
+		if err != nil {
+			return nil, err
+		}
+		val, err := columnValue(col, x.Value)
+		if err != nil {
+			return nil, err
+		}
+		var test func(c int) bool
+		switch x.Op {
+		case "=":
+			test = func(c int) bool { return c == 0 }
+		case "<>", "!=":
+			test = func(c int) bool { return c != 0 }
+		case "<":
+			test = func(c int) bool { return c < 0 }
+		case "<=":
+			test = func(c int) bool { return c <= 0 }
+		case ">":
+			test = func(c int) bool { return c > 0 }
+		case ">=":
+			test = func(c int) bool { return c >= 0 }
+		default:
+			return nil, posErrorf(x.Pos, "unknown operator %s", x.Op)
+		}
+		return func(row []any) truth {
+			c, ok := compareValues(row[i], val)
+			if !ok {
+				return isUnknown
+			}
+			return truthOf(test(c))
+		}, nil
+	case *parser.BetweenExpr:
+		i, col, err := t.column(x.Column)
+		if err != nil {
+			return nil, err
+		}
+		low, err := columnValue(col, x.Low)
+		if err != nil {
+			return nil, err
+		}
+		high, err := columnValue(col, x.High)
+		if err != nil {
+			return nil, err
+		}
+		return func(row []any) truth {
+			cl, okLow := compareValues(row[i], low)
+			ch, okHigh := compareValues(row[i], high)
+			if !okLow || !okHigh {
+				return isUnknown
+			}
+			return truthOf((cl >= 0 && ch <= 0) != x.Not)
+		}, nil
+	case *parser.InExpr:
+		i, col, err := t.column(x.Column)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]any, len(x.Values))
+		for j, lit := range x.Values {
+			if vals[j], err = columnValue(col, lit); err != nil {
+				return nil, err
+			}
+		}
+		return func(row []any) truth {
+			res := isFalse
+			for _, val := range vals {
+				c, ok := compareValues(row[i], val)
+				if !ok {
+					res = isUnknown
+				} else if c == 0 {
+					res = isTrue
+					break
+				}
+			}
+			if x.Not {
+				return isTrue - res
+			}
+			return res
+		}, nil
+	case *parser.LikeExpr:
+		i, col, err := t.column(x.Column)
+		if err != nil {
+			return nil, err
+		}
+		if col.Type != diskmanager.CT_TEXT {
+			return nil, posErrorf(x.Pos, "like needs a text column, %s is %s", col.Name, diskmanager.ColumnTypeName(col.Type))
+		}
+		pattern := x.Pattern.Text
+		return func(row []any) truth {
+			s, ok := row[i].(string)
+			if !ok {
+				return isUnknown
+			}
+			return truthOf(like(s, pattern) != x.Not)
+		}, nil
+	}
+	return nil, posErrorf(expr.Start(), "unsupported condition %T", expr)
+}
+
+// keyRange narrows q to the keys every row passing expr has to be in, from the key
+// comparisons joined by and at the top of the clause
+func (t tableRef) keyRange(expr parser.Expr, q *query) {
+
+	if x, ok := expr.(*parser.LogicExpr); ok && x.Op == "and" {
+		t.keyRange(x.Left, q)
+		t.keyRange(x.Right, q)
+		return
+	}
+	// a literal that is no valid key cannot narrow the range, the filter still sees it
+	key := func(col parser.Literal, lit parser.Literal) diskmanager.Key {
+		if _, c, err := t.column(col); err != nil || !c.PrimKey || fieldOf(lit).Null {
+			return nil
+		}
+		k, err := t.Info.ParseKey(lit.Text)
+		if err != nil {
+			return nil
+		}
+		return k
+	}
+	lower := func(k diskmanager.Key) {
+		if k != nil && (q.From == nil || diskmanager.CompareKeys(k, q.From) > 0) {
+			q.From = k
+		}
+	}
+	upper := func(k diskmanager.Key) {
+		if k != nil && (q.To == nil || diskmanager.CompareKeys(k, q.To) < 0) {
+			q.To = k
+		}
+	}
+
+	switch x := expr.(type) {
+	case *parser.CompareExpr:
+		k := key(x.Column, x.Value)
+		switch x.Op {
+		case "=":
+			lower(k)
+			upper(k)
+		case ">", ">=":
+			lower(k)
+		case "<", "<=":
+			upper(k)
+		}
+	case *parser.BetweenExpr:
+		if !x.Not {
+			lower(key(x.Column, x.Low))
+			upper(key(x.Column, x.High))
+		}
+	case *parser.InExpr:
+		if x.Not {
+			return
+		}
+		var lo, hi diskmanager.Key
+		for _, lit := range x.Values {
+			k := key(x.Column, lit)
+			if k == nil {
+				// a value left out of the range could still match
+				return
+			}
+			if lo == nil || diskmanager.CompareKeys(k, lo) < 0 {
+				lo = k
+			}
+			if hi == nil || diskmanager.CompareKeys(k, hi) > 0 {
+				hi = k
+			}
+		}
+		lower(lo)
+		upper(hi)
+	}
+}
+
+// valueRange narrows low and high to the values of column i every row passing expr
+// has to lie between, the way keyRange does for keys, and tells whether it did
+func (t tableRef) valueRange(expr parser.Expr, i int, col diskmanager.Column, low, high *any) bool {
+
+	if x, ok := expr.(*parser.LogicExpr); ok && x.Op == "and" {
+		left := t.valueRange(x.Left, i, col, low, high)
+		right := t.valueRange(x.Right, i, col, low, high)
+		return left || right
+	}
+	value := func(name parser.Literal, lit parser.Literal) any {
+		if j, _, err := t.column(name); err != nil || j != i {
+			return nil
+		}
+		// NULL matches no comparison and a literal of the wrong type is left to the filter
+		val, err := columnValue(col, lit)
+		if err != nil {
+			return nil
+		}
+		return val
+	}
+	lower := func(v any) bool {
+		if c, ok := compareValues(v, *low); v != nil && (*low == nil || ok && c > 0) {
+			*low = v
+		}
+		return v != nil
+	}
+	upper := func(v any) bool {
+		if c, ok := compareValues(v, *high); v != nil && (*high == nil || ok && c < 0) {
+			*high = v
+		}
+		return v != nil
+	}
+
+	switch x := expr.(type) {
+	case *parser.CompareExpr:
+		v := value(x.Column, x.Value)
+		switch x.Op {
+		case "=":
+			return lower(v) && upper(v)
+		case ">", ">=":
+			return lower(v)
+		case "<", "<=":
+			return upper(v)
+		}
+	case *parser.BetweenExpr:
+		if !x.Not {
+			l := lower(value(x.Column, x.Low))
+			h := upper(value(x.Column, x.High))
+			return l || h
+		}
+	case *parser.InExpr:
+		if x.Not {
+			return false
+		}
+		var lo, hi any
+		for _, lit := range x.Values {
+			v := value(x.Column, lit)
+			if v == nil {
+				return false
+			}
+			if c, _ := compareValues(v, lo); lo == nil || c < 0 {
+				lo = v
+			}
+			if c, _ := compareValues(v, hi); hi == nil || c > 0 {
+				hi = v
+			}
+		}
+		return lower(lo) && upper(hi)
+	}
+	return false
+}
+
+// columnValue reads a literal of a where clause as a value of col, nil for an unquoted
+// null
+func columnValue(col diskmanager.Column, lit parser.Literal) (any, error) {
+
+	if fieldOf(lit).Null {
+		return nil, nil
+	}
+	val, err := diskmanager.ParseValue(col.Type, lit.Text)
+	if err != nil {
+		return nil, posErrorf(lit.Pos, "column %s: %s", col.Name, err.Error())
+	}
+	return val, nil
+}
+
+// compareValues orders two values of the same column, ok is false when either is NULL
+func compareValues(a, b any) (int, bool) {
+
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case b:
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func truthOf(b bool) truth {
+	if b {
+		return isTrue
+	}
+	return isFalse
+}
+
+// like matches s against pattern, where % stands for any run of characters and _ for
+// exactly one. Matching is case sensitive.
+func like(s, pattern string) bool {
+
+	str, pat := []rune(s), []rune(pattern)
+	si, pi := 0, 0
+	// where the last % was and how much of s it has taken so far
+	star, mark := -1, 0
+	for si < len(str) {
+		switch {
+		case pi < len(pat) && (pat[pi] == '_' || pat[pi] != '%' && pat[pi] == str[si]):
+			si++
+			pi++
+		case pi < len(pat) && pat[pi] == '%':
+			star, mark = pi, si
+			pi++
+		case star != -1:
+			mark++
+			si, pi = mark, star+1
+		default:
+			return false
+		}
+	}
+	for pi < len(pat) && pat[pi] == '%' {
+		pi++
+	}
+	return pi == len(pat)
+}
@@ -0,0 +1,281 @@
+package statement
+
+import (
+	diskmanager "db/DiskManager"
+	parser "db/Parser"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openTables makes a database with the key value table kv, keyed by strings, and the
+// table people with an index on name
+func openTables(t *testing.T) (kv tableRef, people tableRef) {
+
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kv")
+	if err := diskmanager.CreateDatabaseAt(path, "tree", 4, diskmanager.KT_STRING); err != nil {
+		t.Fatal(err)
+	}
+	d, err := diskmanager.InitDatabaseAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	columns := []diskmanager.Column{
+		{Name: "id", Type: diskmanager.CT_INTEGER, PrimKey: true},
+		{Name: "name", Type: diskmanager.CT_TEXT},
+		{Name: "age", Type: diskmanager.CT_INTEGER},
+	}
+	if err := d.AddTable("people", "tree", 0, columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddIndex("people", "name"); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := func(name string) tableRef {
+		table, err := diskmanager.InitTable(d, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := d.TableInfo(name)
+		return tableRef{Table: table, Info: info, Disk: d}
+	}
+	kv, people = ref("kv"), ref("people")
+	for _, k := range []string{"a", "b", "c", "m", "n", "z"} {
+		if err := kv.Table.Insert(diskmanager.Key(k), "v"+k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, row := range [][]any{
+		{int64(1), "ann", int64(30)},
+		{int64(2), "bob", nil},
+		{int64(3), "bob", int64(41)},
+		{int64(4), "cy", int64(7)},
+		{int64(5), nil, int64(12)},
+	} {
+		key, val, err := people.Info.EncodeRow(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := people.Table.Insert(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kv, people
+}
+
+// whereOf parses cond as the where clause of a select
+func whereOf(t *testing.T, cond string) parser.Expr {
+
+	t.Helper()
+	stmts, err := parser.Parse("select * where " + cond)
+	if err != nil {
+		t.Fatalf("%s: %v", cond, err)
+	}
+	return stmts[0].(*parser.SelectStmt).Where
+}
+
+func TestCompile(t *testing.T) {
+
+	_, people := openTables(t)
+	// age is NULL, every comparison with it is unknown
+	row := []any{int64(2), "bob", nil}
+	cases := []struct {
+		cond string
+		want truth
+	}{
+		{"id = 2", isTrue},
+		{"age = 3", isUnknown},
+		{"age = 3 and id = 2", isUnknown},
+		{"age = 3 and id = 1", isFalse},
+		{"age = 3 or id = 2", isTrue},
+		{"age = 3 or id = 1", isUnknown},
+		{"not age = 3", isUnknown},
+		{"not id = 1", isTrue},
+		{"not (age = 3 and id = 1)", isTrue},
+		{"not (age = 3 or id = 1)", isUnknown},
+		{"id in (1, 2)", isTrue},
+		{"id in (1, null)", isUnknown},
+		{"id in (2, null)", isTrue},
+		{"id not in (1, null)", isUnknown},
+		{"id not in (2, null)", isFalse},
+		{"id not in (1, 3)", isTrue},
+		{"age in (1, 2)", isUnknown},
+		{"id between 1 and 3", isTrue},
+		// a reversed range holds nothing
+		{"id between 3 and 1", isFalse},
+		{"id not between 3 and 1", isTrue},
+		{"age between 1 and 3", isUnknown},
+		{"name like 'b_b'", isTrue},
+		{"name not like 'b%'", isFalse},
+	}
+	for _, c := range cases {
+		match, err := people.compile(whereOf(t, c.cond))
+		if err != nil {
+			t.Fatalf("%s: %v", c.cond, err)
+		}
+		if got := match(row); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.cond, got, c.want)
+		}
+	}
+
+	if _, err := people.compile(whereOf(t, "age like '1%'")); err == nil {
+		t.Error("expected an error for like on an integer column")
+	}
+	if _, err := people.compile(whereOf(t, "height = 1")); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
+
+func TestLike(t *testing.T) {
+
+	cases := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"abc", "abc", true},
+		{"abc", "ABC", false},
+		{"abc", "a_c", true},
+		{"abc", "a_", false},
+		{"abc", "%c", true},
+		{"abc", "a%%c", true},
+		// the first b the % stops at is the wrong one, it has to take more
+		{"abcbcd", "a%bcd", true},
+		{"abcbce", "a%bcd", false},
+		{"aXbYbZc", "a%b_c", true},
+		{"mississippi", "m%iss%ppi", true},
+		{"mississippi", "%s_s%", true},
+		{"mississippi", "m%x%", false},
+		{"héllo", "h_llo", true},
+	}
+	for _, c := range cases {
+		if got := like(c.s, c.pattern); got != c.want {
+			t.Errorf("like(%q, %q) = %v, want %v", c.s, c.pattern, got, c.want)
+		}
+	}
+}
+
+func TestKeyRange(t *testing.T) {
+
+	kv, people := openTables(t)
+	intKey := func(s string) diskmanager.Key {
+		k, err := people.Info.ParseKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	cases := []struct {
+		table    tableRef
+		cond     string
+		from, to diskmanager.Key
+	}{
+		{kv, "key < 'm'", nil, diskmanager.Key("m")},
+		{kv, "key = 'b'", diskmanager.Key("b"), diskmanager.Key("b")},
+		{kv, "key >= 'b' and key < 'n' and key > 'a'", diskmanager.Key("b"), diskmanager.Key("n")},
+		{kv, "key = 'b' or key = 'c'", nil, nil},
+		{kv, "not key = 'b'", nil, nil},
+		{people, "id < 4", nil, intKey("4")},
+		{people, "id = 3", intKey("3"), intKey("3")},
+		{people, "id = 3 and name = 'bob'", intKey("3"), intKey("3")},
+		{people, "id between 2 and 4", intKey("2"), intKey("4")},
+		{people, "id in (4, 2, 3)", intKey("2"), intKey("4")},
+		{people, "id in (4, null)", nil, nil},
+		{people, "id not in (4, 5)", nil, nil},
+		// no valid key, the filter still sees it
+		{people, "id < 'x'", nil, nil},
+	}
+	for _, c := range cases {
+		var q query
+		c.table.keyRange(whereOf(t, c.cond), &q)
+		if !reflect.DeepEqual(q.From, c.from) || !reflect.DeepEqual(q.To, c.to) {
+			t.Errorf("%s: range %v to %v, want %v to %v", c.cond, q.From, q.To, c.from, c.to)
+		}
+	}
+}
+
+func TestValueRange(t *testing.T) {
+
+	_, people := openTables(t)
+	cases := []struct {
+		cond      string
+		col       int
+		ok        bool
+		low, high any
+	}{
+		{"name < 'm'", 1, true, nil, "m"},
+		{"name = 'bob'", 1, true, "bob", "bob"},
+		{"name > 'a' and name <= 'c' and name >= 'b'", 1, true, "b", "c"},
+		{"name in ('cy', 'ann')", 1, true, "ann", "cy"},
+		{"name = 'bob' or name = 'cy'", 1, false, nil, nil},
+		{"name = null", 1, false, nil, nil},
+		{"age < 30", 2, true, nil, int64(30)},
+		{"age = 7", 2, true, int64(7), int64(7)},
+		{"age = 7", 1, false, nil, nil},
+	}
+	for _, c := range cases {
+		var low, high any
+		col := people.Info.Columns()[c.col]
+		ok := people.valueRange(whereOf(t, c.cond), c.col, col, &low, &high)
+		if ok != c.ok || !reflect.DeepEqual(low, c.low) || !reflect.DeepEqual(high, c.high) {
+			t.Errorf("%s: %v, %v to %v, want %v, %v to %v", c.cond, ok, low, high, c.ok, c.low, c.high)
+		}
+	}
+}
+
+// TestWherePath checks which rows a where clause reads, the index is only used
+// without a key range, and that both paths find the same rows
+func TestWherePath(t *testing.T) {
+
+	_, people := openTables(t)
+	cases := []struct {
+		cond  string
+		index bool
+		ids   []int64
+	}{
+		{"name = 'bob'", true, []int64{2, 3}},
+		{"name >= 'bob' and age > 20", true, []int64{3}},
+		{"name like 'b%'", false, []int64{2, 3}},
+		{"id >= 2 and name = 'bob'", false, []int64{2, 3}},
+		{"name = 'bob' or id = 1", false, []int64{1, 2, 3}},
+		{"not name = 'bob'", false, []int64{1, 4}},
+		{"age > 10", false, []int64{1, 3, 5}},
+	}
+	for _, c := range cases {
+		expr := whereOf(t, c.cond)
+		q, err := people.where(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.cond, err)
+		}
+		if (q.IdxCol != 0) != c.index {
+			t.Errorf("%s: index column %d, want the index %v", c.cond, q.IdxCol, c.index)
+		}
+		_, rows, err := people.matching(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.cond, err)
+		}
+		var ids []int64
+		for _, row := range rows {
+			ids = append(ids, row[0].(int64))
+		}
+		if !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: rows %v, want %v", c.cond, ids, c.ids)
+		}
+		// the full scan is what the index has to agree with
+		if q.IdxCol != 0 {
+			var scanned []int64
+			err := people.each(query{Match: q.Match}, func(_ diskmanager.Key, _ string, row []any) error {
+				scanned = append(scanned, row[0].(int64))
+				return nil
+			})
+			if err != nil || !reflect.DeepEqual(scanned, ids) {
+				t.Errorf("%s: scan found %v, %v, the index %v", c.cond, scanned, err, ids)
+			}
+		}
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bufio"
+	parser "db/Parser"
 	statement "db/StatementManager"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 )
 
+// one reader for the whole session, a fresh one per line would drop whatever it had
+// buffered past the newline
+var stdin = bufio.NewReader(os.Stdin)
+
 type InpInfo struct {
 	dbname string
 	cmdStr string
@@ -23,8 +29,7 @@ func (i *InpInfo) printPrompt() {
 
 func (i *InpInfo) readInput() {
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := stdin.ReadString('\n')
 	if err != nil {
 		fmt.Println("Error reading Input: ", err)
 		os.Exit(1)
@@ -33,6 +38,25 @@ func (i *InpInfo) readInput() {
 	i.cmdStr = input
 }
 
+// prepare parses the input, reading more lines while it ends inside a string or a
+// comment
+func (i *InpInfo) prepare() ([]statement.Statement, error) {
+
+	for {
+		stmts, err := statement.PrepareStatements(i.cmdStr)
+		var syntaxErr *parser.SyntaxError
+		if !errors.As(err, &syntaxErr) || !syntaxErr.Incomplete {
+			return stmts, err
+		}
+		fmt.Printf("...>")
+		line, readErr := stdin.ReadString('\n')
+		if readErr != nil {
+			return nil, err
+		}
+		i.cmdStr += "\n" + strings.TrimRight(line, "\r\n")
+	}
+}
+
 func main() {
 
 	inpInfo := &InpInfo{}
@@ -46,30 +70,32 @@ func main() {
 		}
 
 		if inpInfo.cmdStr[0] == '.' {
-			err := statement.DoMetaCommand(inpInfo.cmdStr)
+			err := e.DoMetaCommand(inpInfo.cmdStr)
 			if err != nil {
 				fmt.Println(err.Error())
-				continue
 			}
-		}
-
-		s := &statement.Statement{}
-		err := s.PrepareStatement(inpInfo.cmdStr)
-		if err != nil {
-			fmt.Println(err.Error())
 			continue
 		}
 
-		e.StatementDetails = *s
-		err = e.ExecuteStatement()
+		stmts, err := inpInfo.prepare()
 		if err != nil {
 			fmt.Println(err.Error())
 			continue
 		}
-		if s.Cmd == statement.STATEMENT_DB_SWITCH {
-			inpInfo.dbname = s.Inp.(statement.DBInfo).Name
-		} else if s.Cmd == statement.STATEMENT_DB_DROPDB {
-			inpInfo = &InpInfo{}
+
+		// statements after a failed one are not run
+		for _, s := range stmts {
+			e.StatementDetails = s
+			err = e.ExecuteStatement()
+			if err != nil {
+				fmt.Println(err.Error())
+				break
+			}
+			if s.Cmd == statement.STATEMENT_DB_SWITCH {
+				inpInfo.dbname = s.Inp.(statement.DBInfo).Name
+			} else if s.Cmd == statement.STATEMENT_DB_DROPDB && s.Inp.(statement.DBInfo).Name == inpInfo.dbname {
+				inpInfo.dbname = ""
+			}
 		}
 	}
 }